@@ -0,0 +1,84 @@
+// Package audit makes ActivityLogs tamper-evident. Every row stores the hash
+// of the previous row (PrevHash) and a hash over that link and its own content
+// (EntryHash), so editing, deleting or reordering rows breaks the chain.
+// Signed checkpoints additionally catch rows cut off the end of the log.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// timeLayout is how CreatedAt enters the hash. ActivityLogs.CreatedAt is a
+// DATETIME without zone or sub-second precision we can rely on, so only the
+// wall clock to the second is hashed.
+const timeLayout = "2006-01-02 15:04:05"
+
+// chainLock serialises writers so that each row links to the one before it,
+// across every connection and instance writing to the same database.
+const chainLock = "ActivityLogsChain"
+
+// Entry is the hashed content of one ActivityLogs row.
+type Entry struct {
+	UserID    int
+	Action    string
+	Details   string
+	APIKeyID  *int64
+	CreatedAt time.Time
+}
+
+// Hash returns the EntryHash of e when it follows a row whose hash is prev
+// ("" for the first chained row).
+func (e Entry) Hash(prev string) string {
+	var keyID int64
+	if e.APIKeyID != nil {
+		keyID = *e.APIKeyID
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%q\n%q\n%d\n%s",
+		prev, e.UserID, e.Action, e.Details, keyID, e.CreatedAt.Format(timeLayout))))
+	return hex.EncodeToString(sum[:])
+}
+
+// Append writes e as the next row of the chain.
+func Append(db *sql.DB, e Entry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.Truncate(time.Second)
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status int
+	err = tx.QueryRowContext(ctx, `DECLARE @status INT;
+		EXEC @status = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Transaction', @LockTimeout = 10000;
+		SELECT @status`, chainLock).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status < 0 {
+		return fmt.Errorf("could not lock the activity log chain (status %d)", status)
+	}
+
+	var prev sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT TOP 1 EntryHash FROM ActivityLogs WHERE EntryHash IS NOT NULL ORDER BY ID DESC").Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO ActivityLogs (UserID, Action, Details, APIKeyID, CreatedAt, PrevHash, EntryHash)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7)`,
+		e.UserID, e.Action, e.Details, e.APIKeyID, e.CreatedAt, prev.String, e.Hash(prev.String))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
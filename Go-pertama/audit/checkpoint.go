@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Keys holds the Ed25519 keys for checkpoints. Private is nil when the server
+// does not sign; Public is nil when signatures cannot be checked.
+type Keys struct {
+	Private ed25519.PrivateKey
+	Public  ed25519.PublicKey
+}
+
+// LoadKeys reads a PKCS#8 private key and/or a PKIX public key in PEM form.
+// Either path may be empty; the public key is derived from the private one
+// when only that is given.
+func LoadKeys(privateKeyFile, publicKeyFile string) (*Keys, error) {
+	keys := &Keys{}
+	if privateKeyFile != "" {
+		block, err := readPEM(privateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse audit signing key: %w", err)
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("audit signing key must be an Ed25519 key")
+		}
+		keys.Private = private
+		keys.Public = private.Public().(ed25519.PublicKey)
+	}
+	if publicKeyFile != "" {
+		block, err := readPEM(publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse audit verify key: %w", err)
+		}
+		public, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("audit verify key must be an Ed25519 key")
+		}
+		keys.Public = public
+	}
+	return keys, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
+
+// checkpointMessage is what a checkpoint signature covers.
+func checkpointMessage(logID int64, entryHash string) []byte {
+	return []byte(fmt.Sprintf("%d:%s", logID, entryHash))
+}
+
+// Checkpoint signs the newest chained row, unless it is already the latest
+// checkpoint. It reports whether a checkpoint was written.
+func Checkpoint(db *sql.DB, key ed25519.PrivateKey) (bool, error) {
+	var logID int64
+	var entryHash string
+	err := db.QueryRow("SELECT TOP 1 ID, EntryHash FROM ActivityLogs WHERE EntryHash IS NOT NULL ORDER BY ID DESC").Scan(&logID, &entryHash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var lastID int64
+	err = db.QueryRow("SELECT TOP 1 LogID FROM ActivityLogCheckpoints ORDER BY ID DESC").Scan(&lastID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if lastID == logID {
+		return false, nil
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, checkpointMessage(logID, entryHash)))
+	_, err = db.Exec("INSERT INTO ActivityLogCheckpoints (LogID, EntryHash, Signature, CreatedAt) VALUES (@p1, @p2, @p3, @p4)",
+		logID, entryHash, signature, time.Now())
+	return err == nil, err
+}
+
+// RunCheckpoints writes a checkpoint every interval until the process exits.
+func RunCheckpoints(db *sql.DB, key ed25519.PrivateKey, interval time.Duration) {
+	for {
+		if written, err := Checkpoint(db, key); err != nil {
+			log.Printf("Audit checkpoint failed: %v", err)
+		} else if written {
+			log.Println("Audit checkpoint written")
+		}
+		time.Sleep(interval)
+	}
+}
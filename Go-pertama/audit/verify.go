@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+)
+
+// Result is the outcome of walking the chain.
+type Result struct {
+	Valid   bool  `json:"valid"`
+	Checked int   `json:"checked"` // chained rows checked
+	FirstID int64 `json:"firstId,omitempty"`
+	LastID  int64 `json:"lastId,omitempty"`
+	// UnchainedRows were written before chaining was introduced and are not covered.
+	UnchainedRows int `json:"unchainedRows"`
+	// BrokenAt is the ID of the first row whose link or content does not match,
+	// or of the row a failing checkpoint points at.
+	BrokenAt *int64 `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+
+	Checkpoints int `json:"checkpoints"`
+	// SignaturesChecked is false when no verify key is configured; checkpoints
+	// are then compared with the chain but their signatures are not checked.
+	SignaturesChecked bool `json:"signaturesChecked"`
+}
+
+func (r *Result) fail(id int64, reason string) *Result {
+	r.Valid = false
+	r.BrokenAt = &id
+	r.Reason = reason
+	return r
+}
+
+// Verify checks the signed checkpoints, then walks ActivityLogs in ID order
+// and compares every row with its link, its content and any checkpoint taken
+// at it. public may be nil.
+func Verify(db *sql.DB, public ed25519.PublicKey) (*Result, error) {
+	result := &Result{Valid: true, SignaturesChecked: public != nil}
+
+	checkpoints, err := loadCheckpoints(db, public, result)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+
+	rows, err := db.Query(`SELECT ID, UserID, Action, Details, APIKeyID, CreatedAt, PrevHash, EntryHash
+		FROM ActivityLogs ORDER BY ID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prev := ""
+	chained := false
+	for rows.Next() {
+		var id int64
+		var e Entry
+		var details, prevHash, entryHash sql.NullString
+		var apiKeyID sql.NullInt64
+		if err := rows.Scan(&id, &e.UserID, &e.Action, &details, &apiKeyID, &e.CreatedAt, &prevHash, &entryHash); err != nil {
+			return nil, err
+		}
+		e.Details = details.String
+		if apiKeyID.Valid {
+			e.APIKeyID = &apiKeyID.Int64
+		}
+
+		if !entryHash.Valid {
+			if chained {
+				return result.fail(id, "row has no hash although the chain had already started"), nil
+			}
+			result.UnchainedRows++
+			continue
+		}
+		if !chained {
+			chained = true
+			result.FirstID = id
+		}
+
+		if prevHash.String != prev {
+			return result.fail(id, "previous hash does not match the row before it (a row was deleted, inserted or reordered)"), nil
+		}
+		if e.Hash(prev) != entryHash.String {
+			return result.fail(id, "content does not match its hash (the row was edited)"), nil
+		}
+		if signed, ok := checkpoints[id]; ok {
+			if signed != entryHash.String {
+				return result.fail(id, "row hash differs from its signed checkpoint (the chain was rewritten)"), nil
+			}
+			delete(checkpoints, id)
+		}
+		prev = entryHash.String
+		result.LastID = id
+		result.Checked++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Whatever is left points past the rows we saw: the end of the log was cut off
+	for logID := range checkpoints {
+		if result.BrokenAt == nil || logID < *result.BrokenAt {
+			result.fail(logID, fmt.Sprintf("checkpointed row %d is missing (rows were removed from the log)", logID))
+		}
+	}
+	return result, nil
+}
+
+// loadCheckpoints returns the signed hash per log row, failing result on a bad signature.
+func loadCheckpoints(db *sql.DB, public ed25519.PublicKey, result *Result) (map[int64]string, error) {
+	rows, err := db.Query("SELECT LogID, EntryHash, Signature FROM ActivityLogCheckpoints ORDER BY ID")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := make(map[int64]string)
+	for rows.Next() {
+		var logID int64
+		var entryHash, signature string
+		if err := rows.Scan(&logID, &entryHash, &signature); err != nil {
+			return nil, err
+		}
+		result.Checkpoints++
+
+		if public != nil {
+			sig, err := base64.StdEncoding.DecodeString(signature)
+			if err != nil || !ed25519.Verify(public, checkpointMessage(logID, entryHash), sig) {
+				result.fail(logID, "checkpoint signature is invalid")
+				return nil, nil
+			}
+		}
+		checkpoints[logID] = entryHash
+	}
+	return checkpoints, rows.Err()
+}
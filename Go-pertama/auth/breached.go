@@ -0,0 +1,32 @@
+package auth
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+// breached_passwords.txt holds commonly used and leaked passwords, one per line.
+//
+//go:embed breached_passwords.txt
+var breachedPasswordList string
+
+var (
+	breachedOnce sync.Once
+	breachedSet  map[string]struct{}
+)
+
+// IsBreachedPassword reports whether the password appears in the bundled list.
+// The comparison ignores case so trivial variants like "Password123" are caught too.
+func IsBreachedPassword(password string) bool {
+	breachedOnce.Do(func() {
+		breachedSet = make(map[string]struct{})
+		for _, line := range strings.Split(breachedPasswordList, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				breachedSet[strings.ToLower(line)] = struct{}{}
+			}
+		}
+	})
+	_, found := breachedSet[strings.ToLower(password)]
+	return found
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-pertama/config"
+	"go-pertama/models"
+)
+
+const (
+	SessionCookieName = "gp_session"
+	RefreshCookieName = "gp_refresh"
+	// CSRFCookieName is readable by the page, which echoes it in CSRFHeader
+	// on every state-changing request (double-submit cookie).
+	CSRFCookieName = "gp_csrf"
+	CSRFHeader     = "X-CSRF-Token"
+)
+
+// refreshCookiePath keeps the refresh token from being sent anywhere but the refresh endpoint.
+const refreshCookiePath = "/auth/refresh"
+
+// The single sign-on state cookie binds a login started in this browser to its
+// callback, so a callback URL from someone else's login is refused.
+const (
+	oidcStateCookieName   = "gp_oidc_state"
+	oidcStateCookiePath   = "/auth/oidc/callback"
+	oidcStateCookieMaxAge = 10 * time.Minute
+)
+
+// SessionCookies moves login tokens into HttpOnly cookies when
+// AUTH_SESSION_MODE is "cookie". In "bearer" mode it does nothing.
+type SessionCookies struct {
+	enabled       bool
+	domain        string
+	secure        bool
+	sameSite      http.SameSite
+	refreshExpiry time.Duration
+}
+
+func NewSessionCookies(cfg *config.Config) (*SessionCookies, error) {
+	c := &SessionCookies{
+		domain:        cfg.Auth.CookieDomain,
+		secure:        cfg.Auth.CookieSecure,
+		refreshExpiry: cfg.JWT.RefreshExpiry,
+	}
+
+	switch strings.ToLower(cfg.Auth.SessionMode) {
+	case "", "bearer":
+	case "cookie":
+		c.enabled = true
+	default:
+		return nil, fmt.Errorf("unknown AUTH_SESSION_MODE %q, expected bearer or cookie", cfg.Auth.SessionMode)
+	}
+
+	switch strings.ToLower(cfg.Auth.CookieSameSite) {
+	case "", "lax":
+		c.sameSite = http.SameSiteLaxMode
+	case "strict":
+		c.sameSite = http.SameSiteStrictMode
+	case "none":
+		if !c.secure {
+			return nil, fmt.Errorf("AUTH_COOKIE_SAMESITE=None requires AUTH_COOKIE_SECURE=true")
+		}
+		c.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("unknown AUTH_COOKIE_SAMESITE %q, expected Lax, Strict or None", cfg.Auth.CookieSameSite)
+	}
+	return c, nil
+}
+
+// Enabled reports whether browser sessions use cookies.
+func (c *SessionCookies) Enabled() bool {
+	return c.enabled
+}
+
+// Issue stores the tokens of a successful login in cookies, removes them from
+// resp and gives resp a fresh CSRF token for the page to send back.
+func (c *SessionCookies) Issue(w http.ResponseWriter, resp *models.LoginResponse) error {
+	csrfToken, err := NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	session := c.cookie(SessionCookieName, resp.Token, "/", true)
+	if resp.ExpiresAt != nil {
+		session.Expires = *resp.ExpiresAt
+	}
+	http.SetCookie(w, session)
+
+	refresh := c.cookie(RefreshCookieName, resp.RefreshToken, refreshCookiePath, true)
+	refresh.MaxAge = int(c.refreshExpiry.Seconds())
+	http.SetCookie(w, refresh)
+
+	csrf := c.cookie(CSRFCookieName, csrfToken, "/", false)
+	csrf.MaxAge = int(c.refreshExpiry.Seconds())
+	http.SetCookie(w, csrf)
+
+	resp.Token = ""
+	resp.RefreshToken = ""
+	resp.CSRFToken = csrfToken
+	return nil
+}
+
+// Clear removes the session cookies, e.g. on logout.
+func (c *SessionCookies) Clear(w http.ResponseWriter) {
+	for _, cookie := range []*http.Cookie{
+		c.cookie(SessionCookieName, "", "/", true),
+		c.cookie(RefreshCookieName, "", refreshCookiePath, true),
+		c.cookie(CSRFCookieName, "", "/", false),
+	} {
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+// SetOIDCState remembers the hash of a single sign-on state in the browser. It
+// is set in both session modes, and always SameSite=Lax so the provider's
+// redirect back to the callback carries it.
+func (c *SessionCookies) SetOIDCState(w http.ResponseWriter, state string) {
+	cookie := c.cookie(oidcStateCookieName, HashToken(state), oidcStateCookiePath, true)
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.MaxAge = int(oidcStateCookieMaxAge.Seconds())
+	http.SetCookie(w, cookie)
+}
+
+// CheckOIDCState reports whether state belongs to a login started in this browser.
+func (c *SessionCookies) CheckOIDCState(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil || cookie.Value == "" || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(HashToken(state))) == 1
+}
+
+// ClearOIDCState removes the state cookie once the callback has used it.
+func (c *SessionCookies) ClearOIDCState(w http.ResponseWriter) {
+	cookie := c.cookie(oidcStateCookieName, "", oidcStateCookiePath, true)
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+func (c *SessionCookies) cookie(name, value, path string, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.domain,
+		Secure:   c.secure,
+		HttpOnly: httpOnly,
+		SameSite: c.sameSite,
+	}
+}
+
+// AccessToken returns the access token from the session cookie, or "".
+func (c *SessionCookies) AccessToken(r *http.Request) string {
+	return c.value(r, SessionCookieName)
+}
+
+// RefreshToken returns the refresh token from its cookie, or "".
+func (c *SessionCookies) RefreshToken(r *http.Request) string {
+	return c.value(r, RefreshCookieName)
+}
+
+func (c *SessionCookies) value(r *http.Request, name string) string {
+	if !c.enabled {
+		return ""
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// CheckCSRF reports whether a cookie-authenticated request may proceed: safe
+// methods always may, others must echo the CSRF cookie in the X-CSRF-Token header.
+func (c *SessionCookies) CheckCSRF(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie := c.value(r, CSRFCookieName)
+	header := r.Header.Get(CSRFHeader)
+	return cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-pertama/config"
+	"go-pertama/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const legacyTokenPrefix = "sql-jwt-token-"
+
+var (
+	ErrTokenExpired       = errors.New("token expired")
+	ErrInvalidSignature   = errors.New("invalid token signature")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrLegacyTokenExpired = errors.New("legacy token format is no longer accepted")
+)
+
+// Claims is the payload carried by access tokens.
+type Claims struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+	Role  string `json:"role"`
+	// SessionID identifies the login (refresh token family) that issued the token.
+	SessionID string `json:"sid,omitempty"`
+	// Legacy is set when the claims were recovered from an old-format token.
+	Legacy bool `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the numeric user ID stored in the subject claim.
+func (c *Claims) UserID() int {
+	id, _ := strconv.Atoi(c.Subject)
+	return id
+}
+
+type TokenManager struct {
+	method           jwt.SigningMethod
+	signKey          interface{}
+	verifyKey        interface{}
+	issuer           string
+	expiry           time.Duration
+	legacySecret     string
+	legacyGraceUntil time.Time
+}
+
+// minHS256SecretLength is the shortest JWT_SECRET accepted, in bytes.
+const minHS256SecretLength = 32
+
+// placeholderJWTSecret was the built-in default; tokens signed with it can be forged by anyone.
+const placeholderJWTSecret = "default-secret-key-change-me"
+
+func NewTokenManager(cfg config.JWTConfig) (*TokenManager, error) {
+	m := &TokenManager{
+		issuer:           cfg.Issuer,
+		expiry:           cfg.ExpiryTime,
+		legacySecret:     cfg.LegacySecret,
+		legacyGraceUntil: cfg.LegacyGraceUntil,
+	}
+
+	switch strings.ToUpper(cfg.Algorithm) {
+	case "", "HS256":
+		if cfg.Secret == "" || cfg.Secret == placeholderJWTSecret {
+			return nil, errors.New("JWT_SECRET is required for HS256, generate one with: openssl rand -hex 32")
+		}
+		if len(cfg.Secret) < minHS256SecretLength {
+			return nil, fmt.Errorf("JWT_SECRET must be at least %d bytes long", minHS256SecretLength)
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = []byte(cfg.Secret)
+		m.verifyKey = []byte(cfg.Secret)
+	case "RS256":
+		privPEM, pubPEM, err := readKeyFiles(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if m.signKey, err = jwt.ParseRSAPrivateKeyFromPEM(privPEM); err != nil {
+			return nil, fmt.Errorf("parse RS256 private key: %w", err)
+		}
+		if m.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pubPEM); err != nil {
+			return nil, fmt.Errorf("parse RS256 public key: %w", err)
+		}
+		m.method = jwt.SigningMethodRS256
+	case "EDDSA":
+		privPEM, pubPEM, err := readKeyFiles(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if m.signKey, err = jwt.ParseEdPrivateKeyFromPEM(privPEM); err != nil {
+			return nil, fmt.Errorf("parse EdDSA private key: %w", err)
+		}
+		if m.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(pubPEM); err != nil {
+			return nil, fmt.Errorf("parse EdDSA public key: %w", err)
+		}
+		m.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	return m, nil
+}
+
+func readKeyFiles(cfg config.JWTConfig) ([]byte, []byte, error) {
+	if cfg.PrivateKeyFile == "" || cfg.PublicKeyFile == "" {
+		return nil, nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE and JWT_PUBLIC_KEY_FILE are required for %s", cfg.Algorithm)
+	}
+	privPEM, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubPEM, err := os.ReadFile(cfg.PublicKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return privPEM, pubPEM, nil
+}
+
+// Issue signs an access token for the given user and login session.
+func (m *TokenManager) Issue(user *models.User, sessionID string) (string, *Claims, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.expiry)),
+			ID:        jti,
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// Parse verifies a token and returns its claims. Old-format tokens are
+// accepted only until the configured grace period ends.
+func (m *TokenManager) Parse(tokenString string) (*Claims, error) {
+	if strings.HasPrefix(tokenString, legacyTokenPrefix) {
+		return m.parseLegacy(tokenString)
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+			return nil, ErrInvalidSignature
+		default:
+			return nil, ErrInvalidToken
+		}
+	}
+
+	if claims.UserID() == 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// parseLegacy handles the pre-JWT format: sql-jwt-token-{email}-secret-{secretPart}
+func (m *TokenManager) parseLegacy(tokenString string) (*Claims, error) {
+	if !time.Now().Before(m.legacyGraceUntil) {
+		return nil, ErrLegacyTokenExpired
+	}
+
+	payload := strings.TrimPrefix(tokenString, legacyTokenPrefix)
+	// Use LastIndex because the email may itself contain hyphens
+	suffixIdx := strings.LastIndex(payload, "-secret-")
+	if suffixIdx == -1 {
+		return nil, ErrInvalidToken
+	}
+	// Without a configured secret (RS256/EdDSA deployments) there is nothing to match
+	if m.legacySecret == "" || subtle.ConstantTimeCompare([]byte(payload[suffixIdx+len("-secret-"):]), []byte(m.legacySecret)) != 1 {
+		return nil, ErrInvalidSignature
+	}
+
+	return &Claims{Email: payload[:suffixIdx], Legacy: true}, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
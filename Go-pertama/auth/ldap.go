@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"go-pertama/config"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrLDAPInvalidCredentials = errors.New("invalid directory credentials")
+
+// LDAPEntry is what the directory knows about a user after a successful bind.
+type LDAPEntry struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+}
+
+// LDAPClient checks passwords by binding as the user. A new connection is
+// opened per login, so no service account is needed.
+type LDAPClient struct {
+	cfg config.LDAPConfig
+}
+
+func NewLDAPClient(cfg config.LDAPConfig) *LDAPClient {
+	return &LDAPClient{cfg: cfg}
+}
+
+// Authenticate binds with each DN template in turn and reads the user's entry
+// with their own credentials.
+func (c *LDAPClient) Authenticate(username, password string) (*LDAPEntry, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	boundDN := ""
+	for _, tmpl := range strings.Split(c.cfg.UserDNTemplates, ";") {
+		tmpl = strings.TrimSpace(tmpl)
+		if tmpl == "" {
+			continue
+		}
+		dn := strings.ReplaceAll(tmpl, "{username}", ldap.EscapeDN(username))
+		err := conn.Bind(dn, password)
+		if err == nil {
+			boundDN = dn
+			break
+		}
+		if !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, fmt.Errorf("ldap bind: %w", err)
+		}
+	}
+	if boundDN == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	return c.readEntry(conn, boundDN, username)
+}
+
+func (c *LDAPClient) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.cfg.InsecureSkipVerify}
+	if u := strings.TrimPrefix(strings.TrimPrefix(c.cfg.URL, "ldaps://"), "ldap://"); u != "" {
+		if host, _, err := net.SplitHostPort(u); err == nil {
+			tlsConfig.ServerName = host
+		}
+	}
+
+	conn, err := ldap.DialURL(c.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: c.cfg.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(c.cfg.Timeout)
+	if c.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *LDAPClient) readEntry(conn *ldap.Conn, boundDN, username string) (*LDAPEntry, error) {
+	attributes := []string{c.cfg.EmailAttribute, c.cfg.NameAttribute, c.cfg.GroupAttribute}
+	var req *ldap.SearchRequest
+	if c.cfg.BaseDN != "" && c.cfg.UserFilter != "" {
+		filter := strings.ReplaceAll(c.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+		req = ldap.NewSearchRequest(c.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false, filter, attributes, nil)
+	} else {
+		req = ldap.NewSearchRequest(boundDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false, "(objectClass=*)", attributes, nil)
+	}
+
+	result, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, fmt.Errorf("ldap search for %q returned %d entries", username, len(result.Entries))
+	}
+
+	// The email only ever comes from the directory: the login name is whatever
+	// the user typed, and Users rows are matched by email
+	e := result.Entries[0]
+	return &LDAPEntry{
+		DN:     e.DN,
+		Email:  e.GetAttributeValue(c.cfg.EmailAttribute),
+		Name:   e.GetAttributeValue(c.cfg.NameAttribute),
+		Groups: e.GetAttributeValues(c.cfg.GroupAttribute),
+	}, nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ErrNetworkDenied means the caller's address is outside the networks their
+// role or account is restricted to.
+var ErrNetworkDenied = errors.New("access from your network is not allowed")
+
+// ParseNetworks parses a comma, space or newline separated list of CIDR
+// ranges such as "10.0.0.0/8, 2001:db8::/32". A bare address stands for
+// itself.
+func ParseNetworks(list string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, field := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	}) {
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", field)
+			}
+			networks = append(networks, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", field)
+		}
+		addr = addr.Unmap()
+		networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return networks, nil
+}
+
+// NetworksContain reports whether ip is inside any of the networks.
+func NetworksContain(networks []netip.Prefix, ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-pertama/config"
+	"go-pertama/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrOIDCNonceMismatch = errors.New("id token nonce does not match the login request")
+
+// OIDCClient runs the authorization code flow with PKCE against one provider.
+// Discovery happens on first use and is retried until it succeeds, so the
+// server still starts while the provider is unreachable. Signing keys are
+// fetched from the provider's JWKS endpoint and cached by go-oidc, which
+// refetches them when a token arrives with an unknown key ID.
+type OIDCClient struct {
+	cfg        config.OIDCConfig
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCClient(cfg config.OIDCConfig) *OIDCClient {
+	return &OIDCClient{cfg: cfg, httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *OIDCClient) discover() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.verifier != nil {
+		return c.oauth2, c.verifier, nil
+	}
+
+	// The key set keeps using this context for later JWKS fetches, so it must not be request scoped
+	ctx := oidc.ClientContext(context.Background(), c.httpClient)
+	provider, err := oidc.NewProvider(ctx, c.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range strings.Fields(c.cfg.Scopes) {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	c.oauth2 = &oauth2.Config{
+		ClientID:     c.cfg.ClientID,
+		ClientSecret: c.cfg.ClientSecret,
+		RedirectURL:  c.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	c.verifier = provider.Verifier(&oidc.Config{ClientID: c.cfg.ClientID})
+	return c.oauth2, c.verifier, nil
+}
+
+// AuthCodeURL returns the provider URL the browser is sent to.
+func (c *OIDCClient) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	cfg, _, err := c.discover()
+	if err != nil {
+		return "", err
+	}
+	return cfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// Exchange redeems the authorization code and validates the returned ID token:
+// signature, issuer, audience, expiry and nonce.
+func (c *OIDCClient) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*models.OIDCClaims, error) {
+	cfg, verifier, err := c.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, c.httpClient)
+	token, err := cfg.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrOIDCNonceMismatch
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("oidc id token claims: %w", err)
+	}
+	result := &models.OIDCClaims{
+		Subject: idToken.Subject,
+		Groups:  stringList(claims[c.cfg.GroupsClaim]),
+	}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as the string "true"
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = v
+	case string:
+		result.EmailVerified = v == "true"
+	}
+	return result, nil
+}
+
+// stringList accepts a claim sent either as a JSON array or a single string.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
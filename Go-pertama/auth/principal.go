@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// Principal is the authenticated caller, placed in the request context by AuthMiddleware.
+type Principal struct {
+	UserID      int
+	Email       string
+	Name        string
+	Role        string
+	Permissions []string
+	SessionID   string
+	// MustChangePassword is set when the password expired; only a few routes stay reachable.
+	MustChangePassword bool
+	// APIKeyID and APIKeyName are set when a service account authenticated with an API key.
+	APIKeyID   int64
+	APIKeyName string
+	// ImpersonatorID, ImpersonatorEmail and ImpersonatorName identify the admin
+	// when the session was opened by impersonation; the other fields describe
+	// the impersonated user.
+	ImpersonatorID    int
+	ImpersonatorEmail string
+	ImpersonatorName  string
+}
+
+// Impersonating reports whether an admin is acting as this user.
+func (p *Principal) Impersonating() bool {
+	return p.ImpersonatorID != 0
+}
+
+// HasPermission reports whether the principal's role grants the permission code.
+func (p *Principal) HasPermission(code string) bool {
+	for _, granted := range p.Permissions {
+		if granted == code {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// PrincipalFrom returns the request's principal, or nil on unauthenticated routes.
+func PrincipalFrom(r *http.Request) *Principal {
+	p, _ := FromContext(r.Context())
+	return p
+}
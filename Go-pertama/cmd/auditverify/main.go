@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go-pertama/audit"
+	"go-pertama/config"
+	"log"
+	"os"
+
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+// Usage:
+//
+//	go run ./cmd/auditverify                    verify the activity log chain
+//	go run ./cmd/auditverify -pubkey audit.pub  verify with a key other than AUDIT_VERIFY_KEY_FILE
+//	go run ./cmd/auditverify -checkpoint        sign the newest row first (needs AUDIT_SIGNING_KEY_FILE)
+//
+// The exit status is 1 when the chain is broken.
+func main() {
+	appConfig, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+
+	pubKey := flag.String("pubkey", appConfig.Audit.VerifyKeyFile, "PEM public key to check checkpoint signatures with")
+	checkpoint := flag.Bool("checkpoint", false, "write a signed checkpoint before verifying")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	signingKeyFile := ""
+	if *checkpoint {
+		signingKeyFile = appConfig.Audit.SigningKeyFile
+		if signingKeyFile == "" {
+			log.Fatal("-checkpoint needs AUDIT_SIGNING_KEY_FILE")
+		}
+	}
+	keys, err := audit.LoadKeys(signingKeyFile, *pubKey)
+	if err != nil {
+		log.Fatal("Error loading audit keys: ", err)
+	}
+
+	dsn := fmt.Sprintf("server=%s;user id=%s;password=%s;database=%s",
+		appConfig.Database.Host,
+		appConfig.Database.User,
+		appConfig.Database.Password,
+		appConfig.Database.DBName,
+	)
+	if appConfig.Database.Port != "" {
+		dsn += fmt.Sprintf(";port=%s", appConfig.Database.Port)
+	}
+
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		log.Fatal("Could not connect to database: ", err)
+	}
+	defer db.Close()
+
+	if *checkpoint {
+		written, err := audit.Checkpoint(db, keys.Private)
+		if err != nil {
+			log.Fatal("Failed to write checkpoint: ", err)
+		}
+		if written {
+			log.Println("Checkpoint written.")
+		} else {
+			log.Println("Newest row is already checkpointed.")
+		}
+	}
+
+	result, err := audit.Verify(db, keys.Public)
+	if err != nil {
+		log.Fatal("Failed to read activity logs: ", err)
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(result)
+	} else {
+		printResult(result)
+	}
+	if !result.Valid {
+		os.Exit(1)
+	}
+}
+
+func printResult(r *audit.Result) {
+	if r.UnchainedRows > 0 {
+		fmt.Printf("%d rows predate the hash chain and were not checked.\n", r.UnchainedRows)
+	}
+	if r.SignaturesChecked {
+		fmt.Printf("%d checkpoints, signatures checked.\n", r.Checkpoints)
+	} else {
+		fmt.Printf("%d checkpoints, signatures NOT checked (no verify key).\n", r.Checkpoints)
+	}
+
+	if !r.Valid {
+		fmt.Printf("BROKEN at row %d: %s\n", *r.BrokenAt, r.Reason)
+		if r.Checked > 0 {
+			fmt.Printf("Rows %d to %d (%d rows) check out.\n", r.FirstID, r.LastID, r.Checked)
+		}
+		return
+	}
+	if r.Checked == 0 {
+		fmt.Println("OK: no chained rows yet.")
+		return
+	}
+	fmt.Printf("OK: rows %d to %d (%d rows) are intact.\n", r.FirstID, r.LastID, r.Checked)
+}
@@ -5,12 +5,17 @@ import (
 	"go-pertama/config"
 	"go-pertama/models"
 	"log"
+	"os"
 	"time"
 
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 )
 
+// Usage:
+//
+//	go run ./cmd/migrate                      schema migration for roles
+//	go run ./cmd/migrate passwords [flags]    clean up plain-text passwords (see -h)
 func main() {
 	log.Println("Starting manual migration...")
 
@@ -37,9 +42,19 @@ func main() {
 
 	log.Println("Connected to database successfully.")
 
+	if len(os.Args) > 1 && os.Args[1] == "passwords" {
+		migratePasswords(db, appConfig.Auth.BcryptCost, os.Args[2:])
+		return
+	}
+
+	migrateSchema(db)
+}
+
+// migrateSchema creates the Roles table and links Users to it.
+func migrateSchema(db *gorm.DB) {
 	// 1. Migrate Roles table (Create if not exists)
 	log.Println("Migrating Roles table...")
-	err = db.AutoMigrate(&models.Role{})
+	err := db.AutoMigrate(&models.Role{})
 	if err != nil {
 		log.Fatal("Failed to migrate Roles table: ", err)
 	}
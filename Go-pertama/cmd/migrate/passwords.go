@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-pertama/audit"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type legacyPassword struct {
+	ID       int
+	Email    string
+	Password string
+}
+
+// migratePasswords finds every Users.Password that is not a bcrypt hash and either
+// hashes it now and forces a change at next login (expire), or gives the user
+// until a deadline to log in once so it can be rehashed transparently (rehash).
+// Empty or NULL passwords are replaced by an unusable hash in either mode.
+func migratePasswords(db *gorm.DB, cost int, args []string) {
+	fs := flag.NewFlagSet("passwords", flag.ExitOnError)
+	mode := fs.String("mode", "expire", "expire: hash now and require a password change at next login; rehash: allow plain-text login until -deadline")
+	deadline := fs.String("deadline", "", "deadline for -mode=rehash, as YYYY-MM-DD or RFC3339")
+	dryRun := fs.Bool("dry-run", false, "list affected users without changing anything")
+	fs.Parse(args)
+
+	var until time.Time
+	switch *mode {
+	case "expire":
+	case "rehash":
+		var err error
+		if until, err = parseDeadline(*deadline); err != nil {
+			log.Fatalf("Invalid -deadline: %v", err)
+		}
+		if !until.After(time.Now()) {
+			log.Fatal("-deadline must be in the future")
+		}
+	default:
+		log.Fatalf("Unknown -mode %q, expected expire or rehash", *mode)
+	}
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	// The server adds these on start-up, but the command may run before it ever has
+	for _, q := range []string{
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'MustChangePassword' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD MustChangePassword BIT DEFAULT 0 WITH VALUES;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'PlaintextRehashBefore' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD PlaintextRehashBefore DATETIME NULL;`,
+	} {
+		if err := db.Exec(q).Error; err != nil {
+			log.Fatalf("Failed to prepare Users table: %v", err)
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to get database handle: %v", err)
+	}
+
+	var users []legacyPassword
+	if err := db.Raw("SELECT ID, Email, COALESCE(Password, '') AS Password FROM Users").Scan(&users).Error; err != nil {
+		log.Fatalf("Failed to read users: %v", err)
+	}
+
+	var legacy []legacyPassword
+	for _, u := range users {
+		if _, err := bcrypt.Cost([]byte(u.Password)); err != nil {
+			legacy = append(legacy, u)
+		}
+	}
+	log.Printf("Found %d of %d users with a non-bcrypt password.", len(legacy), len(users))
+
+	for _, u := range legacy {
+		if *dryRun {
+			log.Printf("[dry-run] %s (ID %d)", u.Email, u.ID)
+			continue
+		}
+
+		var details string
+		var err error
+		if u.Password == "" {
+			// Hashing "" would make the empty password valid, so lock the
+			// account behind a random one until the user resets it
+			var hashed []byte
+			hashed, err = unusablePassword(cost)
+			if err == nil {
+				err = db.Exec("UPDATE Users SET Password = ?, MustChangePassword = 1, PlaintextRehashBefore = NULL WHERE ID = ?", string(hashed), u.ID).Error
+			}
+			details = "No password was set, a password reset is required"
+		} else if *mode == "expire" {
+			var hashed []byte
+			hashed, err = bcrypt.GenerateFromPassword([]byte(u.Password), cost)
+			if err == nil {
+				err = db.Exec("UPDATE Users SET Password = ?, MustChangePassword = 1, PlaintextRehashBefore = NULL WHERE ID = ?", string(hashed), u.ID).Error
+			}
+			details = "Plain-text password hashed, change required at next login"
+		} else {
+			err = db.Exec("UPDATE Users SET PlaintextRehashBefore = ? WHERE ID = ?", until, u.ID).Error
+			details = fmt.Sprintf("Plain-text password will be rehashed at next login before %s", until.Format(time.RFC3339))
+		}
+		if err != nil {
+			log.Printf("Failed to migrate %s: %v", u.Email, err)
+			continue
+		}
+
+		if err := audit.Append(sqlDB, audit.Entry{UserID: u.ID, Action: "PASSWORD_MIGRATION", Details: details}); err != nil {
+			log.Printf("Failed to log migration of %s: %v", u.Email, err)
+		}
+		log.Printf("Migrated %s (ID %d)", u.Email, u.ID)
+	}
+
+	if *mode == "rehash" && !*dryRun && len(legacy) > 0 {
+		log.Printf("Set AUTH_ALLOW_PLAINTEXT_PASSWORDS=true until %s. Users who do not log in by then must reset their password, or run this command again with -mode=expire.", until.Format(time.RFC3339))
+	}
+}
+
+// unusablePassword hashes random bytes nobody knows.
+func unusablePassword(cost int) ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(b)), cost)
+}
+
+func parseDeadline(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("required")
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
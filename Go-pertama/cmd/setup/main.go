@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"go-pertama/config"
 	"log"
 
 	_ "github.com/microsoft/go-mssqldb"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -111,16 +114,37 @@ func main() {
 	}
 	fmt.Println("Table 'ActivityLogs' ensured.")
 
-	// Insert Admin User (Seed)
-	insertUserQuery := `
-		IF NOT EXISTS (SELECT 1 FROM Users WHERE Email = 'admin')
-		BEGIN
-			INSERT INTO Users (Email, Password) VALUES ('admin', 'admin');
-		END
-	`
-	_, err = dbApp.ExecContext(ctx, insertUserQuery)
+	// Insert Admin User (Seed) with a random password, hashed like every other password
+	var adminExists int
+	err = dbApp.QueryRowContext(ctx, "SELECT COUNT(1) FROM Users WHERE Email = 'admin@example.com'").Scan(&adminExists)
+	if err != nil {
+		log.Fatal("Error checking admin user: ", err.Error())
+	}
+	if adminExists > 0 {
+		fmt.Println("Admin user ensured.")
+		return
+	}
+
+	adminPassword, err := randomPassword()
+	if err != nil {
+		log.Fatal("Error generating admin password: ", err.Error())
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(adminPassword), appConfig.Auth.BcryptCost)
+	if err != nil {
+		log.Fatal("Error hashing admin password: ", err.Error())
+	}
+	_, err = dbApp.ExecContext(ctx, "INSERT INTO Users (Email, Password) VALUES ('admin@example.com', @p1)", string(hashed))
 	if err != nil {
 		log.Fatal("Error seeding admin user: ", err.Error())
 	}
-	fmt.Println("Admin user ensured.")
+	fmt.Println("Admin user created: admin@example.com")
+	fmt.Printf("Initial password (shown only once): %s\n", adminPassword)
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
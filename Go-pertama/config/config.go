@@ -13,13 +13,26 @@ type Config struct {
 	App      AppConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Auth     AuthConfig
+	OIDC     OIDCConfig
+	LDAP     LDAPConfig
 	CORS     CORSConfig
+	Mail     MailConfig
+	Audit    AuditConfig
+	Security SecurityConfig
+	Captcha  CaptchaConfig
 }
 
 type AppConfig struct {
+	Name    string // shown in authenticator apps
 	Env     string
 	Port    string
 	Timeout time.Duration
+	// PublicURL is the address users open in the browser, used to build links in emails.
+	PublicURL string
+	// TrustedProxies is a comma separated list of CIDR ranges whose
+	// X-Forwarded-For header is believed. Empty ignores the header.
+	TrustedProxies string
 }
 
 type DatabaseConfig struct {
@@ -32,14 +45,125 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	ExpiryTime time.Duration
+	Secret         string
+	ExpiryTime     time.Duration
+	RefreshExpiry  time.Duration
+	Algorithm      string // HS256, RS256 or EdDSA
+	Issuer         string
+	PrivateKeyFile string // PEM key used to sign RS256/EdDSA tokens
+	PublicKeyFile  string // PEM key used to verify RS256/EdDSA tokens
+	// LegacyGraceUntil is the moment after which old "sql-jwt-token-" tokens
+	// are rejected. Zero means they are rejected immediately.
+	LegacyGraceUntil time.Time
+	// LegacySecret is the secret the old tokens were issued with. Empty
+	// rejects them regardless of LegacyGraceUntil.
+	LegacySecret string
+}
+
+type AuthConfig struct {
+	// AllowPlaintextPasswords accepts legacy clear-text values in Users.Password
+	// (and rehashes them) until each user's rehash deadline. Off by default.
+	AllowPlaintextPasswords bool
+	// BcryptCost is used for new hashes; older hashes are upgraded on the next login.
+	BcryptCost int
+	// Providers lists the password login backends in the order they are tried, e.g. "local,ldap".
+	Providers string
+	// SessionMode is "bearer" (tokens in the JSON response) or "cookie" (HttpOnly
+	// cookies with a CSRF token, so scripts in the page never see the tokens).
+	SessionMode    string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string // Lax, Strict or None
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider next to local passwords.
+type OIDCConfig struct {
+	Enabled      bool
+	ProviderName string // stored on linked identities and shown on the login page
+	IssuerURL    string // discovery is read from IssuerURL + "/.well-known/openid-configuration"
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // must point at /auth/oidc/callback and be registered with the provider
+	Scopes       string // space separated, "openid" is always included
+	GroupsClaim  string
+	// RoleMapping maps IdP groups to roles as "group=role,group=role". The first
+	// listed group the user belongs to wins.
+	RoleMapping   string
+	DefaultRole   string // role for provisioned users without a mapped group
+	AutoProvision bool   // create a Users row on first login when no account has the email
+	// TrustEmail treats the email claim as verified for providers that never send email_verified.
+	TrustEmail bool
+}
+
+// LDAPConfig authenticates password logins with a bind against LDAP or Active Directory.
+type LDAPConfig struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	// UserDNTemplates are tried in order, separated by ";". {username} is replaced
+	// with the login name, e.g. "uid={username},ou=people,dc=example,dc=com" or
+	// "{username}@corp.example.com" for Active Directory.
+	UserDNTemplates string
+	// BaseDN and UserFilter locate the user's entry after binding. Without them
+	// the bound DN itself is read, which needs a DN template (not a UPN).
+	BaseDN         string
+	UserFilter     string
+	EmailAttribute string
+	NameAttribute  string
+	GroupAttribute string
+	// RoleMapping maps groups to roles as "group=role;group=role". Groups match
+	// by full DN or by CN, first listed match wins.
+	RoleMapping   string
+	DefaultRole   string
+	AutoProvision bool
+}
+
+// AuditConfig holds the Ed25519 keys for signed activity log checkpoints.
+type AuditConfig struct {
+	SigningKeyFile     string // PKCS#8 PEM; empty disables checkpoints
+	VerifyKeyFile      string // PKIX PEM; derived from the signing key when empty
+	CheckpointInterval time.Duration
+}
+
+// SecurityConfig configures suspicious-login detection.
+type SecurityConfig struct {
+	GeoIPDatabase string // MaxMind .mmdb file; empty disables country and travel checks
+	// WebhookURL receives a JSON POST for every flagged login, signed with
+	// WebhookSecret in X-Signature when a secret is set.
+	WebhookURL    string
+	WebhookSecret string
+}
+
+// CaptchaConfig configures the CAPTCHA checked on self-registration. Any
+// provider with a siteverify endpoint works (reCAPTCHA, hCaptcha, Turnstile).
+type CaptchaConfig struct {
+	VerifyURL string // empty disables the check
+	SiteKey   string // handed to the frontend to render the widget
+	Secret    string
+}
+
+type MailConfig struct {
+	Driver    string // smtp or log
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	From      string
+	OutputDir string // log driver writes .eml files here; empty logs to stdout
 }
 
 type CORSConfig struct {
+	// AllowedOrigins is a comma separated list of exact origins, wildcard
+	// subdomains such as "https://*.example.com", or "*" for any origin.
 	AllowedOrigins string
 	AllowedMethods string
 	AllowedHeaders string
+	// ExposedHeaders are response headers the browser lets scripts read.
+	ExposedHeaders string
+	// AllowCredentials lets browsers send cookies; it is ignored for "*".
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache a preflight response
 }
 
 func LoadConfig() (*Config, error) {
@@ -50,9 +174,12 @@ func LoadConfig() (*Config, error) {
 
 	config := &Config{
 		App: AppConfig{
-			Env:     getEnv("APP_ENV", "development"),
-			Port:    getEnv("APP_PORT", "8080"),
-			Timeout: getDurationEnv("APP_TIMEOUT_SECONDS", 30) * time.Second,
+			Name:           getEnv("APP_NAME", "Go Pertama"),
+			Env:            getEnv("APP_ENV", "development"),
+			Port:           getEnv("APP_PORT", "8080"),
+			Timeout:        getDurationEnv("APP_TIMEOUT_SECONDS", 30) * time.Second,
+			PublicURL:      getEnv("APP_PUBLIC_URL", "http://localhost:8081"),
+			TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost\\MSSQLSERVER2022"),
@@ -63,13 +190,85 @@ func LoadConfig() (*Config, error) {
 			Timeout:  getDurationEnv("DB_TIMEOUT_SECONDS", 10) * time.Second,
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "default-secret-key-change-me"),
-			ExpiryTime: getDurationEnv("JWT_EXPIRY_MINUTES", 60) * time.Minute,
+			Secret:           getEnv("JWT_SECRET", ""),
+			ExpiryTime:       getDurationEnv("JWT_EXPIRY_MINUTES", 60) * time.Minute,
+			RefreshExpiry:    getDurationEnv("JWT_REFRESH_EXPIRY_HOURS", 168) * time.Hour,
+			Algorithm:        getEnv("JWT_ALGORITHM", "HS256"),
+			Issuer:           getEnv("JWT_ISSUER", "go-pertama"),
+			PrivateKeyFile:   getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			PublicKeyFile:    getEnv("JWT_PUBLIC_KEY_FILE", ""),
+			LegacyGraceUntil: getTimeEnv("JWT_LEGACY_GRACE_UNTIL"),
+			LegacySecret:     getEnv("JWT_LEGACY_SECRET", ""),
+		},
+		Auth: AuthConfig{
+			AllowPlaintextPasswords: getBoolEnv("AUTH_ALLOW_PLAINTEXT_PASSWORDS", false),
+			BcryptCost:              getIntEnv("BCRYPT_COST", 10),
+			Providers:               getEnv("AUTH_PROVIDERS", "local"),
+			SessionMode:             getEnv("AUTH_SESSION_MODE", "bearer"),
+			CookieDomain:            getEnv("AUTH_COOKIE_DOMAIN", ""),
+			CookieSecure:            getBoolEnv("AUTH_COOKIE_SECURE", true),
+			CookieSameSite:          getEnv("AUTH_COOKIE_SAMESITE", "Lax"),
+		},
+		OIDC: OIDCConfig{
+			Enabled:       getBoolEnv("OIDC_ENABLED", false),
+			ProviderName:  getEnv("OIDC_PROVIDER_NAME", "SSO"),
+			IssuerURL:     getEnv("OIDC_ISSUER_URL", ""),
+			ClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   getEnv("OIDC_REDIRECT_URL", "http://localhost:8081/auth/oidc/callback"),
+			Scopes:        getEnv("OIDC_SCOPES", "openid email profile"),
+			GroupsClaim:   getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			RoleMapping:   getEnv("OIDC_ROLE_MAPPING", ""),
+			DefaultRole:   getEnv("OIDC_DEFAULT_ROLE", "user"),
+			AutoProvision: getBoolEnv("OIDC_AUTO_PROVISION", true),
+			TrustEmail:    getBoolEnv("OIDC_TRUST_EMAIL", false),
+		},
+		LDAP: LDAPConfig{
+			URL:                getEnv("LDAP_URL", ""),
+			StartTLS:           getBoolEnv("LDAP_START_TLS", false),
+			InsecureSkipVerify: getBoolEnv("LDAP_INSECURE_SKIP_VERIFY", false),
+			Timeout:            getDurationEnv("LDAP_TIMEOUT_SECONDS", 10) * time.Second,
+			UserDNTemplates:    getEnv("LDAP_USER_DN_TEMPLATES", ""),
+			BaseDN:             getEnv("LDAP_BASE_DN", ""),
+			UserFilter:         getEnv("LDAP_USER_FILTER", "(|(uid={username})(sAMAccountName={username})(userPrincipalName={username}))"),
+			EmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			NameAttribute:      getEnv("LDAP_NAME_ATTRIBUTE", "displayName"),
+			GroupAttribute:     getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			RoleMapping:        getEnv("LDAP_ROLE_MAPPING", ""),
+			DefaultRole:        getEnv("LDAP_DEFAULT_ROLE", "user"),
+			AutoProvision:      getBoolEnv("LDAP_AUTO_PROVISION", true),
+		},
+		Mail: MailConfig{
+			Driver:    getEnv("MAIL_DRIVER", "log"),
+			Host:      getEnv("SMTP_HOST", "localhost"),
+			Port:      getEnv("SMTP_PORT", "1025"),
+			Username:  getEnv("SMTP_USERNAME", ""),
+			Password:  getEnv("SMTP_PASSWORD", ""),
+			From:      getEnv("MAIL_FROM", "no-reply@go-pertama.local"),
+			OutputDir: getEnv("MAIL_OUTPUT_DIR", ""),
+		},
+		Audit: AuditConfig{
+			SigningKeyFile:     getEnv("AUDIT_SIGNING_KEY_FILE", ""),
+			VerifyKeyFile:      getEnv("AUDIT_VERIFY_KEY_FILE", ""),
+			CheckpointInterval: getDurationEnv("AUDIT_CHECKPOINT_MINUTES", 60) * time.Minute,
+		},
+		Security: SecurityConfig{
+			GeoIPDatabase: getEnv("GEOIP_DATABASE_FILE", ""),
+			WebhookURL:    getEnv("SECURITY_WEBHOOK_URL", ""),
+			WebhookSecret: getEnv("SECURITY_WEBHOOK_SECRET", ""),
+		},
+		Captcha: CaptchaConfig{
+			VerifyURL: getEnv("CAPTCHA_VERIFY_URL", ""),
+			SiteKey:   getEnv("CAPTCHA_SITE_KEY", ""),
+			Secret:    getEnv("CAPTCHA_SECRET", ""),
 		},
 		CORS: CORSConfig{
-			AllowedOrigins: getEnv("CORS_ALLOWED_ORIGINS", "*"),
-			AllowedMethods: getEnv("CORS_ALLOWED_METHODS", "POST, GET, OPTIONS, PUT, DELETE"),
-			AllowedHeaders: getEnv("CORS_ALLOWED_HEADERS", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization"),
+			AllowedOrigins:   getEnv("CORS_ALLOWED_ORIGINS", "*"),
+			AllowedMethods:   getEnv("CORS_ALLOWED_METHODS", "POST, GET, OPTIONS, PUT, DELETE"),
+			AllowedHeaders:   getEnv("CORS_ALLOWED_HEADERS", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Cache-Control, X-Requested-With"),
+			ExposedHeaders:   getEnv("CORS_EXPOSED_HEADERS", "Content-Disposition, Retry-After, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset"),
+			AllowCredentials: getBoolEnv("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           getDurationEnv("CORS_MAX_AGE_SECONDS", 600) * time.Second,
 		},
 	}
 
@@ -93,3 +292,31 @@ func getDurationEnv(key string, fallback int) time.Duration {
 	}
 	return time.Duration(fallback)
 }
+
+func getIntEnv(key string, fallback int) int {
+	if value, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getBoolEnv(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(getEnv(key, "")); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getTimeEnv parses an RFC3339 timestamp, returning the zero time when unset or invalid.
+func getTimeEnv(key string) time.Time {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return time.Time{}
+	}
+	value, err := time.Parse(time.RFC3339, strValue)
+	if err != nil {
+		log.Printf("Warning: invalid %s value %q, expected RFC3339", key, strValue)
+		return time.Time{}
+	}
+	return value
+}
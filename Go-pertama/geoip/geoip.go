@@ -0,0 +1,83 @@
+// Package geoip finds the country and rough position of an address in an
+// offline MaxMind database (GeoLite2-Country or GeoLite2-City .mmdb file), so
+// no address ever leaves the server.
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is what the database knows about an address. Country databases
+// have no coordinates, so Latitude and Longitude may be nil.
+type Location struct {
+	Country   string // ISO 3166-1 alpha-2
+	Latitude  *float64
+	Longitude *float64
+}
+
+// Reader looks up addresses. A nil *Reader is valid and knows nothing.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// Open loads the database at path. An empty path returns a nil Reader.
+func Open(path string) (*Reader, error) {
+	if path == "" {
+		return nil, nil
+	}
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Lookup returns the location of ip, or nil when it is unknown, private or
+// not an address.
+func (r *Reader) Lookup(ip string) *Location {
+	if r == nil {
+		return nil
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		RegisteredCountry struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+		Location struct {
+			Latitude  *float64 `maxminddb:"latitude"`
+			Longitude *float64 `maxminddb:"longitude"`
+		} `maxminddb:"location"`
+	}
+	if err := r.db.Lookup(addr, &record); err != nil {
+		return nil
+	}
+
+	loc := &Location{
+		Country:   record.Country.ISOCode,
+		Latitude:  record.Location.Latitude,
+		Longitude: record.Location.Longitude,
+	}
+	if loc.Country == "" {
+		loc.Country = record.RegisteredCountry.ISOCode
+	}
+	if loc.Country == "" && loc.Latitude == nil {
+		return nil
+	}
+	return loc
+}
+
+func (r *Reader) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.db.Close()
+}
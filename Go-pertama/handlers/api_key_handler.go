@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/services"
+)
+
+type APIKeyHandler struct {
+	service services.APIKeyService
+}
+
+func NewAPIKeyHandler(service services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// GetAPIKeys lists keys, optionally only those of ?userId=.
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userId"))
+
+	keys, err := h.service.List(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": keys})
+}
+
+func (h *APIKeyHandler) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.service.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.service.Create(req, auth.PrincipalFrom(r))
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *APIKeyHandler) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.service.Update(id, req, auth.PrincipalFrom(r))
+	if err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
+
+// RevokeAPIKey disables a key for good. The row is kept for the audit trail.
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiKeyID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Revoke(id, auth.PrincipalFrom(r)); err != nil {
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiKeyID reads the {id} from /api/api-keys/{id}.
+func apiKeyID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/api-keys/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func writeAPIKeyError(w http.ResponseWriter, err error) {
+	statusCode := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		statusCode = http.StatusNotFound
+	case err.Error() == "user not found":
+		statusCode = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), statusCode)
+}
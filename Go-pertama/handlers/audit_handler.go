@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-pertama/services"
+	"net/http"
+)
+
+type AuditHandler struct {
+	auditService services.AuditService
+}
+
+func NewAuditHandler(auditService services.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// VerifyActivityLogs walks the activity log hash chain and reports the first broken link.
+func (h *AuditHandler) VerifyActivityLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := h.auditService.VerifyActivityLogs()
+	if err != nil {
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
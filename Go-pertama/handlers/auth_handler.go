@@ -2,18 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/services"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 )
 
 type AuthHandler struct {
 	authService services.AuthService
+	cookies     *auth.SessionCookies
 }
 
-func NewAuthHandler(authService services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService services.AuthService, cookies *auth.SessionCookies) *AuthHandler {
+	return &AuthHandler{authService: authService, cookies: cookies}
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -31,15 +38,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 
-	resp, err := h.authService.Login(creds)
+	resp, err := h.authService.Login(creds, clientInfo(r))
 	if err != nil {
 		fmt.Printf("Login failed: %v\n", err)
-		statusCode := http.StatusUnauthorized
-		if err.Error() == "database connection error" {
-			statusCode = http.StatusInternalServerError
+
+		if writeAccountLockedError(w, err) {
+			return
 		}
 
-		w.WriteHeader(statusCode)
+		w.WriteHeader(loginErrorStatus(err))
 		json.NewEncoder(w).Encode(models.LoginResponse{
 			Message: err.Error(),
 			Success: false,
@@ -47,7 +54,75 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	json.NewEncoder(w).Encode(resp)
+	h.writeSession(w, resp)
+}
+
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, err := h.authService.VerifyMFA(req, clientInfo(r))
+	if err != nil {
+		if writeAccountLockedError(w, err) {
+			return
+		}
+		w.WriteHeader(loginErrorStatus(err))
+		json.NewEncoder(w).Encode(models.LoginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+		return
+	}
+
+	h.writeSession(w, resp)
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !(errors.Is(err, io.EOF) && h.cookies.Enabled()) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" && h.cookies.Enabled() {
+		if !h.cookies.CheckCSRF(r) {
+			http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+			return
+		}
+		req.RefreshToken = h.cookies.RefreshToken(r)
+	}
+	if req.RefreshToken == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, err := h.authService.Refresh(req.RefreshToken, clientInfo(r))
+	if err != nil {
+		w.WriteHeader(loginErrorStatus(err))
+		json.NewEncoder(w).Encode(models.LoginResponse{
+			Message: err.Error(),
+			Success: false,
+		})
+		return
+	}
+
+	h.writeSession(w, resp)
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
@@ -56,8 +131,11 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Header.Get("X-User-Email")
-	h.authService.Logout(email)
+	principal := auth.PrincipalFrom(r)
+	h.authService.Logout(principal.Email, principal.SessionID)
+	if h.cookies.Enabled() {
+		h.cookies.Clear(w)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Logout successful"})
@@ -69,7 +147,7 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Header.Get("X-User-Email")
+	email := auth.PrincipalFrom(r).Email
 
 	var req models.ChangePasswordRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -79,6 +157,9 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	err := h.authService.ChangePassword(email, req)
 	if err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
 		statusCode := http.StatusInternalServerError
 		if err.Error() == "incorrect old password" || err.Error() == "user not found" {
 			statusCode = http.StatusUnauthorized
@@ -90,3 +171,74 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Password updated successfully"})
 }
+
+// loginErrorStatus maps a failed login, MFA step or refresh to its status code.
+// writeAccountLockedError answers 423 with Retry-After if err is an AccountLockedError.
+func writeAccountLockedError(w http.ResponseWriter, err error) bool {
+	var locked *services.AccountLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	retryAfter := int(math.Ceil(locked.RetryAfter().Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusLocked)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Account is locked due to too many failed login attempts",
+		"success":     false,
+		"lockedUntil": locked.Until,
+		"retryAfter":  retryAfter,
+	})
+	return true
+}
+
+func loginErrorStatus(err error) int {
+	switch {
+	case err.Error() == "database connection error" || err.Error() == "failed to generate token":
+		return http.StatusInternalServerError
+	case errors.Is(err, auth.ErrNetworkDenied):
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// writeSession sends a successful login. In cookie session mode the tokens are
+// set as HttpOnly cookies and only the CSRF token is left in the body.
+func (h *AuthHandler) writeSession(w http.ResponseWriter, resp *models.LoginResponse) {
+	if h.cookies.Enabled() && resp.Token != "" {
+		if err := h.cookies.Issue(w, resp); err != nil {
+			http.Error(w, "Failed to start session", http.StatusInternalServerError)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// clientInfo extracts the caller's address and user agent from the request.
+func clientInfo(r *http.Request) models.ClientInfo {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	return models.ClientInfo{
+		IPAddress: ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// writePasswordPolicyError responds with 422 and every failed rule when err is a
+// password policy violation. It reports whether it wrote a response.
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+	var policyErr *services.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    policyErr.Error(),
+		"success":    false,
+		"violations": policyErr.Violations,
+	})
+	return true
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/services"
 	"net/http"
@@ -87,11 +88,7 @@ func (h *ConfigHandler) CreateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Mock getting user from token/context
-	// In real app, extract from JWT
-	createdBy := "admin@example.com"
-
-	if err := h.Service.CreateConfig(&config, createdBy); err != nil {
+	if err := h.Service.CreateConfig(&config, auth.PrincipalFrom(r)); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -121,15 +118,13 @@ func (h *ConfigHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Mock user and reason
-	updatedBy := "admin@example.com"
-	ip := r.RemoteAddr
+	ip := clientInfo(r).IPAddress
 	reason := r.Header.Get("X-Change-Reason")
 	if reason == "" {
 		reason = "Updated via API"
 	}
 
-	if err := h.Service.UpdateConfig(id, &updateData, updatedBy, ip, reason); err != nil {
+	if err := h.Service.UpdateConfig(id, &updateData, auth.PrincipalFrom(r), ip, reason); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-pertama/auth"
+	"go-pertama/services"
+)
+
+type ImpersonationHandler struct {
+	service services.ImpersonationService
+}
+
+func NewImpersonationHandler(service services.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{service: service}
+}
+
+// Start handles POST /api/users/{id}/impersonate. The response carries a bearer
+// token for the user even in cookie session mode, so the admin's own session
+// is left untouched and can be resumed when the impersonation ends.
+func (h *ImpersonationHandler) Start(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/impersonate")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.service.Start(id, auth.PrincipalFrom(r), clientInfo(r))
+	if err != nil {
+		statusCode := http.StatusForbidden
+		switch {
+		case err.Error() == "user not found":
+			statusCode = http.StatusNotFound
+		case err.Error() == "database connection error" || err.Error() == "failed to generate token":
+			statusCode = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// End handles POST /api/impersonation/end, called with the impersonation token.
+func (h *ImpersonationHandler) End(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := h.service.End(auth.PrincipalFrom(r)); err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, services.ErrNotImpersonating) {
+			statusCode = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Impersonation ended"})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/services"
+)
+
+type InvitationHandler struct {
+	service services.InvitationService
+}
+
+func NewInvitationHandler(service services.InvitationService) *InvitationHandler {
+	return &InvitationHandler{service: service}
+}
+
+// GetInvitations handles GET /api/invitations?status=&search=&page=&limit=.
+func (h *InvitationHandler) GetInvitations(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	resp, err := h.service.List(r.URL.Query().Get("status"), r.URL.Query().Get("search"), page, limit)
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CreateInvitation handles POST /api/invitations.
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.RoleID == 0 {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.service.Create(req, auth.PrincipalFrom(r))
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+// InvitationAction handles POST /api/invitations/{id}/resend and /api/invitations/{id}/revoke.
+func (h *InvitationHandler) InvitationAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/invitations/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "resend":
+		invitation, err := h.service.Resend(id, auth.PrincipalFrom(r))
+		if err != nil {
+			writeInvitationError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invitation)
+	case "revoke":
+		if err := h.service.Revoke(id, auth.PrincipalFrom(r)); err != nil {
+			writeInvitationError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// GetInvitation handles GET /auth/invitation?token= for the accept page.
+func (h *InvitationHandler) GetInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	invitation, err := h.service.Lookup(r.URL.Query().Get("token"))
+	if err != nil {
+		writeInvitationError(w, err)
+		return
+	}
+
+	// Only what the invitee needs to see; the rest is for admins
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"email":     invitation.Email,
+		"name":      invitation.Name,
+		"roleName":  invitation.RoleName,
+		"invitedBy": invitation.InvitedBy,
+		"expiresAt": invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation handles POST /auth/invitation/accept.
+func (h *InvitationHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Accept(req, clientInfo(r)); err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
+		writeInvitationError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Your account has been created. You can now log in."})
+}
+
+func writeInvitationError(w http.ResponseWriter, err error) {
+	statusCode := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrInvitationNotFound), err.Error() == "role not found":
+		statusCode = http.StatusNotFound
+	case errors.Is(err, services.ErrInvitationPending), errors.Is(err, services.ErrInvitationClosed), err.Error() == "email already exists":
+		statusCode = http.StatusConflict
+	case err.Error() == "database connection error":
+		statusCode = http.StatusInternalServerError
+	}
+	http.Error(w, err.Error(), statusCode)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/services"
+)
+
+type OIDCHandler struct {
+	oidcService services.OIDCService
+	authService services.AuthService
+	cookies     *auth.SessionCookies
+	publicURL   string
+}
+
+func NewOIDCHandler(oidcService services.OIDCService, authService services.AuthService, cookies *auth.SessionCookies, publicURL string) *OIDCHandler {
+	return &OIDCHandler{oidcService: oidcService, authService: authService, cookies: cookies, publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+// Status tells the login page whether to offer single sign-on.
+func (h *OIDCHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.oidcService.Status())
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, state, err := h.oidcService.Begin()
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCDisabled) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fmt.Printf("OIDC login failed: %v\n", err)
+		h.redirectWithError(w, r, "Single sign-on is unavailable, please try again later")
+		return
+	}
+	h.cookies.SetOIDCState(w, state)
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// Callback finishes the login and hands the tokens to the frontend in the URL
+// fragment, which browsers never send to a server. In cookie session mode the
+// tokens are set as cookies and the fragment carries only the CSRF token. Users
+// with two-factor authentication get a challenge token instead.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The state cookie is good for one callback, whatever its outcome
+	h.cookies.ClearOIDCState(w)
+
+	q := r.URL.Query()
+	if idpErr := q.Get("error"); idpErr != "" {
+		fmt.Printf("OIDC provider returned error: %s %s\n", idpErr, q.Get("error_description"))
+		h.redirectWithError(w, r, "Single sign-on was cancelled or denied")
+		return
+	}
+	if q.Get("state") == "" || q.Get("code") == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// A state the server knows is not enough: without this cookie anyone could
+	// send a victim their own callback URL and sign them in to the wrong account
+	if !h.cookies.CheckOIDCState(r, q.Get("state")) {
+		h.redirectWithError(w, r, services.ErrOIDCInvalidState.Error())
+		return
+	}
+
+	user, err := h.oidcService.Finish(r.Context(), q.Get("state"), q.Get("code"))
+	if err != nil {
+		fmt.Printf("OIDC callback failed: %v\n", err)
+		message := "Single sign-on failed, please try again"
+		if errors.Is(err, services.ErrOIDCInvalidState) || errors.Is(err, services.ErrOIDCEmailUnverified) || errors.Is(err, services.ErrOIDCNoAccount) {
+			message = err.Error()
+		}
+		h.redirectWithError(w, r, message)
+		return
+	}
+
+	resp, err := h.authService.LoginWithIdentity(user, clientInfo(r))
+	if err != nil {
+		h.redirectWithError(w, r, err.Error())
+		return
+	}
+
+	fragment := url.Values{}
+	if resp.MFARequired {
+		// The login page asks for the code and finishes through /auth/mfa/verify
+		fragment.Set("mfaChallenge", resp.ChallengeToken)
+		http.Redirect(w, r, h.publicURL+"/#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+	if h.cookies.Enabled() {
+		if err := h.cookies.Issue(w, resp); err != nil {
+			h.redirectWithError(w, r, "Single sign-on failed, please try again")
+			return
+		}
+		fragment.Set("csrfToken", resp.CSRFToken)
+	} else {
+		fragment.Set("token", resp.Token)
+		fragment.Set("refreshToken", resp.RefreshToken)
+	}
+	if resp.ExpiresAt != nil {
+		fragment.Set("expiresAt", resp.ExpiresAt.Format(time.RFC3339))
+	}
+	http.Redirect(w, r, h.publicURL+"/#"+fragment.Encode(), http.StatusFound)
+}
+
+func (h *OIDCHandler) redirectWithError(w http.ResponseWriter, r *http.Request, message string) {
+	fragment := url.Values{}
+	fragment.Set("oidcError", message)
+	http.Redirect(w, r, h.publicURL+"/#"+fragment.Encode(), http.StatusFound)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-pertama/models"
+	"go-pertama/services"
+)
+
+type PasswordResetHandler struct {
+	service services.PasswordResetService
+}
+
+func NewPasswordResetHandler(service services.PasswordResetService) *PasswordResetHandler {
+	return &PasswordResetHandler{service: service}
+}
+
+func (h *PasswordResetHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RequestReset(req.Email, clientInfo(r)); err != nil {
+		if errors.Is(err, services.ErrResetRateLimited) {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResetPassword(req, clientInfo(r)); err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			statusCode = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset. Please log in again."})
+}
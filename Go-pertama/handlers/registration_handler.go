@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/services"
+)
+
+type RegistrationHandler struct {
+	service services.RegistrationService
+}
+
+func NewRegistrationHandler(service services.RegistrationService) *RegistrationHandler {
+	return &RegistrationHandler{service: service}
+}
+
+// Settings handles GET /auth/registration so the login page knows whether to offer sign-up.
+func (h *RegistrationHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.service.Settings())
+}
+
+// Register handles POST /auth/register.
+func (h *RegistrationHandler) Register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Name == "" || req.Password == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Register(req, clientInfo(r)); err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
+		statusCode := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrRegistrationDisabled):
+			statusCode = http.StatusNotFound
+		case errors.Is(err, services.ErrEmailDomainNotAllowed):
+			statusCode = http.StatusForbidden
+		case errors.Is(err, services.ErrCaptchaFailed), err.Error() == "invalid email address":
+			statusCode = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Check your inbox for a link to confirm your email address",
+	})
+}
+
+// VerifyEmail handles POST /auth/verify-email.
+func (h *RegistrationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.service.VerifyEmail(req.Token, clientInfo(r))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			statusCode = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	message := "Email confirmed. You can now log in."
+	if status == models.RegistrationPendingApproval {
+		message = "Email confirmed. An administrator will review your account; you will get an email once it is approved."
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message, "status": status})
+}
+
+// GetRegistrations handles GET /api/registrations?status=.
+func (h *RegistrationHandler) GetRegistrations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	resp, err := h.service.GetRegistrations(r.URL.Query().Get("status"), page, limit)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "unknown registration status") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Decide handles POST /api/registrations/{id}/approve and /api/registrations/{id}/reject.
+func (h *RegistrationHandler) Decide(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/registrations/"), "/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var message string
+	switch action {
+	case "approve":
+		err = h.service.Approve(id, auth.PrincipalFrom(r))
+		message = "Registration approved"
+	case "reject":
+		var req models.RejectRegistrationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		err = h.service.Reject(id, req.Reason, auth.PrincipalFrom(r))
+		message = "Registration rejected"
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		switch {
+		case err.Error() == "user not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, services.ErrRegistrationNotPending):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
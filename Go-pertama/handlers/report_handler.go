@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"go-pertama/auth"
 	"go-pertama/services"
 	"net/http"
 	"sort"
@@ -194,9 +195,8 @@ func (h *ReportHandler) UploadSummary(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log Activity
-	email := r.Header.Get("X-User-Email")
-	if email != "" {
-		h.userService.LogActivity(email, "UPLOAD_SUMMARY_REPORT", fmt.Sprintf("Uploaded summary report: %s", header.Filename))
+	if principal := auth.PrincipalFrom(r); principal != nil {
+		h.userService.LogActivity(principal.Email, "UPLOAD_SUMMARY_REPORT", fmt.Sprintf("Uploaded summary report: %s", header.Filename))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/services"
 )
@@ -67,17 +69,12 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user from context (set by AuthMiddleware)
-	claims, ok := r.Context().Value("user").(map[string]interface{})
-	createdBy := "System"
-	if ok {
-		if email, ok := claims["email"].(string); ok {
-			createdBy = email
+	if err := h.service.CreateRole(&role, auth.PrincipalFrom(r)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidNetworkList) {
+			status = http.StatusBadRequest
 		}
-	}
-
-	if err := h.service.CreateRole(&role, createdBy); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -107,17 +104,12 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 	}
 	role.ID = id
 
-	// Get user from context
-	claims, ok := r.Context().Value("user").(map[string]interface{})
-	updatedBy := "System"
-	if ok {
-		if email, ok := claims["email"].(string); ok {
-			updatedBy = email
+	if err := h.service.UpdateRole(&role, auth.PrincipalFrom(r)); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidNetworkList) {
+			status = http.StatusBadRequest
 		}
-	}
-
-	if err := h.service.UpdateRole(&role, updatedBy); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), status)
 		return
 	}
 
@@ -146,3 +138,63 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *RoleHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	permissions, err := h.service.GetAllPermissions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+func (h *RoleHandler) GetRolePermissions(w http.ResponseWriter, r *http.Request) {
+	// Path: /api/roles/{id}/permissions
+	parts := strings.Split(r.URL.Path, "/")
+	id, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	permissions, err := h.service.GetRolePermissions(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+func (h *RoleHandler) UpdateRolePermissions(w http.ResponseWriter, r *http.Request) {
+	// Path: /api/roles/{id}/permissions
+	parts := strings.Split(r.URL.Path, "/")
+	id, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.RolePermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	permissions, err := h.service.SetRolePermissions(id, req.Permissions, auth.PrincipalFrom(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
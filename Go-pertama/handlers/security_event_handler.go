@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/services"
+)
+
+type SecurityEventHandler struct {
+	service services.LoginMonitorService
+}
+
+func NewSecurityEventHandler(service services.LoginMonitorService) *SecurityEventHandler {
+	return &SecurityEventHandler{service: service}
+}
+
+// GetOwnEvents handles GET /api/profile/security-events?open=true&page=1&limit=20.
+func (h *SecurityEventHandler) GetOwnEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	resp, err := h.service.ListOwn(auth.PrincipalFrom(r).UserID, q.Get("open") == "true", page, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetEvents handles GET /api/security-events?userId=&open=true&page=1&limit=20 for admins.
+func (h *SecurityEventHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := models.SecurityEventFilter{Open: q.Get("open") == "true"}
+	filter.UserID, _ = strconv.Atoi(q.Get("userId"))
+	filter.Page, _ = strconv.Atoi(q.Get("page"))
+	filter.Limit, _ = strconv.Atoi(q.Get("limit"))
+	resp, err := h.service.List(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AcknowledgeOwn handles POST /api/profile/security-events/{id}/acknowledge.
+func (h *SecurityEventHandler) AcknowledgeOwn(w http.ResponseWriter, r *http.Request) {
+	h.acknowledge(w, r, "/api/profile/security-events/", h.service.AcknowledgeOwn)
+}
+
+// Acknowledge handles POST /api/security-events/{id}/acknowledge for admins.
+func (h *SecurityEventHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
+	h.acknowledge(w, r, "/api/security-events/", h.service.Acknowledge)
+}
+
+func (h *SecurityEventHandler) acknowledge(w http.ResponseWriter, r *http.Request, prefix string, ack func(int64, *auth.Principal) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, prefix), "/acknowledge")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if !ok || err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := ack(id, auth.PrincipalFrom(r)); err != nil {
+		statusCode := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrSecurityEventNotFound):
+			statusCode = http.StatusNotFound
+		case errors.Is(err, services.ErrSecurityEventAcknowledged):
+			statusCode = http.StatusConflict
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Security event acknowledged"})
+}
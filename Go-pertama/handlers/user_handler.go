@@ -3,10 +3,13 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/services"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 type UserHandler struct {
@@ -54,8 +57,11 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.userService.Create(req, r.Header.Get("X-User-Email"), r.Header.Get("X-User-Name"))
+	err := h.userService.Create(req, auth.PrincipalFrom(r))
 	if err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
 		statusCode := http.StatusInternalServerError
 		if err.Error() == "email already exists" {
 			statusCode = http.StatusConflict
@@ -80,8 +86,19 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.userService.Update(req, r.Header.Get("X-User-Email"), r.Header.Get("X-User-Name"))
+	err := h.userService.Update(req, auth.PrincipalFrom(r))
 	if err != nil {
+		if writePasswordPolicyError(w, err) {
+			return
+		}
+		if err.Error() == "email already exists" {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidNetworkList) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -107,8 +124,12 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.userService.Delete(id, r.Header.Get("X-User-Email"), r.Header.Get("X-User-Name"))
+	err = h.userService.Delete(id, auth.PrincipalFrom(r))
 	if err != nil {
+		if err.Error() == "user not found" {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -116,68 +137,77 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
 }
 
-func (h *UserHandler) ResetFailedAttempts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// GetDeletedUsers handles GET /api/users/deleted?page=1&limit=5&search=.
+func (h *UserHandler) GetDeletedUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var req struct {
-		ID int `json:"id"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 
-	err := h.userService.ResetFailedAttempts(req.ID, r.Header.Get("X-User-Email"))
+	resp, err := h.userService.GetDeleted(page, limit, r.URL.Query().Get("search"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Failed attempts reset successfully"})
+	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *UserHandler) GetActiveUsers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// RestoreUser handles POST /api/users/{id}/restore.
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	users, err := h.userService.GetActiveUsers()
+	idStr, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/restore")
+	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"data": users})
+	if err := h.userService.Restore(id, auth.PrincipalFrom(r)); err != nil {
+		switch err.Error() {
+		case "user not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case "email already exists":
+			http.Error(w, "Another user now has this email; change it before restoring", http.StatusConflict)
+		default:
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "User restored successfully"})
 }
 
-func (h *UserHandler) KickUser(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) ResetFailedAttempts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var req struct {
-		Email string `json:"email"`
+		ID int `json:"id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	err := h.userService.KickUser(req.Email, r.Header.Get("X-User-Email"))
+	err := h.userService.ResetFailedAttempts(req.ID, auth.PrincipalFrom(r))
 	if err != nil {
-		http.Error(w, "Failed to kick user: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "User kicked successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Failed attempts reset successfully"})
 }
 
 func (h *UserHandler) UploadProfilePicture(w http.ResponseWriter, r *http.Request) {
@@ -200,7 +230,7 @@ func (h *UserHandler) UploadProfilePicture(w http.ResponseWriter, r *http.Reques
 	}
 	defer file.Close()
 
-	email := r.Header.Get("X-User-Email")
+	email := auth.PrincipalFrom(r).Email
 	err = h.userService.UploadProfilePicture(email, file, header)
 	if err != nil {
 		http.Error(w, "Error saving avatar: "+err.Error(), http.StatusInternalServerError)
@@ -234,12 +264,12 @@ func (h *UserHandler) GetAvatar(w http.ResponseWriter, r *http.Request) {
 		avatar, contentType, err = h.userService.GetAvatarByID(id)
 	} else {
 		// Fetch by Token (authenticated user)
-		email := r.Header.Get("X-User-Email")
-		if email == "" {
+		principal := auth.PrincipalFrom(r)
+		if principal == nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		avatar, contentType, err = h.userService.GetAvatar(email)
+		avatar, contentType, err = h.userService.GetAvatar(principal.Email)
 	}
 
 	if err != nil {
@@ -272,13 +302,13 @@ func (h *UserHandler) RemoveAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Header.Get("X-User-Email")
-	if email == "" {
+	principal := auth.PrincipalFrom(r)
+	if principal == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	err := h.userService.RemoveAvatar(email)
+	err := h.userService.RemoveAvatar(principal.Email)
 	if err != nil {
 		http.Error(w, "Error removing avatar: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -296,8 +326,8 @@ func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Header.Get("X-User-Email")
-	user, err := h.userService.GetProfile(email)
+	principal := auth.PrincipalFrom(r)
+	user, err := h.userService.GetProfile(principal.Email)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
@@ -305,6 +335,9 @@ func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 
 	// Don't send password back
 	user.Password = ""
+	if principal.Impersonating() {
+		user.ImpersonatedBy = &models.Impersonator{ID: principal.ImpersonatorID, Email: principal.ImpersonatorEmail, Name: principal.ImpersonatorName}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
@@ -337,3 +370,38 @@ func (h *UserHandler) GetUserHistory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(history)
 }
+
+// RestoreHistory handles POST /api/users/{id}/history/{historyId}/restore.
+func (h *UserHandler) RestoreHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, _ := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/restore")
+	idStr, historyIDStr, _ := strings.Cut(path, "/history/")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return
+	}
+	historyID, err := strconv.Atoi(historyIDStr)
+	if err != nil {
+		http.Error(w, "Invalid history id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.RestoreHistory(id, historyID, auth.PrincipalFrom(r)); err != nil {
+		switch err.Error() {
+		case "history entry not found":
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case "email already exists":
+			http.Error(w, "Another user now has this email", http.StatusConflict)
+		default:
+			http.Error(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "User restored successfully"})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"go-pertama/auth"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,8 +15,8 @@ func (h *UserHandler) GetActivityLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := r.Header.Get("X-User-Email")
-	if email == "" {
+	principal := auth.PrincipalFrom(r)
+	if principal == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -37,7 +38,7 @@ func (h *UserHandler) GetActivityLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	logs, err := h.userService.GetActivityLogs(email, limit, offset)
+	logs, err := h.userService.GetActivityLogs(principal.Email, limit, offset)
 	if err != nil {
 		http.Error(w, "Error retrieving logs: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -59,8 +60,7 @@ func (h *UserHandler) GetSystemActivityLogs(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Ideally should check for Admin role here, but AuthMiddleware usually handles basic auth.
-	// Role check can be done here or in middleware.
+	// Access is restricted to activity:read by RequirePermission in main.go
 
 	pageStr := r.URL.Query().Get("page")
 	limitStr := r.URL.Query().Get("limit")
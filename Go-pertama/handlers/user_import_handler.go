@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/services"
+)
+
+type UserImportHandler struct {
+	service services.UserImportService
+}
+
+func NewUserImportHandler(service services.UserImportService) *UserImportHandler {
+	return &UserImportHandler{service: service}
+}
+
+// Import handles POST /api/users/import?dryRun=true with the file in the
+// "file" form field.
+func (h *UserImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB limit
+		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	dryRun := r.FormValue("dryRun") == "true"
+	result, err := h.service.Import(file, header.Filename, dryRun, auth.PrincipalFrom(r))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidImportFile) {
+			statusCode = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// DownloadErrors handles GET /api/users/import/errors/{id}, the workbook
+// linked from an import result.
+func (h *UserImportHandler) DownloadErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/users/import/errors/")
+	workbook, err := h.service.ErrorReport(id, auth.PrincipalFrom(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	filename := fmt.Sprintf("user_import_errors_%s.xlsx", time.Now().Format("20060102_150405"))
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Write(workbook)
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogMailer writes messages to .eml files in dir, or to the log when dir is empty.
+// It is meant for development; nothing leaves the machine.
+type LogMailer struct {
+	from string
+	dir  string
+}
+
+func NewLogMailer(from, dir string) *LogMailer {
+	return &LogMailer{from: from, dir: dir}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	data := format(m.from, msg)
+	if m.dir == "" {
+		log.Printf("Mail to %s:\n%s", msg.To, data)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0644)
+}
+
+func sanitize(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_' || c == '@') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go-pertama/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SendInBackground sends msg without making the caller wait, for answers that
+// must take as long whether or not an email goes out. Failures are only logged.
+func SendInBackground(m Mailer, msg Message) {
+	go func() {
+		if err := m.Send(msg); err != nil {
+			log.Printf("Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// New returns the mailer selected by cfg.Driver.
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "", "log":
+		return NewLogMailer(cfg.From, cfg.OutputDir), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", cfg.Driver)
+	}
+}
+
+// format renders the message as an RFC 5322 document.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,8 +12,12 @@ import (
 	"strings"
 	"time"
 
+	"go-pertama/audit"
+	"go-pertama/auth"
 	"go-pertama/config"
+	"go-pertama/geoip"
 	"go-pertama/handlers"
+	"go-pertama/mailer"
 	"go-pertama/middleware"
 	"go-pertama/models"
 	"go-pertama/repository"
@@ -41,6 +47,16 @@ func migrateDB() {
 		 ALTER TABLE Users ADD LastLogout DATETIME NULL;`,
 		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'FailedLoginAttempts' AND Object_ID = Object_ID(N'Users'))
 		 ALTER TABLE Users ADD FailedLoginAttempts INT DEFAULT 0 WITH VALUES;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'LockedUntil' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD LockedUntil DATETIME NULL;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'PasswordChangedAt' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD PasswordChangedAt DATETIME NULL DEFAULT GETDATE() WITH VALUES;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'MustChangePassword' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD MustChangePassword BIT DEFAULT 0 WITH VALUES;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'PlaintextRehashBefore' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD PlaintextRehashBefore DATETIME NULL;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'IsServiceAccount' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD IsServiceAccount BIT NOT NULL DEFAULT 0 WITH VALUES;`,
 		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'Name' AND Object_ID = Object_ID(N'Users'))
 		 ALTER TABLE Users ADD Name NVARCHAR(100) DEFAULT 'User' WITH VALUES;`,
 		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'Role' AND Object_ID = Object_ID(N'Users'))
@@ -57,6 +73,21 @@ func migrateDB() {
 		 ALTER TABLE Users ADD CreatedBy NVARCHAR(100) NULL;`,
 		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'UpdatedBy' AND Object_ID = Object_ID(N'Users'))
 		 ALTER TABLE Users ADD UpdatedBy NVARCHAR(100) NULL;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'AllowedNetworks' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD AllowedNetworks NVARCHAR(1000) NULL, DeniedNetworks NVARCHAR(1000) NULL;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'DeletedAt' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD DeletedAt DATETIME NULL, DeletedBy NVARCHAR(100) NULL;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'RegistrationStatus' AND Object_ID = Object_ID(N'Users'))
+		 ALTER TABLE Users ADD RegistrationStatus VARCHAR(20) NULL;`,
+		// A deleted user keeps its email until it is purged, so emails only have to be unique among live users
+		`DECLARE @uq sysname;
+		 SELECT @uq = kc.name FROM sys.key_constraints kc
+			JOIN sys.index_columns ic ON ic.object_id = kc.parent_object_id AND ic.index_id = kc.unique_index_id
+			JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+		 WHERE kc.parent_object_id = Object_ID(N'Users') AND kc.type = 'UQ' AND c.name = N'Email';
+		 IF @uq IS NOT NULL EXEC(N'ALTER TABLE Users DROP CONSTRAINT ' + QUOTENAME(@uq));`,
+		`IF NOT EXISTS(SELECT * FROM sys.indexes WHERE Name = N'UX_Users_Email_Live' AND Object_ID = Object_ID(N'Users'))
+		 CREATE UNIQUE INDEX UX_Users_Email_Live ON Users(Email) WHERE DeletedAt IS NULL;`,
 		`IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='ActivityLogs' and xtype='U')
 		 CREATE TABLE ActivityLogs (
 			ID INT IDENTITY(1,1) PRIMARY KEY,
@@ -65,6 +96,18 @@ func migrateDB() {
 			Details NVARCHAR(MAX),
 			CreatedAt DATETIME DEFAULT GETDATE()
 		 );`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'APIKeyID' AND Object_ID = Object_ID(N'ActivityLogs'))
+		 ALTER TABLE ActivityLogs ADD APIKeyID BIGINT NULL;`,
+		`IF NOT EXISTS(SELECT * FROM sys.columns WHERE Name = N'PrevHash' AND Object_ID = Object_ID(N'ActivityLogs'))
+		 ALTER TABLE ActivityLogs ADD PrevHash CHAR(64) NULL, EntryHash CHAR(64) NULL;`,
+		`IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='ActivityLogCheckpoints' and xtype='U')
+		 CREATE TABLE ActivityLogCheckpoints (
+			ID INT IDENTITY(1,1) PRIMARY KEY,
+			LogID INT NOT NULL,
+			EntryHash CHAR(64) NOT NULL,
+			Signature NVARCHAR(200) NOT NULL,
+			CreatedAt DATETIME NOT NULL
+		 );`,
 		`IF NOT EXISTS (SELECT * FROM sysobjects WHERE name='UserHistory' and xtype='U')
 		 CREATE TABLE UserHistory (
 			ID INT IDENTITY(1,1) PRIMARY KEY,
@@ -101,8 +144,13 @@ func seedDB() {
 	if adminExists == 0 {
 		log.Println("Admin user missing. Seeding default admin user...")
 
-		password := "password123"
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		// Random, like cmd/setup, and only good for the first login
+		password, err := randomPassword()
+		if err != nil {
+			log.Printf("Error generating admin password: %v", err)
+			return
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), appConfig.Auth.BcryptCost)
 		if err != nil {
 			log.Printf("Error hashing password: %v", err)
 			return
@@ -111,8 +159,8 @@ func seedDB() {
 		// Try to insert with Name and Role first
 		// We use dynamic SQL or try-catch logic here by attempting insert
 		query := `
-			INSERT INTO Users (Email, Password, Name, Role, IsActive, CreatedAt)
-			VALUES ('admin@example.com', @p1, 'Admin User', 'admin', 1, GETDATE())
+			INSERT INTO Users (Email, Password, Name, Role, IsActive, MustChangePassword, CreatedAt)
+			VALUES ('admin@example.com', @p1, 'Admin User', 'admin', 1, 1, GETDATE())
 		`
 		_, err = db.Exec(query, string(hashedPassword))
 		if err != nil {
@@ -120,8 +168,8 @@ func seedDB() {
 
 			// Fallback to basic columns if Name/Role don't exist
 			queryBasic := `
-				INSERT INTO Users (Email, Password, IsActive)
-				VALUES ('admin@example.com', @p1, 1)
+				INSERT INTO Users (Email, Password, IsActive, MustChangePassword)
+				VALUES ('admin@example.com', @p1, 1, 1)
 			`
 			_, err = db.Exec(queryBasic, string(hashedPassword))
 			if err != nil {
@@ -130,16 +178,24 @@ func seedDB() {
 			}
 		}
 
-		log.Println("---------------------------------------------------------")
-		log.Println("DEFAULT USER RESTORED SUCCESSFULLY")
-		log.Println("Email:    admin@example.com")
-		log.Println("Password: password123")
-		log.Println("---------------------------------------------------------")
+		// Printed to stdout rather than the log so it does not end up in log files
+		log.Println("Default admin user created: admin@example.com")
+		fmt.Println("---------------------------------------------------------")
+		fmt.Printf("Initial admin password (shown only once, must be changed at first login): %s\n", password)
+		fmt.Println("---------------------------------------------------------")
 	} else {
 		log.Println("Admin user already exists. Skipping seed.")
 	}
 }
 
+func randomPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func initDB() {
 	// Connection string (DSN format)
 	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;database=%s",
@@ -192,6 +248,53 @@ func seedRoles(db *gorm.DB) {
 	}
 }
 
+// seedPermissions creates missing permissions and gives the built-in roles
+// their defaults the first time they have no permissions at all.
+func seedPermissions(db *gorm.DB) {
+	var added []models.Permission
+	for _, p := range models.DefaultPermissions {
+		permission := p
+		result := db.Where(models.Permission{Code: permission.Code}).FirstOrCreate(&permission)
+		if result.Error != nil {
+			log.Printf("Failed to seed permission %s: %v", permission.Code, result.Error)
+		} else if result.RowsAffected > 0 {
+			added = append(added, permission)
+		}
+	}
+
+	// Permissions introduced by an upgrade go to admin straight away, even when it already has others
+	var admin models.Role
+	if len(added) > 0 && db.Where("name = ?", "admin").First(&admin).Error == nil && db.Model(&admin).Association("Permissions").Count() > 0 {
+		if err := db.Model(&admin).Association("Permissions").Append(added); err != nil {
+			log.Printf("Failed to grant new permissions to admin: %v", err)
+		}
+	}
+
+	defaults := map[string][]string{
+		"user": {models.PermReportsUpload},
+	}
+	for _, p := range models.DefaultPermissions {
+		defaults["admin"] = append(defaults["admin"], p.Code)
+	}
+
+	for roleName, codes := range defaults {
+		var role models.Role
+		if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+			continue
+		}
+		if db.Model(&role).Association("Permissions").Count() > 0 {
+			continue
+		}
+		var permissions []models.Permission
+		db.Where("code IN ?", codes).Find(&permissions)
+		if err := db.Model(&role).Association("Permissions").Append(permissions); err != nil {
+			log.Printf("Failed to seed permissions for role %s: %v", roleName, err)
+		} else {
+			log.Printf("Seeded %d permissions for role %s", len(permissions), roleName)
+		}
+	}
+}
+
 func initGorm() {
 	fmt.Println("initGorm: Starting...")
 	dsn := fmt.Sprintf("server=%s;user id=%s;password=%s;database=%s",
@@ -213,16 +316,19 @@ func initGorm() {
 	}
 	fmt.Println("initGorm: Connection opened.")
 
-	// Auto Migrate SystemConfig and Role
+	// Auto Migrate SystemConfig, Role (with permissions), tokens, sessions, password history, MFA, SSO and API key tables
 	// Note: User migration is handled by manual SQL in migrateDB for now to preserve existing logic
 	fmt.Println("initGorm: AutoMigrating...")
-	err = gormDB.AutoMigrate(&models.SystemConfig{}, &models.SystemConfigHistory{}, &models.Role{})
+	err = gormDB.AutoMigrate(&models.SystemConfig{}, &models.SystemConfigHistory{}, &models.Role{}, &models.Permission{}, &models.RefreshToken{}, &models.Session{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.Invitation{}, &models.PasswordHistory{},
+		&models.UserMFA{}, &models.MFARecoveryCode{}, &models.MFAChallenge{}, &models.UserIdentity{}, &models.OIDCLoginState{},
+		&models.APIKey{}, &models.KnownDevice{}, &models.SecurityEvent{})
 	if err != nil {
 		fmt.Printf("Warning: AutoMigrate failed: %v\n", err)
 	}
 	fmt.Println("initGorm: AutoMigrate done.")
 
 	seedRoles(gormDB)
+	seedPermissions(gormDB)
 	seedConfigDB(gormDB)
 
 	// Sync User Roles (Update RoleID based on Role string)
@@ -238,6 +344,39 @@ func seedConfigDB(db *gorm.DB) {
 		{ConfigKey: "max_upload_size", MainValue: "10MB", Description: "Maximum file upload size", DataType: models.TypeString},
 		{ConfigKey: "theme", MainValue: "light", Description: "Default UI theme", DataType: models.TypeString},
 		{ConfigKey: "pagination_limit", MainValue: "5", Description: "Default number of items per page for pagination", DataType: models.TypeInteger},
+		{ConfigKey: "max_login_attempts", MainValue: "5", Description: "Failed logins before the account is locked (0 disables lockout)", DataType: models.TypeInteger},
+		{ConfigKey: "lockout_duration_minutes", MainValue: "15", Description: "Length of the first account lockout", DataType: models.TypeInteger},
+		{ConfigKey: "lockout_backoff_multiplier", MainValue: "2", Description: "Each repeated lockout lasts this many times longer than the previous one", DataType: models.TypeInteger},
+		{ConfigKey: "lockout_max_duration_minutes", MainValue: "1440", Description: "Upper bound for a single lockout", DataType: models.TypeInteger},
+		{ConfigKey: "password_reset_token_minutes", MainValue: "30", Description: "How long an emailed password reset link stays valid", DataType: models.TypeInteger},
+		{ConfigKey: "password_reset_max_per_email_hour", MainValue: "3", Description: "Password reset requests allowed per email address per hour", DataType: models.TypeInteger},
+		{ConfigKey: "password_min_length", MainValue: "8", Description: "Minimum password length", DataType: models.TypeInteger},
+		{ConfigKey: "password_require_uppercase", MainValue: "true", Description: "Passwords must contain an uppercase letter", DataType: models.TypeBoolean},
+		{ConfigKey: "password_require_lowercase", MainValue: "true", Description: "Passwords must contain a lowercase letter", DataType: models.TypeBoolean},
+		{ConfigKey: "password_require_digit", MainValue: "true", Description: "Passwords must contain a digit", DataType: models.TypeBoolean},
+		{ConfigKey: "password_require_symbol", MainValue: "false", Description: "Passwords must contain a symbol", DataType: models.TypeBoolean},
+		{ConfigKey: "password_history_count", MainValue: "5", Description: "Number of previous passwords that cannot be reused (0 disables)", DataType: models.TypeInteger},
+		{ConfigKey: "password_max_age_days", MainValue: "0", Description: "Days before a password must be changed at next login (0 disables)", DataType: models.TypeInteger},
+		{ConfigKey: "password_check_breached", MainValue: "true", Description: "Reject passwords found in the bundled breached-password list", DataType: models.TypeBoolean},
+		{ConfigKey: "password_reset_max_per_ip_hour", MainValue: "10", Description: "Password reset requests allowed per IP address per hour", DataType: models.TypeInteger},
+		{ConfigKey: "registration_enabled", MainValue: "false", Description: "Let people create their own account through /auth/register", DataType: models.TypeBoolean},
+		{ConfigKey: "registration_requires_approval", MainValue: "true", Description: "Self-registered users wait for an administrator after confirming their email (false activates them right away)", DataType: models.TypeBoolean},
+		{ConfigKey: "registration_allowed_domains", MainValue: "", Description: "Comma separated email domains allowed to register, e.g. example.com,*.example.org (empty allows any)", DataType: models.TypeString},
+		{ConfigKey: "registration_default_role", MainValue: "user", Description: "Role given to self-registered users", DataType: models.TypeString},
+		{ConfigKey: "registration_token_hours", MainValue: "24", Description: "How long an email verification link stays valid", DataType: models.TypeInteger},
+		{ConfigKey: "invitation_expiry_hours", MainValue: "72", Description: "How long an invitation link stays valid unless the invitation sets its own expiry", DataType: models.TypeInteger},
+		{ConfigKey: "user_purge_after_days", MainValue: "30", Description: "Days after which deleted users are removed for good (0 keeps them)", DataType: models.TypeInteger},
+		{ConfigKey: "impersonation_minutes", MainValue: "30", Description: "Length of an admin impersonation session (0 disables impersonation)", DataType: models.TypeInteger},
+		{ConfigKey: "login_alerts_enabled", MainValue: "true", Description: "Flag logins from new devices, new countries or impossible travel as security events", DataType: models.TypeBoolean},
+		{ConfigKey: "impossible_travel_kmh", MainValue: "1000", Description: "Speed between two logins above which they are flagged as impossible travel (needs a GeoIP city database)", DataType: models.TypeInteger},
+		{ConfigKey: "rate_limit_enabled", MainValue: "true", Description: "Throttle login and other sensitive endpoints with 429 responses", DataType: models.TypeBoolean},
+		{ConfigKey: "rate_limit_login", MainValue: "ip=20/1m,email=5/1m", Description: "Rate limit for /login per client IP and per submitted email", DataType: models.TypeString},
+		{ConfigKey: "rate_limit_mfa", MainValue: "ip=10/1m", Description: "Rate limit for /auth/mfa/verify", DataType: models.TypeString},
+		{ConfigKey: "rate_limit_refresh", MainValue: "ip=60/1m", Description: "Rate limit for /auth/refresh", DataType: models.TypeString},
+		{ConfigKey: "rate_limit_password_reset", MainValue: "ip=10/1m,email=3/15m", Description: "Rate limit for /auth/forgot-password and /auth/reset-password", DataType: models.TypeString},
+		{ConfigKey: "rate_limit_register", MainValue: "ip=5/10m,email=3/1h", Description: "Rate limit for /auth/register and /auth/verify-email", DataType: models.TypeString},
+		{ConfigKey: "rate_limit_invitation", MainValue: "ip=10/1m", Description: "Rate limit for /auth/invitation and /auth/invitation/accept", DataType: models.TypeString},
+		{ConfigKey: "rate_limit_sensitive", MainValue: "ip=30/1m,user=10/1m", Description: "Rate limit for password change and two-factor settings per IP and per user", DataType: models.TypeString},
 	}
 
 	for _, config := range configs {
@@ -280,101 +419,292 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	configRepo := repository.NewConfigRepository(gormDB)
 	roleRepo := repository.NewRoleRepository(gormDB)
+	refreshRepo := repository.NewRefreshTokenRepository(gormDB)
+	sessionRepo := repository.NewSessionRepository(gormDB)
+	resetRepo := repository.NewPasswordResetRepository(gormDB)
+	verificationRepo := repository.NewEmailVerificationRepository(gormDB)
+	invitationRepo := repository.NewInvitationRepository(gormDB)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(gormDB)
+	mfaRepo := repository.NewMFARepository(gormDB)
+	oidcRepo := repository.NewOIDCRepository(gormDB)
+	apiKeyRepo := repository.NewAPIKeyRepository(gormDB)
+	securityEventRepo := repository.NewSecurityEventRepository(gormDB)
+
+	// Initialize Token Manager
+	tokenManager, err := auth.NewTokenManager(appConfig.JWT)
+	if err != nil {
+		log.Fatal("Error initializing JWT: ", err)
+	}
+
+	sessionCookies, err := auth.NewSessionCookies(appConfig)
+	if err != nil {
+		log.Fatal("Error initializing sessions: ", err)
+	}
+
+	// Initialize Mailer
+	mail, err := mailer.New(appConfig.Mail)
+	if err != nil {
+		log.Fatal("Error initializing mailer: ", err)
+	}
+
+	auditKeys, err := audit.LoadKeys(appConfig.Audit.SigningKeyFile, appConfig.Audit.VerifyKeyFile)
+	if err != nil {
+		log.Fatal("Error loading audit keys: ", err)
+	}
+	if auditKeys.Private != nil && appConfig.Audit.CheckpointInterval > 0 {
+		go audit.RunCheckpoints(db, auditKeys.Private, appConfig.Audit.CheckpointInterval)
+	}
+
+	geoDB, err := geoip.Open(appConfig.Security.GeoIPDatabase)
+	if err != nil {
+		log.Fatal("Error opening GeoIP database: ", err)
+	}
+	defer geoDB.Close()
+	securityNotifiers := services.SecurityNotifiers{services.NewMailSecurityNotifier(mail, appConfig.App.PublicURL)}
+	if appConfig.Security.WebhookURL != "" {
+		securityNotifiers = append(securityNotifiers, services.NewWebhookSecurityNotifier(appConfig.Security.WebhookURL, appConfig.Security.WebhookSecret))
+	}
 
 	// Initialize Services
-	userService := services.NewUserService(userRepo)
-	authService := services.NewAuthService(userRepo, appConfig)
 	configService := services.NewConfigService(configRepo)
+	passwordService := services.NewPasswordService(userRepo, passwordHistoryRepo, configService, appConfig.Auth)
+	userService := services.NewUserService(userRepo, passwordService)
+	userImportService := services.NewUserImportService(userRepo, roleRepo, passwordService)
+	if gormDB != nil {
+		// The retention setting lives in the GORM config table
+		go services.RunUserPurge(userService, configService, time.Hour)
+	} else {
+		log.Println("User purge disabled: database is unavailable")
+	}
+	mfaService := services.NewMFAService(mfaRepo, userRepo, passwordService, appConfig.App.Name)
+	sessionService := services.NewSessionService(sessionRepo, refreshRepo, userRepo)
+	authenticators, err := services.NewAuthenticators(appConfig, userRepo, roleRepo, passwordService)
+	if err != nil {
+		log.Fatal("Error initializing authentication: ", err)
+	}
+	networkPolicyService := services.NewNetworkPolicyService(userRepo)
+	loginMonitorService := services.NewLoginMonitorService(securityEventRepo, userRepo, configService, geoDB, securityNotifiers)
+	authService := services.NewAuthService(userRepo, refreshRepo, sessionService, configService, passwordService, authenticators, mfaService, networkPolicyService, loginMonitorService, tokenManager, appConfig)
 	roleService := services.NewRoleService(roleRepo)
+	passwordResetService := services.NewPasswordResetService(userRepo, resetRepo, sessionService, configService, passwordService, mail, appConfig.App.PublicURL)
+	registrationService := services.NewRegistrationService(userRepo, roleRepo, verificationRepo, configService, passwordService, services.NewCaptchaVerifier(appConfig.Captcha), mail, appConfig.App.PublicURL)
+	invitationService := services.NewInvitationService(invitationRepo, userRepo, roleRepo, configService, passwordService, mail, appConfig.App.PublicURL)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, roleRepo)
+	impersonationService := services.NewImpersonationService(sessionRepo, sessionService, userRepo, roleService, configService, tokenManager)
+	auditService := services.NewAuditService(db, auditKeys.Public)
+	oidcService := services.NewOIDCService(auth.NewOIDCClient(appConfig.OIDC), oidcRepo, userRepo, roleRepo, passwordService, appConfig.OIDC)
 
 	// Initialize Handlers
 	userHandler := handlers.NewUserHandler(userService)
-	authHandler := handlers.NewAuthHandler(authService)
+	userImportHandler := handlers.NewUserImportHandler(userImportService)
+	authHandler := handlers.NewAuthHandler(authService, sessionCookies)
 	configHandler := handlers.NewConfigHandler(configService)
 	changeLogHandler := handlers.NewChangeLogHandler()
 	roleHandler := handlers.NewRoleHandler(roleService)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
 	reportHandler := handlers.NewReportHandler(userService)
+	passwordResetHandler := handlers.NewPasswordResetHandler(passwordResetService)
+	registrationHandler := handlers.NewRegistrationHandler(registrationService)
+	invitationHandler := handlers.NewInvitationHandler(invitationService)
+	mfaHandler := handlers.NewMFAHandler(mfaService, userService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, authService, sessionCookies, appConfig.App.PublicURL)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	impersonationHandler := handlers.NewImpersonationHandler(impersonationService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	securityEventHandler := handlers.NewSecurityEventHandler(loginMonitorService)
 
 	// Initialize Middleware
-	authMiddleware := middleware.AuthMiddleware(db)
+	authMiddleware := middleware.AuthMiddleware(db, tokenManager, roleService, apiKeyService, sessionCookies, networkPolicyService)
+	can := middleware.RequirePermission
+	cors := middleware.NewCORS(appConfig.CORS).Handler
+	noImpersonation := middleware.DenyDuringImpersonation
+	clientIP, err := middleware.NewClientIP(appConfig.App.TrustedProxies)
+	if err != nil {
+		log.Fatal("Error initializing trusted proxies: ", err)
+	}
+	rateLimiter := middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore(), configService)
+	limit := rateLimiter.Limit
 
 	mux := http.NewServeMux()
 
 	// Auth Routes
-	mux.HandleFunc("/login", middleware.EnableCORS(authHandler.Login))
-	mux.HandleFunc("/logout", middleware.EnableCORS(authMiddleware(authHandler.Logout)))
-	mux.HandleFunc("/change-password", middleware.EnableCORS(authMiddleware(authHandler.ChangePassword)))
+	mux.HandleFunc("/login", cors(limit("login")(authHandler.Login)))
+	mux.HandleFunc("/auth/refresh", cors(limit("refresh")(authHandler.Refresh)))
+	mux.HandleFunc("/auth/mfa/verify", cors(limit("mfa")(authHandler.VerifyMFA)))
+	mux.HandleFunc("/auth/forgot-password", cors(limit("password_reset")(passwordResetHandler.ForgotPassword)))
+	mux.HandleFunc("/auth/reset-password", cors(limit("password_reset")(passwordResetHandler.ResetPassword)))
+	mux.HandleFunc("/auth/registration", cors(registrationHandler.Settings))
+	mux.HandleFunc("/auth/register", cors(limit("register")(registrationHandler.Register)))
+	mux.HandleFunc("/auth/verify-email", cors(limit("register")(registrationHandler.VerifyEmail)))
+	mux.HandleFunc("/auth/invitation", cors(limit("invitation")(invitationHandler.GetInvitation)))
+	mux.HandleFunc("/auth/invitation/accept", cors(limit("invitation")(invitationHandler.AcceptInvitation)))
+	mux.HandleFunc("/auth/oidc", cors(oidcHandler.Status))
+	mux.HandleFunc("/auth/oidc/login", oidcHandler.Login)
+	mux.HandleFunc("/auth/oidc/callback", oidcHandler.Callback)
+	mux.HandleFunc("/logout", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		// Logging out of an impersonation ends it without touching the user's own sessions
+		if auth.PrincipalFrom(r).Impersonating() {
+			impersonationHandler.End(w, r)
+			return
+		}
+		authHandler.Logout(w, r)
+	})))
+	mux.HandleFunc("/change-password", cors(authMiddleware(noImpersonation(limit("sensitive")(authHandler.ChangePassword)))))
 
 	// User Routes
-	mux.HandleFunc("/api/profile", middleware.EnableCORS(authMiddleware(userHandler.GetProfile)))
-	mux.HandleFunc("/api/profile/activity", middleware.EnableCORS(authMiddleware(userHandler.GetActivityLogs)))
-	mux.HandleFunc("/api/activity-logs", middleware.EnableCORS(authMiddleware(userHandler.GetSystemActivityLogs)))
-	mux.HandleFunc("/api/activity-logs/export", middleware.EnableCORS(authMiddleware(userHandler.ExportActivityLogs)))
-	mux.HandleFunc("/api/users/active", middleware.EnableCORS(authMiddleware(userHandler.GetActiveUsers)))
-	mux.HandleFunc("/api/users/kick", middleware.EnableCORS(authMiddleware(userHandler.KickUser)))
-	mux.HandleFunc("/api/users/history", middleware.EnableCORS(authMiddleware(userHandler.GetUserHistory)))
-	mux.HandleFunc("/api/users", middleware.EnableCORS(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/profile", cors(authMiddleware(userHandler.GetProfile)))
+	mux.HandleFunc("/api/profile/activity", cors(authMiddleware(userHandler.GetActivityLogs)))
+	mux.HandleFunc("/api/activity-logs", cors(authMiddleware(can(models.PermActivityRead)(userHandler.GetSystemActivityLogs))))
+	mux.HandleFunc("/api/activity-logs/export", cors(authMiddleware(can(models.PermActivityRead)(userHandler.ExportActivityLogs))))
+	mux.HandleFunc("/api/activity-logs/verify", cors(authMiddleware(can(models.PermActivityRead)(auditHandler.VerifyActivityLogs))))
+	mux.HandleFunc("/api/profile/mfa", cors(authMiddleware(mfaHandler.GetStatus)))
+	mux.HandleFunc("/api/profile/mfa/setup", cors(authMiddleware(noImpersonation(limit("sensitive")(mfaHandler.Setup)))))
+	mux.HandleFunc("/api/profile/mfa/confirm", cors(authMiddleware(noImpersonation(limit("sensitive")(mfaHandler.Confirm)))))
+	mux.HandleFunc("/api/profile/mfa/recovery-codes", cors(authMiddleware(noImpersonation(limit("sensitive")(mfaHandler.RegenerateRecoveryCodes)))))
+	mux.HandleFunc("/api/profile/mfa/disable", cors(authMiddleware(noImpersonation(limit("sensitive")(mfaHandler.Disable)))))
+	mux.HandleFunc("/api/profile/devices", cors(authMiddleware(sessionHandler.GetMyDevices)))
+	mux.HandleFunc("/api/profile/devices/revoke", cors(authMiddleware(noImpersonation(sessionHandler.RevokeMyDevice))))
+	mux.HandleFunc("/api/profile/security-events", cors(authMiddleware(securityEventHandler.GetOwnEvents)))
+	mux.HandleFunc("/api/profile/security-events/", cors(authMiddleware(noImpersonation(securityEventHandler.AcknowledgeOwn))))
+	mux.HandleFunc("/api/security-events", cors(authMiddleware(can(models.PermSecurityRead)(securityEventHandler.GetEvents))))
+	mux.HandleFunc("/api/security-events/", cors(authMiddleware(can(models.PermSecurityWrite)(securityEventHandler.Acknowledge))))
+	mux.HandleFunc("/api/users/active", cors(authMiddleware(can(models.PermSessionsRead)(sessionHandler.GetActiveSessions))))
+	mux.HandleFunc("/api/users/kick", cors(authMiddleware(can(models.PermSessionsKick)(sessionHandler.KickSession))))
+	mux.HandleFunc("/api/users/history", cors(authMiddleware(can(models.PermUsersRead)(userHandler.GetUserHistory))))
+	mux.HandleFunc("/api/users/deleted", cors(authMiddleware(can(models.PermUsersRead)(userHandler.GetDeletedUsers))))
+	mux.HandleFunc("/api/users/import", cors(authMiddleware(can(models.PermUsersWrite)(userImportHandler.Import))))
+	mux.HandleFunc("/api/users/import/errors/", cors(authMiddleware(can(models.PermUsersWrite)(userImportHandler.DownloadErrors))))
+	mux.HandleFunc("/api/users", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			userHandler.GetUsers(w, r)
+			can(models.PermUsersRead)(userHandler.GetUsers)(w, r)
 		} else if r.Method == http.MethodPost {
-			userHandler.CreateUser(w, r)
+			can(models.PermUsersWrite)(userHandler.CreateUser)(w, r)
 		} else if r.Method == http.MethodPut {
-			userHandler.UpdateUser(w, r)
+			can(models.PermUsersWrite)(userHandler.UpdateUser)(w, r)
 		} else if r.Method == http.MethodDelete {
-			userHandler.DeleteUser(w, r)
+			can(models.PermUsersDelete)(userHandler.DeleteUser)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})))
 
-	mux.HandleFunc("/api/users/reset-counter", middleware.EnableCORS(authMiddleware(userHandler.ResetFailedAttempts)))
+	mux.HandleFunc("/api/users/reset-counter", cors(authMiddleware(can(models.PermUsersWrite)(userHandler.ResetFailedAttempts))))
+	mux.HandleFunc("/api/users/mfa/reset", cors(authMiddleware(can(models.PermUsersWrite)(mfaHandler.ResetUserMFA))))
+	mux.HandleFunc("/api/users/", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		// Handle /api/users/{id}/impersonate
+		if strings.HasSuffix(r.URL.Path, "/impersonate") {
+			can(models.PermImpersonate)(impersonationHandler.Start)(w, r)
+			return
+		}
+		// Handle /api/users/{id}/history/{historyId}/restore
+		if strings.Contains(r.URL.Path, "/history/") && strings.HasSuffix(r.URL.Path, "/restore") {
+			can(models.PermUsersWrite)(userHandler.RestoreHistory)(w, r)
+			return
+		}
+		// Handle /api/users/{id}/restore
+		if strings.HasSuffix(r.URL.Path, "/restore") {
+			can(models.PermUsersDelete)(userHandler.RestoreUser)(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})))
+	mux.HandleFunc("/api/registrations", cors(authMiddleware(can(models.PermUsersRead)(registrationHandler.GetRegistrations))))
+	mux.HandleFunc("/api/registrations/", cors(authMiddleware(can(models.PermUsersWrite)(registrationHandler.Decide))))
+	mux.HandleFunc("/api/invitations", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			can(models.PermUsersRead)(invitationHandler.GetInvitations)(w, r)
+		} else if r.Method == http.MethodPost {
+			can(models.PermUsersWrite)(invitationHandler.CreateInvitation)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+	mux.HandleFunc("/api/invitations/", cors(authMiddleware(can(models.PermUsersWrite)(invitationHandler.InvitationAction))))
+	mux.HandleFunc("/api/impersonation/end", cors(authMiddleware(impersonationHandler.End)))
 
-	mux.HandleFunc("/upload", middleware.EnableCORS(authMiddleware(userHandler.UploadProfilePicture)))
-	mux.HandleFunc("/api/avatar/remove", middleware.EnableCORS(authMiddleware(userHandler.RemoveAvatar)))
-	mux.HandleFunc("/api/avatar", middleware.EnableCORS(userHandler.GetAvatar))
+	mux.HandleFunc("/upload", cors(authMiddleware(userHandler.UploadProfilePicture)))
+	mux.HandleFunc("/api/avatar/remove", cors(authMiddleware(userHandler.RemoveAvatar)))
+	mux.HandleFunc("/api/avatar", cors(userHandler.GetAvatar))
 
 	// Report Route
-	mux.HandleFunc("/api/upload-summary", middleware.EnableCORS(authMiddleware(reportHandler.UploadSummary)))
+	mux.HandleFunc("/api/upload-summary", cors(authMiddleware(can(models.PermReportsUpload)(reportHandler.UploadSummary))))
 
 	// Change Log Route
-	mux.HandleFunc("/api/changelog", middleware.EnableCORS(authMiddleware(changeLogHandler.GetChangeLog)))
+	mux.HandleFunc("/api/changelog", cors(authMiddleware(changeLogHandler.GetChangeLog)))
 
 	// Role Routes
-	mux.HandleFunc("/api/roles", middleware.EnableCORS(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/permissions", cors(authMiddleware(can(models.PermRolesRead)(roleHandler.GetPermissions))))
+
+	mux.HandleFunc("/api/roles", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
-			roleHandler.GetRoles(w, r)
+			can(models.PermRolesRead)(roleHandler.GetRoles)(w, r)
 		} else if r.Method == http.MethodPost {
-			roleHandler.CreateRole(w, r)
+			can(models.PermRolesWrite)(roleHandler.CreateRole)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})))
 
-	mux.HandleFunc("/api/roles/", middleware.EnableCORS(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/roles/", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
+
+		// Handle /api/roles/{id}/permissions
+		if strings.HasSuffix(path, "/permissions") {
+			if r.Method == http.MethodGet {
+				can(models.PermRolesRead)(roleHandler.GetRolePermissions)(w, r)
+				return
+			} else if r.Method == http.MethodPut {
+				can(models.PermRolesWrite)(roleHandler.UpdateRolePermissions)(w, r)
+				return
+			}
+		}
+
 		// Handle /api/roles/{id}
 		if len(path) > len("/api/roles/") {
 			if r.Method == http.MethodGet {
-				roleHandler.GetRole(w, r)
+				can(models.PermRolesRead)(roleHandler.GetRole)(w, r)
 				return
 			} else if r.Method == http.MethodPut {
-				roleHandler.UpdateRole(w, r)
+				can(models.PermRolesWrite)(roleHandler.UpdateRole)(w, r)
 				return
 			} else if r.Method == http.MethodDelete {
-				roleHandler.DeleteRole(w, r)
+				can(models.PermRolesWrite)(roleHandler.DeleteRole)(w, r)
 				return
 			}
 		}
 		http.NotFound(w, r)
 	})))
 
+	// API Key Routes
+	mux.HandleFunc("/api/api-keys", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			can(models.PermAPIKeysRead)(apiKeyHandler.GetAPIKeys)(w, r)
+		} else if r.Method == http.MethodPost {
+			can(models.PermAPIKeysWrite)(apiKeyHandler.CreateAPIKey)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.HandleFunc("/api/api-keys/", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			can(models.PermAPIKeysRead)(apiKeyHandler.GetAPIKey)(w, r)
+		} else if r.Method == http.MethodPut {
+			can(models.PermAPIKeysWrite)(apiKeyHandler.UpdateAPIKey)(w, r)
+		} else if r.Method == http.MethodDelete {
+			can(models.PermAPIKeysWrite)(apiKeyHandler.RevokeAPIKey)(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
 	// Config Routes
-	mux.HandleFunc("/api/configs", middleware.EnableCORS(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/configs", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/api/configs" {
 			if r.Method == http.MethodGet {
-				configHandler.GetConfigs(w, r)
+				can(models.PermConfigsRead)(configHandler.GetConfigs)(w, r)
 			} else if r.Method == http.MethodPost {
-				configHandler.CreateConfig(w, r)
+				can(models.PermConfigsWrite)(configHandler.CreateConfig)(w, r)
 			} else {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
@@ -383,26 +713,26 @@ func main() {
 		}
 	})))
 
-	mux.HandleFunc("/api/configs/", middleware.EnableCORS(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/configs/", cors(authMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		// Handle /api/configs/{id}/history
 		// Check this FIRST because it's more specific than /api/configs/{id}
 		if strings.HasSuffix(path, "/history") && r.Method == http.MethodGet {
-			configHandler.GetHistory(w, r)
+			can(models.PermConfigsRead)(configHandler.GetHistory)(w, r)
 			return
 		}
 
 		// Handle /api/configs/{id}
 		if len(path) > len("/api/configs/") {
 			if r.Method == http.MethodGet {
-				configHandler.GetConfig(w, r)
+				can(models.PermConfigsRead)(configHandler.GetConfig)(w, r)
 				return
 			} else if r.Method == http.MethodPut {
-				configHandler.UpdateConfig(w, r)
+				can(models.PermConfigsWrite)(configHandler.UpdateConfig)(w, r)
 				return
 			} else if r.Method == http.MethodDelete {
-				configHandler.DeleteConfig(w, r)
+				can(models.PermConfigsWrite)(configHandler.DeleteConfig)(w, r)
 				return
 			}
 		}
@@ -423,7 +753,7 @@ func main() {
 
 	port := "8081"
 	fmt.Printf("Server starting on port %s...\n", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	if err := http.ListenAndServe(":"+port, clientIP.Handler(mux)); err != nil {
 		fmt.Printf("FATAL ERROR: %v\n", err)
 		os.Exit(1)
 	}
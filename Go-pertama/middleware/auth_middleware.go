@@ -2,87 +2,198 @@ package middleware
 
 import (
 	"database/sql"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
+
+	"go-pertama/auth"
 )
 
-func AuthMiddleware(db *sql.DB) func(http.HandlerFunc) http.HandlerFunc {
+// APIKeyLookup resolves "Authorization: ApiKey <key>" to the service account behind it.
+type APIKeyLookup interface {
+	AuthenticateKey(key, ip string) (*auth.Principal, error)
+	LogKeyUsage(principal *auth.Principal, method, path string)
+}
+
+// NetworkGuard refuses callers outside the networks their role or account is restricted to.
+type NetworkGuard interface {
+	Check(userID int, ip, where string) error
+}
+
+// AuthMiddleware verifies the access token (from the Authorization header or,
+// in cookie session mode, the session cookie) or API key and stores the
+// caller's auth.Principal in the request context for handlers to read. Every
+// request is also held to the caller's network restrictions.
+func AuthMiddleware(db *sql.DB, tokens *auth.TokenManager, permissions PermissionLookup, apiKeys APIKeyLookup, cookies *auth.SessionCookies, networks NetworkGuard) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
+			authHeader := strings.TrimSpace(r.Header.Get("Authorization"))
+
+			if key, ok := strings.CutPrefix(authHeader, "ApiKey "); ok {
+				principal, err := apiKeys.AuthenticateKey(strings.TrimSpace(key), remoteIP(r))
+				if err != nil {
+					http.Error(w, "Invalid or expired API key", http.StatusUnauthorized)
+					return
+				}
+				if !checkNetwork(w, r, networks, principal.UserID) {
+					return
+				}
+				apiKeys.LogKeyUsage(principal, r.Method, r.URL.Path)
+				next(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+				return
+			}
+
+			tokenString := bearerToken(authHeader)
+			if tokenString == "" {
+				// Browsers in cookie mode send the session cookie; the CSRF header
+				// proves a state-changing request came from our own page
+				tokenString = cookies.AccessToken(r)
+				if tokenString != "" && !cookies.CheckCSRF(r) {
+					http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+					return
+				}
+			}
+			if tokenString == "" {
 				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-			if !strings.HasPrefix(tokenString, "sql-jwt-token-") {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
+			claims, err := tokens.Parse(tokenString)
+			if err != nil {
+				http.Error(w, tokenErrorMessage(err), http.StatusUnauthorized)
 				return
 			}
 
-			// Robust token parsing
-			// Token format: sql-jwt-token-{email}-secret-{secretPart}
-			// We need to extract the email, which might contain hyphens.
-			
-			// 1. Remove prefix
-			payload := strings.TrimPrefix(tokenString, "sql-jwt-token-")
-			
-			// 2. Find suffix "-secret-"
-			// Use LastIndex to be safe if email contains "-secret-" (unlikely but possible)
-			// or just Index if we assume email doesn't contain it.
-			// Since secret part is at the end, LastIndex is safer for the suffix separator.
-			suffixIdx := strings.LastIndex(payload, "-secret-")
-			
-			if suffixIdx == -1 {
-				http.Error(w, "Invalid token format", http.StatusUnauthorized)
+			principal := &auth.Principal{SessionID: claims.SessionID}
+			if claims.SessionID != "" {
+				// Check the session is still live (not logged out, kicked or expired)
+				err = db.QueryRow(`SELECT u.ID, u.Email, u.Name, COALESCE(r.Name, u.Role), u.MustChangePassword,
+					COALESCE(s.impersonator_id, 0), COALESCE(a.Email, ''), COALESCE(a.Name, '') FROM sessions s
+					JOIN Users u ON u.ID = s.user_id
+					LEFT JOIN Roles r ON u.RoleID = r.ID
+					LEFT JOIN Users a ON a.ID = s.impersonator_id
+					WHERE s.id = @p1 AND s.user_id = @p2 AND s.revoked_at IS NULL AND s.expires_at > SYSDATETIMEOFFSET() AND u.DeletedAt IS NULL`,
+					claims.SessionID, claims.UserID()).Scan(&principal.UserID, &principal.Email, &principal.Name, &principal.Role, &principal.MustChangePassword,
+					&principal.ImpersonatorID, &principal.ImpersonatorEmail, &principal.ImpersonatorName)
+				if err == sql.ErrNoRows {
+					http.Error(w, "Session expired or user kicked", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					http.Error(w, "User not found or database error", http.StatusUnauthorized)
+					return
+				}
+				// Throttle last-seen writes to once a minute per session
+				db.Exec(`UPDATE sessions SET last_seen_at = SYSDATETIMEOFFSET()
+					WHERE id = @p1 AND last_seen_at < DATEADD(minute, -1, SYSDATETIMEOFFSET())`, claims.SessionID)
+			} else {
+				// Tokens without a session fall back to the Users.IsLoggedIn flag
+				var isLoggedIn bool
+				query := `SELECT u.IsLoggedIn, u.ID, u.Email, u.Name, COALESCE(r.Name, u.Role), u.MustChangePassword FROM Users u
+					LEFT JOIN Roles r ON u.RoleID = r.ID `
+				if claims.Legacy {
+					err = db.QueryRow(query+"WHERE u.Email = @p1 AND u.DeletedAt IS NULL", claims.Email).Scan(&isLoggedIn, &principal.UserID, &principal.Email, &principal.Name, &principal.Role, &principal.MustChangePassword)
+				} else {
+					err = db.QueryRow(query+"WHERE u.ID = @p1 AND u.DeletedAt IS NULL", claims.UserID()).Scan(&isLoggedIn, &principal.UserID, &principal.Email, &principal.Name, &principal.Role, &principal.MustChangePassword)
+				}
+				if err != nil {
+					http.Error(w, "User not found or database error", http.StatusUnauthorized)
+					return
+				}
+				if !isLoggedIn {
+					http.Error(w, "Session expired or user kicked", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			if !checkNetwork(w, r, networks, principal.UserID) {
+				return
+			}
+			// The admin behind an impersonation stays bound to their own restrictions too
+			if principal.Impersonating() && !checkNetwork(w, r, networks, principal.ImpersonatorID) {
 				return
 			}
-			
-			email := payload[:suffixIdx]
 
-			/*
-			parts := strings.Split(tokenString, "-")
-			if len(parts) < 5 {
-				http.Error(w, "Invalid token format", http.StatusUnauthorized)
+			// Impersonation is for seeing what the user sees. Changes would be logged
+			// under the user's name, so apart from ending it the session is read-only.
+			if principal.Impersonating() && !safeMethod(r.Method) && !impersonationRoutes[r.URL.Path] {
+				http.Error(w, "Forbidden: impersonation sessions are read-only", http.StatusForbidden)
 				return
 			}
-			email := parts[3]
-			*/
 
-			// Check if user is logged in (Kicked status check)
-			var isLoggedIn bool
-			var name string
-			err := db.QueryRow("SELECT IsLoggedIn, Name FROM Users WHERE Email = @p1", email).Scan(&isLoggedIn, &name)
-			if err != nil {
-				// fmt.Printf("AuthMiddleware DB Error for %s: %v\n", email, err)
-				http.Error(w, "User not found or database error", http.StatusUnauthorized)
+			// An impersonating admin cannot change the password, so they are not held to it
+			if principal.MustChangePassword && !principal.Impersonating() && !passwordChangeRoutes[r.URL.Path] {
+				http.Error(w, "Password expired, please change your password", http.StatusForbidden)
 				return
 			}
-			if !isLoggedIn {
-				// fmt.Printf("AuthMiddleware: User %s is not logged in\n", email)
-				http.Error(w, "Session expired or user kicked", http.StatusUnauthorized)
+
+			principal.Permissions, err = permissions.GetPermissionsByEmail(principal.Email)
+			if err != nil {
+				http.Error(w, "Failed to load permissions", http.StatusInternalServerError)
 				return
 			}
 
-			r.Header.Set("X-User-Email", email)
-			r.Header.Set("X-User-Name", name)
-			next(w, r)
+			next(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 		}
 	}
 }
 
-func EnableCORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Accept, Origin, X-Requested-With, Cache-Control")
+// checkNetwork writes a 403 and reports false when userID may not act from the caller's address.
+func checkNetwork(w http.ResponseWriter, r *http.Request, networks NetworkGuard, userID int) bool {
+	err := networks.Check(userID, remoteIP(r), r.Method+" "+r.URL.Path)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, auth.ErrNetworkDenied) {
+		http.Error(w, "Access from your network is not allowed", http.StatusForbidden)
+	} else {
+		http.Error(w, "Failed to check network restrictions", http.StatusInternalServerError)
+	}
+	return false
+}
+
+// passwordChangeRoutes stay reachable while the caller must change an expired password.
+var passwordChangeRoutes = map[string]bool{
+	"/change-password": true,
+	"/logout":          true,
+	"/api/profile":     true,
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// impersonationRoutes accept writes from an impersonation session, to end it.
+var impersonationRoutes = map[string]bool{
+	"/logout":                true,
+	"/api/impersonation/end": true,
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// bearerToken returns the token of an Authorization header, or "" when it carries none.
+func bearerToken(header string) string {
+	if header == "Bearer" {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
 
-		next(w, r)
+func tokenErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "Token expired"
+	case errors.Is(err, auth.ErrInvalidSignature):
+		return "Invalid token signature"
+	case errors.Is(err, auth.ErrLegacyTokenExpired):
+		return "Legacy token format is no longer accepted, please log in again"
+	default:
+		return "Invalid token"
 	}
 }
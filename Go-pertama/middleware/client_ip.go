@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"go-pertama/auth"
+)
+
+// ClientIP puts the real client address into r.RemoteAddr for requests that
+// arrive through a trusted reverse proxy, so rate limits, sessions, network
+// restrictions and logs downstream see the client rather than the proxy.
+type ClientIP struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIP trusts X-Forwarded-For only from the given comma separated CIDR
+// ranges. With none, the header is ignored.
+func NewClientIP(trustedProxies string) (*ClientIP, error) {
+	trusted, err := auth.ParseNetworks(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	return &ClientIP{trusted: trusted}, nil
+}
+
+func (c *ClientIP) Handler(next http.Handler) http.Handler {
+	if len(c.trusted) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := c.forwardedFor(r); ok {
+			r.RemoteAddr = ip.String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor walks X-Forwarded-For from the nearest hop outwards and
+// returns the first address that is not one of our proxies. Anything to the
+// left of it was written by the client and cannot be trusted.
+func (c *ClientIP) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	peer, err := netip.ParseAddr(remoteIP(r))
+	if err != nil || !auth.NetworksContain(c.trusted, peer) {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !auth.NetworksContain(c.trusted, client) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-pertama/config"
+)
+
+// CORS answers cross-origin requests according to config.CORSConfig.
+type CORS struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	subdomains  []wildcardOrigin
+	methods     string
+	headers     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// wildcardOrigin matches "scheme://*.suffix", i.e. any subdomain of suffix but not suffix itself.
+type wildcardOrigin struct {
+	scheme string
+	suffix string // ".example.com", including the port if one was given
+}
+
+func NewCORS(cfg config.CORSConfig) *CORS {
+	c := &CORS{
+		origins:     make(map[string]bool),
+		methods:     cfg.AllowedMethods,
+		headers:     cfg.AllowedHeaders,
+		exposed:     cfg.ExposedHeaders,
+		credentials: cfg.AllowCredentials,
+	}
+	if cfg.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
+	for _, origin := range strings.Split(cfg.AllowedOrigins, ",") {
+		origin = normalizeOrigin(origin)
+		switch {
+		case origin == "":
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "://")
+			c.subdomains = append(c.subdomains, wildcardOrigin{scheme: scheme, suffix: host[1:]})
+		default:
+			c.origins[origin] = true
+		}
+	}
+
+	if c.anyOrigin && c.credentials {
+		log.Println("Warning: CORS_ALLOW_CREDENTIALS is ignored while CORS_ALLOWED_ORIGINS contains *")
+		c.credentials = false
+	}
+	return c
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
+
+func (c *CORS) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = normalizeOrigin(origin)
+	if c.origins[origin] {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	for _, w := range c.subdomains {
+		if scheme == w.scheme && strings.HasSuffix(host, w.suffix) && len(host) > len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler wraps next with CORS headers and answers preflight requests.
+// Requests from origins that are not allowed get no CORS headers, so the
+// browser refuses to hand the response to the calling script.
+func (c *CORS) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !c.anyOrigin {
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin != "" && !c.allowed(origin) {
+			log.Printf("CORS: rejected origin %s for %s %s", origin, r.Method, r.URL.Path)
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		if origin != "" {
+			if c.anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if c.credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			if c.exposed != "" {
+				w.Header().Set("Access-Control-Expose-Headers", c.exposed)
+			}
+		}
+
+		if r.Method == http.MethodOptions {
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", c.methods)
+				w.Header().Set("Access-Control-Allow-Headers", c.headers)
+				if c.maxAge != "" {
+					w.Header().Set("Access-Control-Max-Age", c.maxAge)
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-pertama/auth"
+)
+
+// PermissionLookup resolves the permission codes granted to a user.
+type PermissionLookup interface {
+	GetPermissionsByEmail(email string) ([]string, error)
+}
+
+// RequirePermission rejects requests whose principal lacks any of the given
+// permissions. It must run inside AuthMiddleware.
+func RequirePermission(perms ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			principal := auth.PrincipalFrom(r)
+			if principal == nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			for _, p := range perms {
+				if !principal.HasPermission(p) {
+					http.Error(w, "Forbidden: missing permission "+p, http.StatusForbidden)
+					return
+				}
+			}
+
+			next(w, r)
+		}
+	}
+}
+
+// DenyDuringImpersonation blocks routes that change the user's credentials,
+// such as passwords and two-factor settings, while an admin impersonates them.
+// It must run inside AuthMiddleware.
+func DenyDuringImpersonation(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if principal := auth.PrincipalFrom(r); principal != nil && principal.Impersonating() {
+			http.Error(w, "Forbidden: not allowed while impersonating a user", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-pertama/auth"
+)
+
+// Rate allows Limit requests per Period. Buckets hold up to Limit tokens and
+// refill continuously, so short bursts are allowed but the average is capped.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate reads a rate written as "<requests>/<period>", e.g. "5/1m" or "100/1h".
+func ParseRate(value string) (Rate, error) {
+	count, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected <requests>/<period>", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || limit < 1 {
+		return Rate{}, fmt.Errorf("invalid request count in rate %q", value)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid period in rate %q", value)
+	}
+	return Rate{Limit: limit, Period: d}, nil
+}
+
+// RateLimitResult describes a bucket after a request was counted against it.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, when not Allowed
+}
+
+// RateLimitStore keeps the token buckets. MemoryRateLimitStore is enough for
+// a single instance; several instances behind a load balancer need a shared
+// implementation (e.g. Redis) so that they count against the same buckets.
+type RateLimitStore interface {
+	Take(key string, rate Rate, now time.Time) RateLimitResult
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rate    Rate
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, rate Rate, now time.Time) RateLimitResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	perToken := rate.Period / time.Duration(rate.Limit)
+	b, ok := s.buckets[key]
+	if !ok || b.rate != rate {
+		b = &bucket{tokens: float64(rate.Limit), updated: now, rate: rate}
+		s.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(rate.Limit), b.tokens+float64(now.Sub(b.updated))/float64(perToken))
+		b.updated = now
+	}
+
+	result := RateLimitResult{Limit: rate.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(rate.Limit) - b.tokens) * float64(perToken))
+
+	s.sweep(now)
+	return result
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		perToken := b.rate.Period / time.Duration(b.rate.Limit)
+		if b.tokens+float64(now.Sub(b.updated))/float64(perToken) >= float64(b.rate.Limit) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimitSettings reads the route policies from system_configs.
+type RateLimitSettings interface {
+	GetBool(key string, fallback bool) bool
+	GetString(key string, fallback string) string
+}
+
+// DefaultRateLimitPolicies are used when a policy's "rate_limit_<name>" config
+// is missing. A policy lists a rate per key: ip, email (from the JSON body)
+// and user (the authenticated principal), e.g. "ip=20/1m,email=5/1m".
+var DefaultRateLimitPolicies = map[string]string{
+	"login":          "ip=20/1m,email=5/1m",
+	"mfa":            "ip=10/1m",
+	"refresh":        "ip=60/1m",
+	"password_reset": "ip=10/1m,email=3/15m",
+	"register":       "ip=5/10m,email=3/1h",
+	"invitation":     "ip=10/1m",
+	"sensitive":      "ip=30/1m,user=10/1m",
+}
+
+// RateLimiter throttles requests per route policy with token buckets keyed
+// by client IP, submitted email and authenticated user.
+type RateLimiter struct {
+	store    RateLimitStore
+	settings RateLimitSettings
+}
+
+func NewRateLimiter(store RateLimitStore, settings RateLimitSettings) *RateLimiter {
+	return &RateLimiter{store: store, settings: settings}
+}
+
+type policyRates struct {
+	ip, email, user *Rate
+}
+
+func parsePolicy(value string) (policyRates, error) {
+	var p policyRates
+	if strings.EqualFold(strings.TrimSpace(value), "off") {
+		return p, nil
+	}
+	for _, part := range strings.Split(value, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, rateValue, ok := strings.Cut(part, "=")
+		if !ok {
+			return p, fmt.Errorf("invalid policy entry %q, expected key=<requests>/<period>", part)
+		}
+		rate, err := ParseRate(rateValue)
+		if err != nil {
+			return p, err
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ip":
+			p.ip = &rate
+		case "email":
+			p.email = &rate
+		case "user":
+			p.user = &rate
+		default:
+			return p, fmt.Errorf("unknown rate limit key %q", name)
+		}
+	}
+	return p, nil
+}
+
+// policy loads the configured policy, falling back to the default when the
+// config is missing or cannot be parsed.
+func (l *RateLimiter) policy(name string) policyRates {
+	fallback := DefaultRateLimitPolicies[name]
+	value := l.settings.GetString("rate_limit_"+name, fallback)
+	p, err := parsePolicy(value)
+	if err != nil {
+		log.Printf("Invalid rate_limit_%s %q, using default: %v", name, value, err)
+		p, _ = parsePolicy(fallback)
+	}
+	return p
+}
+
+// Limit applies the named policy. Policies with a user rate must run inside
+// AuthMiddleware; requests without a principal are then limited by IP only.
+func (l *RateLimiter) Limit(name string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions || !l.settings.GetBool("rate_limit_enabled", true) {
+				next(w, r)
+				return
+			}
+
+			p := l.policy(name)
+			now := time.Now()
+			var results []RateLimitResult
+			if p.ip != nil {
+				results = append(results, l.store.Take(name+":ip:"+remoteIP(r), *p.ip, now))
+			}
+			if p.email != nil {
+				if email := requestEmail(r); email != "" {
+					results = append(results, l.store.Take(name+":email:"+email, *p.email, now))
+				}
+			}
+			if p.user != nil {
+				if principal := auth.PrincipalFrom(r); principal != nil {
+					results = append(results, l.store.Take(fmt.Sprintf("%s:user:%d", name, principal.UserID), *p.user, now))
+				}
+			}
+			if len(results) == 0 {
+				next(w, r)
+				return
+			}
+
+			// Report the tightest bucket; a request is refused if any bucket is empty
+			tightest := results[0]
+			for _, res := range results[1:] {
+				if tightest.Allowed && (!res.Allowed || res.Remaining < tightest.Remaining) ||
+					!tightest.Allowed && !res.Allowed && res.RetryAfter > tightest.RetryAfter {
+					tightest = res
+				}
+			}
+			setRateLimitHeaders(w, tightest)
+
+			if !tightest.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(tightest.RetryAfter)))
+				log.Printf("Rate limit %s exceeded by %s on %s", name, remoteIP(r), r.URL.Path)
+				http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, res RateLimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// maxPeekBody bounds how much of a request body is read to find the email.
+const maxPeekBody = 1 << 20
+
+// requestEmail returns the lower-cased "email" field of a JSON body and puts
+// the body back for the handler.
+func requestEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
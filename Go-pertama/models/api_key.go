@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// APIKeyPrefix starts every key so leaked keys are easy to recognise and grep for.
+const APIKeyPrefix = "gpk_"
+
+// APIKey lets a service account call the API with "Authorization: ApiKey <key>".
+// Only the SHA-256 of the key is stored; Prefix identifies it in lists and logs.
+type APIKey struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     int        `gorm:"index;not null" json:"userId"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(20);uniqueIndex;not null" json:"prefix"`
+	KeyHash    string     `gorm:"type:varchar(64);not null" json:"-"`
+	Scopes     []string   `gorm:"serializer:json;type:nvarchar(max)" json:"scopes"` // permission codes the key may use
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `gorm:"type:varchar(45)" json:"lastUsedIp"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedBy  string     `gorm:"type:varchar(100)" json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	UserEmail  string     `gorm:"->;-:migration" json:"userEmail,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	UserID    int        `json:"userId"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type UpdateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// CreateAPIKeyResponse carries the plain key, which is only ever shown here.
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"apiKey"`
+}
@@ -32,13 +32,13 @@ type SystemConfig struct {
 }
 
 type SystemConfigHistory struct {
-	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	ConfigID     int64     `gorm:"index;not null" json:"configId"`
+	ID           int64        `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConfigID     int64        `gorm:"index;not null" json:"configId"`
 	SystemConfig SystemConfig `gorm:"foreignKey:ConfigID" json:"-"`
-	OldValue     string    `gorm:"type:text" json:"oldValue"`
-	NewValue     string    `gorm:"type:text" json:"newValue"`
-	ChangeReason string    `gorm:"type:text" json:"changeReason"`
-	ChangedAt    time.Time `json:"changedAt"`
-	ChangedBy    string    `gorm:"type:varchar(100)" json:"changedBy"`
-	IPAddress    string    `gorm:"type:varchar(50)" json:"ipAddress"`
+	OldValue     string       `gorm:"type:text" json:"oldValue"`
+	NewValue     string       `gorm:"type:text" json:"newValue"`
+	ChangeReason string       `gorm:"type:text" json:"changeReason"`
+	ChangedAt    time.Time    `json:"changedAt"`
+	ChangedBy    string       `gorm:"type:varchar(100)" json:"changedBy"`
+	IPAddress    string       `gorm:"type:varchar(50)" json:"ipAddress"`
 }
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Invitation statuses, derived from the timestamps of an invitation.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation lets someone create their own account with a pre-assigned role
+// through an emailed link. Only the hash of the link's token is stored.
+type Invitation struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Email          string     `gorm:"type:varchar(255);index;not null" json:"email"`
+	Name           string     `gorm:"type:nvarchar(100)" json:"name"`
+	RoleID         int        `gorm:"not null" json:"roleId"`
+	TokenHash      string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	SentAt         time.Time  `json:"sentAt"` // last time the link was emailed
+	InvitedBy      string     `gorm:"type:varchar(100)" json:"invitedBy"`
+	AcceptedAt     *time.Time `json:"acceptedAt"`
+	AcceptedUserID *int       `gorm:"index" json:"acceptedUserId"`
+	RevokedAt      *time.Time `json:"revokedAt"`
+	RevokedBy      string     `gorm:"type:varchar(100)" json:"revokedBy"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	RoleName       string     `gorm:"->;-:migration" json:"roleName,omitempty"`
+	Status         string     `gorm:"-" json:"status"`
+}
+
+// CurrentStatus works out the status from the timestamps.
+func (i *Invitation) CurrentStatus() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(i.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+type CreateInvitationRequest struct {
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	RoleID int    `json:"roleId"`
+	// ExpiresInHours defaults to the invitation_expiry_hours config.
+	ExpiresInHours int `json:"expiresInHours"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type InvitationsResponse struct {
+	Data  []Invitation `json:"data"`
+	Total int64        `json:"total"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// UserMFA holds a user's TOTP enrollment. Enabled stays false until the first code is confirmed.
+type UserMFA struct {
+	UserID       int        `gorm:"primaryKey;autoIncrement:false" json:"userId"`
+	Secret       string     `gorm:"type:varchar(64);not null" json:"-"`
+	Enabled      bool       `gorm:"not null;default:false" json:"enabled"`
+	ConfirmedAt  *time.Time `json:"confirmedAt"`
+	LastUsedStep int64      `gorm:"not null;default:0" json:"-"` // last accepted TOTP step, blocks replays
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
+
+// MFARecoveryCode is a hashed one-time code that can stand in for a TOTP code.
+type MFARecoveryCode struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int        `gorm:"index;not null" json:"userId"`
+	CodeHash  string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// MFAChallenge links a password-verified login to the second step. Only the token hash is stored.
+type MFAChallenge struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int        `gorm:"index;not null" json:"userId"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Attempts  int        `gorm:"not null;default:0" json:"attempts"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type MFAVerifyRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"` // TOTP code or recovery code
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFADisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type MFAStatus struct {
+	Enabled           bool       `json:"enabled"`
+	ConfirmedAt       *time.Time `json:"confirmedAt"`
+	RecoveryCodesLeft int64      `json:"recoveryCodesLeft"`
+}
+
+type MFASetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	ID          int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int        `gorm:"index;not null" json:"userId"`
+	Provider    string     `gorm:"type:varchar(50);uniqueIndex:idx_user_identities_subject;not null" json:"provider"`
+	Subject     string     `gorm:"type:varchar(255);uniqueIndex:idx_user_identities_subject;not null" json:"subject"`
+	Email       string     `gorm:"type:varchar(255)" json:"email"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// OIDCLoginState keeps the PKCE verifier and nonce of an authorization request
+// until the provider redirects back. Only the state hash is stored.
+type OIDCLoginState struct {
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	StateHash    string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Nonce        string     `gorm:"type:varchar(64);not null" json:"-"`
+	CodeVerifier string     `gorm:"type:varchar(128);not null" json:"-"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	UsedAt       *time.Time `json:"usedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// OIDCClaims are the ID token claims used to find or create the local user.
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+}
+
+type OIDCStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Provider string `json:"provider,omitempty"`
+}
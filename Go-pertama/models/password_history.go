@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PasswordHistory keeps previous password hashes so they cannot be reused.
+type PasswordHistory struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       int       `gorm:"index;not null" json:"userId"`
+	PasswordHash string    `gorm:"type:varchar(100);not null" json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use token emailed to the user. Only its hash is stored.
+// Requests for unknown emails are recorded with UserID 0 so they still count toward rate limits.
+type PasswordResetToken struct {
+	ID        int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int        `gorm:"index;not null" json:"userId"`
+	Email     string     `gorm:"type:varchar(255);index;not null" json:"email"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	IPAddress string     `gorm:"type:varchar(50);index" json:"ipAddress"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
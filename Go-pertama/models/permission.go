@@ -0,0 +1,51 @@
+package models
+
+// Permission codes checked by middleware.RequirePermission
+const (
+	PermUsersRead     = "users:read"
+	PermUsersWrite    = "users:write"
+	PermUsersDelete   = "users:delete"
+	PermSessionsRead  = "sessions:read"
+	PermSessionsKick  = "sessions:kick"
+	PermRolesRead     = "roles:read"
+	PermRolesWrite    = "roles:write"
+	PermConfigsRead   = "configs:read"
+	PermConfigsWrite  = "configs:write"
+	PermActivityRead  = "activity:read"
+	PermReportsUpload = "reports:upload"
+	PermAPIKeysRead   = "api-keys:read"
+	PermAPIKeysWrite  = "api-keys:write"
+	PermImpersonate   = "users:impersonate"
+	PermSecurityRead  = "security-events:read"
+	PermSecurityWrite = "security-events:write"
+)
+
+type Permission struct {
+	ID          int    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code        string `gorm:"type:varchar(100);unique;not null" json:"code"`
+	Description string `gorm:"type:text" json:"description"`
+}
+
+// DefaultPermissions is the permission catalogue seeded on startup.
+var DefaultPermissions = []Permission{
+	{Code: PermUsersRead, Description: "View users and their history"},
+	{Code: PermUsersWrite, Description: "Create and update users, reset failed logins"},
+	{Code: PermUsersDelete, Description: "Delete users"},
+	{Code: PermSessionsRead, Description: "View active sessions"},
+	{Code: PermSessionsKick, Description: "Force sessions to log out"},
+	{Code: PermRolesRead, Description: "View roles and permissions"},
+	{Code: PermRolesWrite, Description: "Manage roles and their permissions"},
+	{Code: PermConfigsRead, Description: "View system configs"},
+	{Code: PermConfigsWrite, Description: "Change system configs"},
+	{Code: PermActivityRead, Description: "View and export the system activity log"},
+	{Code: PermReportsUpload, Description: "Upload summary reports"},
+	{Code: PermAPIKeysRead, Description: "View service account API keys"},
+	{Code: PermAPIKeysWrite, Description: "Create, change and revoke API keys"},
+	{Code: PermImpersonate, Description: "Sign in as another user to see what they see"},
+	{Code: PermSecurityRead, Description: "View suspicious login alerts of all users"},
+	{Code: PermSecurityWrite, Description: "Acknowledge suspicious login alerts of all users"},
+}
+
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token; every rotation inside one login shares a FamilyID.
+type RefreshToken struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     int        `gorm:"index;not null" json:"userId"`
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	FamilyID   string     `gorm:"type:varchar(64);index;not null" json:"familyId"`
+	DeviceInfo string     `gorm:"type:varchar(255)" json:"deviceInfo"`
+	IPAddress  string     `gorm:"type:varchar(50)" json:"ipAddress"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	UsedAt     *time.Time `json:"usedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
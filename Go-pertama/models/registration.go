@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Registration states of a self-registered user. Users created any other way
+// have no registration status.
+const (
+	RegistrationUnverified      = "unverified"
+	RegistrationPendingApproval = "pending_approval"
+)
+
+// EmailVerificationToken is a single-use token emailed after self-registration. Only its hash is stored.
+type EmailVerificationToken struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int    `gorm:"index;not null" json:"userId"`
+	TokenHash string `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	// PasswordHash is the password chosen with this sign-up. It becomes the
+	// account's password only when the link is used, so it is always set by
+	// whoever controls the mailbox.
+	PasswordHash string     `gorm:"type:varchar(255);not null;default:''" json:"-"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	UsedAt       *time.Time `json:"usedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	// CaptchaToken is the response of the CAPTCHA widget, if one is configured.
+	CaptchaToken string `json:"captchaToken"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type RejectRegistrationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RegistrationSettings tells the login page whether to offer sign-up.
+type RegistrationSettings struct {
+	Enabled          bool     `json:"enabled"`
+	RequiresApproval bool     `json:"requiresApproval"`
+	AllowedDomains   []string `json:"allowedDomains"`
+	CaptchaSiteKey   string   `json:"captchaSiteKey,omitempty"`
+}
@@ -7,16 +7,21 @@ import (
 )
 
 type Role struct {
-	ID          int            `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name        string         `gorm:"type:varchar(50);unique;not null" json:"name"`
-	Description string         `gorm:"type:text" json:"description"`
-	IsActive    bool           `gorm:"default:true" json:"isActive"`
-	CreatedAt   time.Time      `json:"createdAt"`
-	CreatedBy   string         `gorm:"type:varchar(100)" json:"createdBy"`
-	UpdatedAt   time.Time      `json:"updatedAt"`
-	UpdatedBy   string         `gorm:"type:varchar(100)" json:"updatedBy"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"`
-	UserCount   int64          `gorm:"->;dataType:int" json:"userCount"`
+	ID          int    `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string `gorm:"type:varchar(50);unique;not null" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+	IsActive    bool   `gorm:"default:true" json:"isActive"`
+	// AllowedNetworks and DeniedNetworks are comma separated CIDR ranges the
+	// role's users may (or may not) sign in and make requests from.
+	AllowedNetworks string         `gorm:"type:varchar(1000)" json:"allowedNetworks"`
+	DeniedNetworks  string         `gorm:"type:varchar(1000)" json:"deniedNetworks"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	CreatedBy       string         `gorm:"type:varchar(100)" json:"createdBy"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
+	UpdatedBy       string         `gorm:"type:varchar(100)" json:"updatedBy"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"`
+	UserCount       int64          `gorm:"->;dataType:int" json:"userCount"`
+	Permissions     []Permission   `gorm:"many2many:role_permissions;" json:"permissions,omitempty"`
 }
 
 type RolesResponse struct {
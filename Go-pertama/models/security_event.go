@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Reasons a login is flagged as suspicious.
+const (
+	LoginFlagNewDevice        = "new_device"
+	LoginFlagNewCountry       = "new_country"
+	LoginFlagImpossibleTravel = "impossible_travel"
+)
+
+// KnownDevice is a device a user has signed in from before. Fingerprint is a
+// hash of the user agent (without version numbers) and the network prefix of
+// the address, so browser updates and DHCP renewals do not count as new.
+type KnownDevice struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      int       `gorm:"uniqueIndex:idx_known_devices_user_fingerprint;not null" json:"userId"`
+	Fingerprint string    `gorm:"type:varchar(64);uniqueIndex:idx_known_devices_user_fingerprint;not null" json:"-"`
+	UserAgent   string    `gorm:"type:varchar(255)" json:"userAgent"`
+	IPAddress   string    `gorm:"type:varchar(45)" json:"ipAddress"` // last address seen
+	Country     string    `gorm:"type:varchar(2)" json:"country"`
+	Latitude    *float64  `json:"latitude,omitempty"`
+	Longitude   *float64  `json:"longitude,omitempty"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `gorm:"index" json:"lastSeenAt"`
+}
+
+// SecurityEvent is a flagged login waiting to be reviewed by the user or an admin.
+type SecurityEvent struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID         int        `gorm:"index;not null" json:"userId"`
+	Reasons        []string   `gorm:"serializer:json;type:nvarchar(200)" json:"reasons"`
+	Details        string     `gorm:"type:nvarchar(1000)" json:"details"`
+	IPAddress      string     `gorm:"type:varchar(45)" json:"ipAddress"`
+	UserAgent      string     `gorm:"type:varchar(255)" json:"userAgent"`
+	Country        string     `gorm:"type:varchar(2)" json:"country"`
+	CreatedAt      time.Time  `gorm:"index" json:"createdAt"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	AcknowledgedBy string     `gorm:"type:varchar(100)" json:"acknowledgedBy,omitempty"`
+	UserEmail      string     `gorm:"->;-:migration" json:"userEmail,omitempty"`
+}
+
+type SecurityEventsResponse struct {
+	Data  []SecurityEvent `json:"data"`
+	Total int64           `json:"total"`
+	Page  int             `json:"page"`
+	Limit int             `json:"limit"`
+}
+
+// SecurityEventFilter selects events for the admin list; zero values match everything.
+type SecurityEventFilter struct {
+	UserID int
+	Open   bool // only events not yet acknowledged
+	Page   int
+	Limit  int
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Session is one signed-in device. Its ID is also the refresh token family ID
+// and the "sid" claim of every access token issued for it.
+type Session struct {
+	ID         string     `gorm:"type:varchar(64);primaryKey" json:"sessionId"`
+	UserID     int        `gorm:"index;not null" json:"userId"`
+	IPAddress  string     `gorm:"type:varchar(50)" json:"ipAddress"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"userAgent"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	// ImpersonatorID is the admin who opened this session as UserID through
+	// /api/users/{id}/impersonate; nil for normal logins.
+	ImpersonatorID *int `gorm:"index" json:"impersonatorId,omitempty"`
+}
+
+// SessionInfo is a session joined with its owner, as listed by the API.
+type SessionInfo struct {
+	Session
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Current bool   `gorm:"-" json:"current"`
+}
+
+type KickRequest struct {
+	Email     string `json:"email"`
+	SessionID string `json:"sessionId,omitempty"` // Empty kicks every session of the user
+}
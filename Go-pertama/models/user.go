@@ -10,11 +10,26 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// ClientInfo describes the device a request came from.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
 type LoginResponse struct {
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	Success bool   `json:"success"`
-	User    *User  `json:"user,omitempty"`
+	Message      string     `json:"message"`
+	Token        string     `json:"token,omitempty"`
+	RefreshToken string     `json:"refreshToken,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Success      bool       `json:"success"`
+	User         *User      `json:"user,omitempty"`
+	// MFARequired means the password was correct and ChallengeToken must be
+	// sent with a code to /auth/mfa/verify to finish logging in.
+	MFARequired    bool   `json:"mfaRequired,omitempty"`
+	ChallengeToken string `json:"challengeToken,omitempty"`
+	// CSRFToken is returned instead of the tokens in cookie session mode and
+	// must be sent as X-CSRF-Token on every state-changing request.
+	CSRFToken string `json:"csrfToken,omitempty"`
 }
 
 type User struct {
@@ -31,12 +46,40 @@ type User struct {
 	LastLogin           *time.Time `json:"lastLogin"`
 	LastLogout          *time.Time `json:"lastLogout"`
 	FailedLoginAttempts int        `json:"failedLoginAttempts"`
-	IsLoggedIn          bool       `json:"isLoggedIn"`
-	CreatedBy           string     `json:"createdBy"`
-	UpdatedBy           string     `json:"updatedBy"`
-	Password            string     `json:"-"` // Internal use, don't expose in JSON
+	LockedUntil         *time.Time `json:"lockedUntil"`
+	PasswordChangedAt   *time.Time `json:"passwordChangedAt"`
+	MustChangePassword  bool       `json:"mustChangePassword"`
+	// PlaintextRehashBefore is set by "migrate passwords -mode=rehash" on users
+	// whose stored password is still clear text.
+	PlaintextRehashBefore *time.Time `json:"-"`
+	// IsServiceAccount marks accounts used by scripts through API keys; they cannot log in interactively.
+	IsServiceAccount bool `json:"isServiceAccount"`
+	// AllowedNetworks and DeniedNetworks restrict this user on top of the role's lists.
+	AllowedNetworks string `json:"allowedNetworks"`
+	DeniedNetworks  string `json:"deniedNetworks"`
+	IsLoggedIn      bool   `json:"isLoggedIn"`
+	CreatedBy       string `json:"createdBy"`
+	UpdatedBy       string `json:"updatedBy"`
+	// RegistrationStatus is RegistrationUnverified or RegistrationPendingApproval
+	// while a self-registered user waits to be activated, and empty otherwise.
+	RegistrationStatus string `json:"registrationStatus,omitempty"`
+	// DeletedAt and DeletedBy are only set on users listed from the deleted users view.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	DeletedBy string     `json:"deletedBy,omitempty"`
+	Password  string     `json:"-"` // Internal use, don't expose in JSON
+	// ImpersonatedBy is only set on the profile of an impersonation session.
+	ImpersonatedBy *Impersonator `json:"impersonatedBy,omitempty"`
 }
 
+// Impersonator is the admin acting as a user during impersonation.
+type Impersonator struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// UserHistory is a snapshot of a user taken just before an UPDATE, DELETE or
+// RESTORE by ChangedBy.
 type UserHistory struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"userId"`
@@ -45,9 +88,18 @@ type UserHistory struct {
 	Role      string    `json:"role"`
 	RoleID    int       `json:"roleId"`
 	IsActive  bool      `json:"isActive"`
-	Action    string    `json:"action"` // UPDATE, DELETE
+	Action    string    `json:"action"` // UPDATE, DELETE, RESTORE
 	ChangedBy string    `json:"changedBy"`
 	ChangedAt time.Time `json:"changedAt"`
+	// Changes lists what the action changed, i.e. how this snapshot differs
+	// from the next one (or from the user as it is now).
+	Changes []FieldChange `json:"changes"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
 }
 
 type UsersResponse struct {
@@ -64,6 +116,8 @@ type CreateUserRequest struct {
 	Role     string `json:"role"`
 	RoleID   int    `json:"roleId"`
 	IsActive bool   `json:"isActive"`
+	// IsServiceAccount creates an account for API keys; Password is then ignored.
+	IsServiceAccount bool `json:"isServiceAccount"`
 }
 
 type UpdateUserRequest struct {
@@ -74,6 +128,19 @@ type UpdateUserRequest struct {
 	RoleID   int    `json:"roleId"`
 	IsActive bool   `json:"isActive"`
 	Password string `json:"password,omitempty"` // Optional for update
+	// Network lists are left unchanged when omitted.
+	AllowedNetworks *string `json:"allowedNetworks,omitempty"`
+	DeniedNetworks  *string `json:"deniedNetworks,omitempty"`
+}
+
+// NetworkRules are the network restrictions that apply to one user.
+type NetworkRules struct {
+	Email               string
+	RoleName            string
+	RoleAllowedNetworks string
+	RoleDeniedNetworks  string
+	AllowedNetworks     string
+	DeniedNetworks      string
 }
 
 type ChangePasswordRequest struct {
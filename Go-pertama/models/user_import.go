@@ -0,0 +1,33 @@
+package models
+
+// UserImportRow is one data row of an import file. Row is the line number in
+// the file, counting the header as row 1.
+type UserImportRow struct {
+	Row      int
+	Email    string
+	Name     string
+	Role     string
+	Active   string
+	Password string
+}
+
+// UserImportError explains why a row was skipped. Field is empty when the
+// problem is not tied to one column.
+type UserImportError struct {
+	Row     int    `json:"row"`
+	Email   string `json:"email"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type UserImportResult struct {
+	DryRun  bool              `json:"dryRun"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Skipped int               `json:"skipped"`
+	Errors  []UserImportError `json:"errors"`
+	// ErrorReportURL downloads the rows that failed as a workbook, with an
+	// extra column saying what is wrong. Empty when every row was valid.
+	ErrorReportURL string `json:"errorReportUrl,omitempty"`
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/audit"
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	FindAll(userID int) ([]models.APIKey, error)
+	FindByID(id int64) (*models.APIKey, error)
+	FindByPrefix(prefix string) (*models.APIKey, error)
+	Create(key *models.APIKey) error
+	Update(key *models.APIKey) error
+	Revoke(id int64) error
+	TouchUsage(id int64, ip string) error
+	LogUsage(userID int, keyID int64, action, details string) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (r *apiKeyRepository) withUser() *gorm.DB {
+	return r.db.Model(&models.APIKey{}).
+		Select("api_keys.*, Users.Email AS user_email").
+		Joins("JOIN Users ON Users.ID = api_keys.user_id")
+}
+
+// FindAll lists keys, newest first. userID 0 returns keys of every service account.
+func (r *apiKeyRepository) FindAll(userID int) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	query := r.withUser()
+	if userID > 0 {
+		query = query.Where("api_keys.user_id = ?", userID)
+	}
+	err := query.Order("api_keys.id DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (r *apiKeyRepository) FindByID(id int64) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.withUser().Where("api_keys.id = ?", id).First(&key).Error
+	return &key, err
+}
+
+func (r *apiKeyRepository) FindByPrefix(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Where("prefix = ?", prefix).First(&key).Error
+	return &key, err
+}
+
+func (r *apiKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Omit("UserEmail").Create(key).Error
+}
+
+func (r *apiKeyRepository) Update(key *models.APIKey) error {
+	return r.db.Model(key).Select("Name", "Scopes", "ExpiresAt", "UpdatedAt").Updates(key).Error
+}
+
+func (r *apiKeyRepository) Revoke(id int64) error {
+	return r.db.Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// TouchUsage records the last use, at most once a minute per key.
+func (r *apiKeyRepository) TouchUsage(id int64, ip string) error {
+	return r.db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, time.Now().Add(-time.Minute)).
+		Updates(map[string]interface{}{"last_used_at": time.Now(), "last_used_ip": ip}).Error
+}
+
+// LogUsage writes an ActivityLogs row attributed to the key.
+func (r *apiKeyRepository) LogUsage(userID int, keyID int64, action, details string) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return audit.Append(sqlDB, audit.Entry{UserID: userID, Action: action, Details: details, APIKeyID: &keyID})
+}
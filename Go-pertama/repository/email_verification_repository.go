@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type EmailVerificationRepository interface {
+	Create(token *models.EmailVerificationToken) error
+	FindByHash(hash string) (*models.EmailVerificationToken, error)
+	MarkUsed(id int64) (bool, error)
+	InvalidateForUser(userID int) error
+}
+
+type emailVerificationRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailVerificationRepository(db *gorm.DB) EmailVerificationRepository {
+	return &emailVerificationRepository{db: db}
+}
+
+func (r *emailVerificationRepository) Create(token *models.EmailVerificationToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *emailVerificationRepository) FindByHash(hash string) (*models.EmailVerificationToken, error) {
+	var token models.EmailVerificationToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	return &token, err
+}
+
+// MarkUsed consumes the token. It returns false if it was already used.
+func (r *emailVerificationRepository) MarkUsed(id int64) (bool, error) {
+	result := r.db.Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// InvalidateForUser consumes every outstanding token of the user.
+func (r *emailVerificationRepository) InvalidateForUser(userID int) error {
+	return r.db.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
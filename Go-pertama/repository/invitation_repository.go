@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type InvitationRepository interface {
+	FindAll(status, search string, page, limit int) ([]models.Invitation, int64, error)
+	FindByID(id int64) (*models.Invitation, error)
+	FindByHash(hash string) (*models.Invitation, error)
+	FindPendingByEmail(email string) (*models.Invitation, error)
+	Create(invitation *models.Invitation) error
+	Resend(id int64, tokenHash string, expiresAt time.Time) error
+	Revoke(id int64, revokedBy string) (bool, error)
+	MarkAccepted(id int64) (bool, error)
+	SetAcceptedUser(id int64, userID int) error
+	Reopen(id int64) error
+}
+
+type invitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) InvitationRepository {
+	return &invitationRepository{db: db}
+}
+
+func (r *invitationRepository) withRole() *gorm.DB {
+	return r.db.Model(&models.Invitation{}).
+		Select("invitations.*, roles.name AS role_name").
+		Joins("LEFT JOIN roles ON roles.id = invitations.role_id")
+}
+
+// FindAll lists invitations, newest first. status is one of the
+// models.Invitation* statuses or empty for all of them.
+func (r *invitationRepository) FindAll(status, search string, page, limit int) ([]models.Invitation, int64, error) {
+	now := time.Now()
+	where := func(query *gorm.DB) *gorm.DB {
+		switch status {
+		case models.InvitationPending:
+			query = query.Where("invitations.accepted_at IS NULL AND invitations.revoked_at IS NULL AND invitations.expires_at > ?", now)
+		case models.InvitationAccepted:
+			query = query.Where("invitations.accepted_at IS NOT NULL")
+		case models.InvitationRevoked:
+			query = query.Where("invitations.accepted_at IS NULL AND invitations.revoked_at IS NOT NULL")
+		case models.InvitationExpired:
+			query = query.Where("invitations.accepted_at IS NULL AND invitations.revoked_at IS NULL AND invitations.expires_at <= ?", now)
+		}
+		if search != "" {
+			query = query.Where("(invitations.email LIKE ? OR invitations.name LIKE ?)", "%"+search+"%", "%"+search+"%")
+		}
+		return query
+	}
+
+	var total int64
+	if err := where(r.db.Model(&models.Invitation{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	invitations := []models.Invitation{}
+	err := where(r.withRole()).Order("invitations.id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&invitations).Error
+	return invitations, total, err
+}
+
+func (r *invitationRepository) FindByID(id int64) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.withRole().Where("invitations.id = ?", id).First(&invitation).Error
+	return &invitation, err
+}
+
+func (r *invitationRepository) FindByHash(hash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.withRole().Where("invitations.token_hash = ?", hash).First(&invitation).Error
+	return &invitation, err
+}
+
+func (r *invitationRepository) FindPendingByEmail(email string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", email, time.Now()).
+		First(&invitation).Error
+	return &invitation, err
+}
+
+func (r *invitationRepository) Create(invitation *models.Invitation) error {
+	return r.db.Omit("RoleName").Create(invitation).Error
+}
+
+// Resend replaces the token, so links sent before stop working.
+func (r *invitationRepository) Resend(id int64, tokenHash string, expiresAt time.Time) error {
+	return r.db.Model(&models.Invitation{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"token_hash": tokenHash, "expires_at": expiresAt, "sent_at": time.Now()}).Error
+}
+
+// Revoke returns false if the invitation was already accepted or revoked.
+func (r *invitationRepository) Revoke(id int64, revokedBy string) (bool, error) {
+	result := r.db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by": revokedBy})
+	return result.RowsAffected == 1, result.Error
+}
+
+// MarkAccepted consumes the invitation. It returns false if it was already
+// accepted or revoked.
+func (r *invitationRepository) MarkAccepted(id int64) (bool, error) {
+	result := r.db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+		Update("accepted_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *invitationRepository) SetAcceptedUser(id int64, userID int) error {
+	return r.db.Model(&models.Invitation{}).Where("id = ?", id).Update("accepted_user_id", userID).Error
+}
+
+// Reopen undoes MarkAccepted when the account could not be created.
+func (r *invitationRepository) Reopen(id int64) error {
+	return r.db.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_user_id IS NULL", id).
+		Update("accepted_at", nil).Error
+}
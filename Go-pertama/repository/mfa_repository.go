@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type MFARepository interface {
+	FindByUserID(userID int) (*models.UserMFA, error)
+	Save(mfa *models.UserMFA) error
+	Delete(userID int) error
+	UseStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, hashes []string) error
+	UseRecoveryCode(userID int, hash string) (bool, error)
+	CountRecoveryCodes(userID int) (int64, error)
+	CreateChallenge(challenge *models.MFAChallenge) error
+	FindChallenge(hash string) (*models.MFAChallenge, error)
+	IncrementChallengeAttempts(id int64) error
+	UseChallenge(id int64) (bool, error)
+}
+
+type mfaRepository struct {
+	db *gorm.DB
+}
+
+func NewMFARepository(db *gorm.DB) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) FindByUserID(userID int) (*models.UserMFA, error) {
+	var mfa models.UserMFA
+	err := r.db.Where("user_id = ?", userID).First(&mfa).Error
+	return &mfa, err
+}
+
+func (r *mfaRepository) Save(mfa *models.UserMFA) error {
+	return r.db.Save(mfa).Error
+}
+
+// Delete removes the enrollment together with its recovery codes.
+func (r *mfaRepository) Delete(userID int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserMFA{}).Error
+	})
+}
+
+// UseStep records an accepted TOTP step. It returns false if that step (or a
+// later one) was already used, so a code cannot be replayed.
+func (r *mfaRepository) UseStep(userID int, step int64) (bool, error) {
+	result := r.db.Model(&models.UserMFA{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *mfaRepository) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]models.MFARecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = models.MFARecoveryCode{UserID: userID, CodeHash: hash, CreatedAt: time.Now()}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *mfaRepository) UseRecoveryCode(userID int, hash string) (bool, error) {
+	result := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *mfaRepository) CountRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *mfaRepository) CreateChallenge(challenge *models.MFAChallenge) error {
+	return r.db.Create(challenge).Error
+}
+
+func (r *mfaRepository) FindChallenge(hash string) (*models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := r.db.Where("token_hash = ?", hash).First(&challenge).Error
+	return &challenge, err
+}
+
+func (r *mfaRepository) IncrementChallengeAttempts(id int64) error {
+	return r.db.Model(&models.MFAChallenge{}).
+		Where("id = ?", id).
+		Update("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *mfaRepository) UseChallenge(id int64) (bool, error) {
+	result := r.db.Model(&models.MFAChallenge{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type OIDCRepository interface {
+	FindIdentity(provider, subject string) (*models.UserIdentity, error)
+	CreateIdentity(identity *models.UserIdentity) error
+	TouchIdentity(id int64) error
+	CreateState(state *models.OIDCLoginState) error
+	TakeState(hash string) (*models.OIDCLoginState, error)
+}
+
+type oidcRepository struct {
+	db *gorm.DB
+}
+
+func NewOIDCRepository(db *gorm.DB) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+func (r *oidcRepository) FindIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	return &identity, err
+}
+
+func (r *oidcRepository) CreateIdentity(identity *models.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *oidcRepository) TouchIdentity(id int64) error {
+	return r.db.Model(&models.UserIdentity{}).Where("id = ?", id).Update("last_login_at", time.Now()).Error
+}
+
+func (r *oidcRepository) CreateState(state *models.OIDCLoginState) error {
+	return r.db.Create(state).Error
+}
+
+// TakeState returns the login state and marks it used in one step, so a
+// callback can only be completed once. It returns gorm.ErrRecordNotFound for
+// unknown or already used states.
+func (r *oidcRepository) TakeState(hash string) (*models.OIDCLoginState, error) {
+	var state models.OIDCLoginState
+	if err := r.db.Where("state_hash = ? AND used_at IS NULL", hash).First(&state).Error; err != nil {
+		return nil, err
+	}
+	result := r.db.Model(&models.OIDCLoginState{}).
+		Where("id = ? AND used_at IS NULL", state.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &state, nil
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type PasswordHistoryRepository interface {
+	Add(entry *models.PasswordHistory) error
+	Recent(userID int, limit int) ([]models.PasswordHistory, error)
+	Prune(userID int, keep int) error
+}
+
+type passwordHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return &passwordHistoryRepository{db: db}
+}
+
+func (r *passwordHistoryRepository) Add(entry *models.PasswordHistory) error {
+	return r.db.Create(entry).Error
+}
+
+func (r *passwordHistoryRepository) Recent(userID int, limit int) ([]models.PasswordHistory, error) {
+	var entries []models.PasswordHistory
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// Prune deletes everything but the newest keep entries of the user.
+func (r *passwordHistoryRepository) Prune(userID int, keep int) error {
+	return r.db.Exec(`DELETE FROM password_histories WHERE user_id = ? AND id NOT IN
+		(SELECT TOP (?) id FROM password_histories WHERE user_id = ? ORDER BY id DESC)`, userID, keep, userID).Error
+}
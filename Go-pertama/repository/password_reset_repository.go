@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository interface {
+	Create(token *models.PasswordResetToken) error
+	FindByHash(hash string) (*models.PasswordResetToken, error)
+	MarkUsed(id int64) (bool, error)
+	InvalidateForUser(userID int) error
+	CountByEmailSince(email string, since time.Time) (int64, error)
+	CountByIPSince(ip string, since time.Time) (int64, error)
+}
+
+type passwordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) PasswordResetRepository {
+	return &passwordResetRepository{db: db}
+}
+
+func (r *passwordResetRepository) Create(token *models.PasswordResetToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *passwordResetRepository) FindByHash(hash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	return &token, err
+}
+
+// MarkUsed consumes the token. It returns false if it was already used.
+func (r *passwordResetRepository) MarkUsed(id int64) (bool, error) {
+	result := r.db.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+// InvalidateForUser consumes every outstanding token of the user.
+func (r *passwordResetRepository) InvalidateForUser(userID int) error {
+	return r.db.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
+
+func (r *passwordResetRepository) CountByEmailSince(email string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PasswordResetToken{}).
+		Where("email = ? AND created_at >= ?", email, since).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *passwordResetRepository) CountByIPSince(ip string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PasswordResetToken{}).
+		Where("ip_address = ? AND created_at >= ?", ip, since).
+		Count(&count).Error
+	return count, err
+}
@@ -9,9 +9,15 @@ import (
 type RoleRepository interface {
 	FindAll(page, limit int, search string) ([]models.Role, int64, error)
 	FindByID(id int) (*models.Role, error)
+	FindByName(name string) (*models.Role, error)
 	Create(role *models.Role) error
 	Update(role *models.Role) error
 	Delete(id int) error
+	FindAllPermissions() ([]models.Permission, error)
+	FindPermissionsByCodes(codes []string) ([]models.Permission, error)
+	GetPermissions(roleID int) ([]models.Permission, error)
+	ReplacePermissions(role *models.Role, permissions []models.Permission) error
+	GetPermissionCodesByEmail(email string) ([]string, error)
 }
 
 type roleRepository struct {
@@ -42,7 +48,7 @@ func (r *roleRepository) FindAll(page, limit int, search string) ([]models.Role,
 
 	// Select all role columns and count of users
 	// Use Model to ensure correct table mapping and deleted_at check
-	err = query.Select("roles.*, (SELECT COUNT(*) FROM Users WHERE Users.RoleID = roles.id) as user_count").
+	err = query.Select("roles.*, (SELECT COUNT(*) FROM Users WHERE Users.RoleID = roles.id AND Users.DeletedAt IS NULL) as user_count").
 		Offset(offset).Limit(limit).
 		Scan(&roles).Error
 
@@ -58,6 +64,12 @@ func (r *roleRepository) FindByID(id int) (*models.Role, error) {
 	return &role, err
 }
 
+func (r *roleRepository) FindByName(name string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.Where("name = ?", name).First(&role).Error
+	return &role, err
+}
+
 func (r *roleRepository) Create(role *models.Role) error {
 	return r.db.Create(role).Error
 }
@@ -69,3 +81,41 @@ func (r *roleRepository) Update(role *models.Role) error {
 func (r *roleRepository) Delete(id int) error {
 	return r.db.Delete(&models.Role{}, id).Error
 }
+
+func (r *roleRepository) FindAllPermissions() ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.Order("code").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *roleRepository) FindPermissionsByCodes(codes []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(codes) == 0 {
+		return permissions, nil
+	}
+	err := r.db.Where("code IN ?", codes).Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *roleRepository) GetPermissions(roleID int) ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := r.db.Model(&models.Role{ID: roleID}).Association("Permissions").Find(&permissions)
+	return permissions, err
+}
+
+func (r *roleRepository) ReplacePermissions(role *models.Role, permissions []models.Permission) error {
+	return r.db.Model(role).Association("Permissions").Replace(permissions)
+}
+
+// GetPermissionCodesByEmail resolves the permissions granted to a user through their active role.
+func (r *roleRepository) GetPermissionCodesByEmail(email string) ([]string, error) {
+	var codes []string
+	err := r.db.Table("permissions").
+		Select("permissions.code").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id AND roles.deleted_at IS NULL AND roles.is_active = 1").
+		Joins("JOIN Users ON Users.RoleID = roles.id").
+		Where("Users.Email = ? AND Users.DeletedAt IS NULL", email).
+		Pluck("permissions.code", &codes).Error
+	return codes, err
+}
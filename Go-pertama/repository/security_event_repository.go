@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type SecurityEventRepository interface {
+	FindDevice(userID int, fingerprint string) (*models.KnownDevice, error)
+	LastDevice(userID int) (*models.KnownDevice, error)
+	CountDevices(userID int) (int64, error)
+	KnownCountries(userID int) ([]string, error)
+	SaveDevice(device *models.KnownDevice) error
+	CreateEvent(event *models.SecurityEvent) error
+	FindEvent(id int64) (*models.SecurityEvent, error)
+	ListEvents(filter models.SecurityEventFilter) ([]models.SecurityEvent, int64, error)
+	Acknowledge(id int64, by string) (bool, error)
+}
+
+type securityEventRepository struct {
+	db *gorm.DB
+}
+
+func NewSecurityEventRepository(db *gorm.DB) SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+func (r *securityEventRepository) FindDevice(userID int, fingerprint string) (*models.KnownDevice, error) {
+	var device models.KnownDevice
+	err := r.db.Where("user_id = ? AND fingerprint = ?", userID, fingerprint).First(&device).Error
+	return &device, err
+}
+
+// LastDevice returns the device the user signed in from most recently.
+func (r *securityEventRepository) LastDevice(userID int) (*models.KnownDevice, error) {
+	var device models.KnownDevice
+	err := r.db.Where("user_id = ?", userID).Order("last_seen_at DESC").First(&device).Error
+	return &device, err
+}
+
+func (r *securityEventRepository) CountDevices(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.KnownDevice{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *securityEventRepository) KnownCountries(userID int) ([]string, error) {
+	var countries []string
+	err := r.db.Model(&models.KnownDevice{}).
+		Where("user_id = ? AND country <> ''", userID).
+		Distinct().Pluck("country", &countries).Error
+	return countries, err
+}
+
+func (r *securityEventRepository) SaveDevice(device *models.KnownDevice) error {
+	return r.db.Save(device).Error
+}
+
+func (r *securityEventRepository) CreateEvent(event *models.SecurityEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r *securityEventRepository) withUser() *gorm.DB {
+	return r.db.Model(&models.SecurityEvent{}).
+		Select("security_events.*, Users.Email AS user_email").
+		Joins("JOIN Users ON Users.ID = security_events.user_id")
+}
+
+func (r *securityEventRepository) FindEvent(id int64) (*models.SecurityEvent, error) {
+	var event models.SecurityEvent
+	err := r.withUser().Where("security_events.id = ?", id).First(&event).Error
+	return &event, err
+}
+
+func (r *securityEventRepository) ListEvents(filter models.SecurityEventFilter) ([]models.SecurityEvent, int64, error) {
+	where := func(query *gorm.DB) *gorm.DB {
+		if filter.UserID > 0 {
+			query = query.Where("security_events.user_id = ?", filter.UserID)
+		}
+		if filter.Open {
+			query = query.Where("security_events.acknowledged_at IS NULL")
+		}
+		return query
+	}
+
+	var total int64
+	if err := where(r.db.Model(&models.SecurityEvent{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []models.SecurityEvent
+	err := where(r.withUser()).Order("security_events.created_at DESC").
+		Offset((filter.Page - 1) * filter.Limit).Limit(filter.Limit).
+		Find(&events).Error
+	return events, total, err
+}
+
+// Acknowledge marks an open event as reviewed. It reports false when the
+// event was already acknowledged.
+func (r *securityEventRepository) Acknowledge(id int64, by string) (bool, error) {
+	res := r.db.Model(&models.SecurityEvent{}).
+		Where("id = ? AND acknowledged_at IS NULL", id).
+		Updates(map[string]interface{}{"acknowledged_at": time.Now(), "acknowledged_by": by})
+	return res.RowsAffected > 0, res.Error
+}
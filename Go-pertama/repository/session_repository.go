@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"time"
+
+	"go-pertama/models"
+
+	"gorm.io/gorm"
+)
+
+type SessionRepository interface {
+	Create(session *models.Session) error
+	FindByID(id string) (*models.Session, error)
+	Extend(id string, expiresAt time.Time) error
+	Revoke(id string) error
+	RevokeAllForUser(userID int) error
+	CountActiveForUser(userID int) (int64, error)
+	ListActive() ([]models.SessionInfo, error)
+	ListActiveForUser(userID int) ([]models.SessionInfo, error)
+}
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *models.Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) FindByID(id string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("id = ?", id).First(&session).Error
+	return &session, err
+}
+
+func (r *sessionRepository) Extend(id string, expiresAt time.Time) error {
+	return r.db.Model(&models.Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"expires_at": expiresAt, "last_seen_at": time.Now()}).Error
+}
+
+func (r *sessionRepository) Revoke(id string) error {
+	return r.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) RevokeAllForUser(userID int) error {
+	return r.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *sessionRepository) CountActiveForUser(userID int) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Session{}).
+		Where("user_id = ? AND impersonator_id IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *sessionRepository) ListActive() ([]models.SessionInfo, error) {
+	return r.listActive(r.db)
+}
+
+// ListActiveForUser returns the user's own sessions; impersonations of the user
+// are left out, they are not the user's devices.
+func (r *sessionRepository) ListActiveForUser(userID int) ([]models.SessionInfo, error) {
+	return r.listActive(r.db.Where("sessions.user_id = ? AND sessions.impersonator_id IS NULL", userID))
+}
+
+func (r *sessionRepository) listActive(query *gorm.DB) ([]models.SessionInfo, error) {
+	sessions := []models.SessionInfo{}
+	err := query.Model(&models.Session{}).
+		Select("sessions.*, Users.Email AS email, Users.Name AS name, COALESCE(Roles.Name, Users.Role) AS role").
+		Joins("JOIN Users ON Users.ID = sessions.user_id").
+		Joins("LEFT JOIN Roles ON Roles.ID = Users.RoleID").
+		Where("sessions.revoked_at IS NULL AND sessions.expires_at > ? AND Users.DeletedAt IS NULL", time.Now()).
+		Order("sessions.last_seen_at DESC").
+		Scan(&sessions).Error
+	return sessions, err
+}
@@ -3,7 +3,10 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+	"go-pertama/audit"
 	"go-pertama/models"
+	"log"
+	"time"
 )
 
 type UserRepository interface {
@@ -12,12 +15,20 @@ type UserRepository interface {
 	Create(user *models.User) error
 	Update(user *models.User) error
 	Delete(id int, deletedBy string) error
+	GetDeleted(page, limit int, search string) ([]models.User, int, error)
+	GetDeletedByID(id int) (*models.User, error)
+	Restore(id int, restoredBy string) error
+	PurgeDeleted(before time.Time) ([]string, error)
 	GetAll(page, limit int, search string, roleID int) ([]models.User, int, error)
 	UpdatePassword(id int, hashedPassword string) error
 	UpdatePasswordByEmail(email string, hashedPassword string) error
+	ChangePassword(id int, hashedPassword string) error
+	SetMustChangePassword(id int, mustChange bool) error
 	UpdateLastLogin(id int) error
 	UpdateLastLogout(email string) error
-	UpdateFailedAttempts(id int, attempts int) error
+	IncrementFailedAttempts(id int) (int, error)
+	LockUntil(id int, lockedUntil time.Time) error
+	UpdateLockout(id int, attempts int, lockedUntil *time.Time) error
 	UpdateProfilePicture(email string, filename string) error
 	UpdateAvatar(email string, avatar []byte, avatarType string) error
 	GetAvatar(email string) ([]byte, string, error)
@@ -28,8 +39,15 @@ type UserRepository interface {
 	GetActivityLogs(userID int, limit int, offset int) ([]models.ActivityLog, error)
 	GetAllActivityLogs(limit, offset int, search string, userID int, startDate, endDate string) ([]models.ActivityLog, int, error)
 	UpdateLoginStatus(email string, isLoggedIn bool) error
-	GetActiveUsers() ([]models.User, error)
 	GetUserHistory(userID int) ([]models.UserHistory, error)
+	GetHistoryEntry(historyID int) (*models.UserHistory, error)
+	EmailTakenByOther(email string, userID int) (bool, error)
+	ApplySnapshot(entry *models.UserHistory, restoredBy string) error
+	Recreate(entry *models.UserHistory, hashedPassword, restoredBy string) error
+	GetNetworkRules(userID int) (*models.NetworkRules, error)
+	CreateRegistration(user *models.User) (int, error)
+	UpdateRegistrationStatus(id int, from, to string, activate bool, updatedBy string) error
+	GetRegistrations(status string, page, limit int) ([]models.User, int, error)
 }
 
 type userRepository struct {
@@ -44,16 +62,16 @@ func (r *userRepository) GetByEmail(email string) (*models.User, error) {
 	var u models.User
 	var pp sql.NullString
 	var avatarType sql.NullString
-	var lastLogin, lastLogout sql.NullTime
+	var lastLogin, lastLogout, lockedUntil, passwordChangedAt, rehashBefore sql.NullTime
 	var roleID sql.NullInt64
 	var createdBy, updatedBy sql.NullString
 
-	query := `SELECT u.ID, u.Email, u.Password, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.ProfilePicture, u.AvatarType, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.IsLoggedIn, u.CreatedBy, u.UpdatedBy
+	query := `SELECT u.ID, u.Email, u.Password, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.ProfilePicture, u.AvatarType, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.LockedUntil, u.PasswordChangedAt, u.MustChangePassword, u.PlaintextRehashBefore, u.IsServiceAccount, COALESCE(u.AllowedNetworks, ''), COALESCE(u.DeniedNetworks, ''), COALESCE(u.RegistrationStatus, ''), u.IsLoggedIn, u.CreatedBy, u.UpdatedBy
 			  FROM Users u 
 			  LEFT JOIN Roles r ON u.RoleID = r.ID 
-			  WHERE u.Email = @p1`
+			  WHERE u.Email = @p1 AND u.DeletedAt IS NULL`
 	err := r.db.QueryRow(query, email).Scan(
-		&u.ID, &u.Email, &u.Password, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &avatarType, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &u.IsLoggedIn, &createdBy, &updatedBy,
+		&u.ID, &u.Email, &u.Password, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &avatarType, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &lockedUntil, &passwordChangedAt, &u.MustChangePassword, &rehashBefore, &u.IsServiceAccount, &u.AllowedNetworks, &u.DeniedNetworks, &u.RegistrationStatus, &u.IsLoggedIn, &createdBy, &updatedBy,
 	)
 	if err != nil {
 		return nil, err
@@ -74,6 +92,15 @@ func (r *userRepository) GetByEmail(email string) (*models.User, error) {
 	if lastLogout.Valid {
 		u.LastLogout = &lastLogout.Time
 	}
+	if lockedUntil.Valid {
+		u.LockedUntil = &lockedUntil.Time
+	}
+	if passwordChangedAt.Valid {
+		u.PasswordChangedAt = &passwordChangedAt.Time
+	}
+	if rehashBefore.Valid {
+		u.PlaintextRehashBefore = &rehashBefore.Time
+	}
 	if createdBy.Valid {
 		u.CreatedBy = createdBy.String
 	}
@@ -85,7 +112,7 @@ func (r *userRepository) GetByEmail(email string) (*models.User, error) {
 }
 
 func (r *userRepository) GetUserHistory(userID int) ([]models.UserHistory, error) {
-	query := `SELECT ID, UserID, Email, Name, Role, RoleID, IsActive, Action, ChangedBy, ChangedAt FROM UserHistory WHERE UserID = @p1 ORDER BY ChangedAt DESC`
+	query := `SELECT ID, UserID, Email, Name, Role, RoleID, IsActive, Action, ChangedBy, ChangedAt FROM UserHistory WHERE UserID = @p1 ORDER BY ChangedAt DESC, ID DESC`
 	rows, err := r.db.Query(query, userID)
 	if err != nil {
 		return nil, err
@@ -110,16 +137,16 @@ func (r *userRepository) GetUserHistory(userID int) ([]models.UserHistory, error
 func (r *userRepository) GetByID(id int) (*models.User, error) {
 	var u models.User
 	var pp sql.NullString
-	var lastLogin, lastLogout sql.NullTime
+	var lastLogin, lastLogout, lockedUntil, passwordChangedAt, rehashBefore sql.NullTime
 	var roleID sql.NullInt64
 	var createdBy, updatedBy sql.NullString
 
-	query := `SELECT u.ID, u.Email, u.Password, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.ProfilePicture, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.IsLoggedIn, u.CreatedBy, u.UpdatedBy
+	query := `SELECT u.ID, u.Email, u.Password, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.ProfilePicture, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.LockedUntil, u.PasswordChangedAt, u.MustChangePassword, u.PlaintextRehashBefore, u.IsServiceAccount, COALESCE(u.AllowedNetworks, ''), COALESCE(u.DeniedNetworks, ''), COALESCE(u.RegistrationStatus, ''), u.IsLoggedIn, u.CreatedBy, u.UpdatedBy
 			  FROM Users u 
 			  LEFT JOIN Roles r ON u.RoleID = r.ID 
-			  WHERE u.ID = @p1`
+			  WHERE u.ID = @p1 AND u.DeletedAt IS NULL`
 	err := r.db.QueryRow(query, id).Scan(
-		&u.ID, &u.Email, &u.Password, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &u.IsLoggedIn, &createdBy, &updatedBy,
+		&u.ID, &u.Email, &u.Password, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &lockedUntil, &passwordChangedAt, &u.MustChangePassword, &rehashBefore, &u.IsServiceAccount, &u.AllowedNetworks, &u.DeniedNetworks, &u.RegistrationStatus, &u.IsLoggedIn, &createdBy, &updatedBy,
 	)
 	if err != nil {
 		return nil, err
@@ -137,6 +164,15 @@ func (r *userRepository) GetByID(id int) (*models.User, error) {
 	if lastLogout.Valid {
 		u.LastLogout = &lastLogout.Time
 	}
+	if lockedUntil.Valid {
+		u.LockedUntil = &lockedUntil.Time
+	}
+	if passwordChangedAt.Valid {
+		u.PasswordChangedAt = &passwordChangedAt.Time
+	}
+	if rehashBefore.Valid {
+		u.PlaintextRehashBefore = &rehashBefore.Time
+	}
 	if createdBy.Valid {
 		u.CreatedBy = createdBy.String
 	}
@@ -147,14 +183,28 @@ func (r *userRepository) GetByID(id int) (*models.User, error) {
 	return &u, nil
 }
 
+// GetNetworkRules returns the user's own network lists together with those of their role.
+func (r *userRepository) GetNetworkRules(userID int) (*models.NetworkRules, error) {
+	var rules models.NetworkRules
+	err := r.db.QueryRow(`SELECT u.Email, COALESCE(r.Name, u.Role, ''), COALESCE(r.allowed_networks, ''), COALESCE(r.denied_networks, ''),
+			COALESCE(u.AllowedNetworks, ''), COALESCE(u.DeniedNetworks, '')
+		FROM Users u
+		LEFT JOIN Roles r ON u.RoleID = r.ID
+		WHERE u.ID = @p1 AND u.DeletedAt IS NULL`, userID).Scan(&rules.Email, &rules.RoleName, &rules.RoleAllowedNetworks, &rules.RoleDeniedNetworks, &rules.AllowedNetworks, &rules.DeniedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
 func (r *userRepository) Create(user *models.User) error {
-	query := `INSERT INTO Users (Email, Password, Name, Role, RoleID, IsActive, CreatedAt, CreatedBy) 
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, GETDATE(), @p7)`
+	query := `INSERT INTO Users (Email, Password, Name, Role, RoleID, IsActive, IsServiceAccount, CreatedAt, CreatedBy) 
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, GETDATE(), @p8)`
 	var roleID interface{} = user.RoleID
 	if user.RoleID == 0 {
 		roleID = nil
 	}
-	_, err := r.db.Exec(query, user.Email, user.Password, user.Name, user.Role, roleID, user.IsActive, user.CreatedBy)
+	_, err := r.db.Exec(query, user.Email, user.Password, user.Name, user.Role, roleID, user.IsActive, user.IsServiceAccount, user.CreatedBy)
 	return err
 }
 
@@ -173,12 +223,12 @@ func (r *userRepository) Update(user *models.User) error {
 	}
 
 	// 2. Update user
-	query := `UPDATE Users SET Name=@p1, Role=@p2, RoleID=@p3, IsActive=@p4, Email=@p5, UpdatedBy=@p6, UpdatedAt=GETDATE() WHERE ID=@p7`
+	query := `UPDATE Users SET Name=@p1, Role=@p2, RoleID=@p3, IsActive=@p4, Email=@p5, UpdatedBy=@p6, AllowedNetworks=@p7, DeniedNetworks=@p8, UpdatedAt=GETDATE() WHERE ID=@p9 AND DeletedAt IS NULL`
 	var roleID interface{} = user.RoleID
 	if user.RoleID == 0 {
 		roleID = nil
 	}
-	_, err = r.db.Exec(query, user.Name, user.Role, roleID, user.IsActive, user.Email, user.UpdatedBy, user.ID)
+	_, err = r.db.Exec(query, user.Name, user.Role, roleID, user.IsActive, user.Email, user.UpdatedBy, user.AllowedNetworks, user.DeniedNetworks, user.ID)
 	return err
 }
 
@@ -196,14 +246,20 @@ func (r *userRepository) Delete(id int, deletedBy string) error {
 		r.db.Exec(histQuery, currentUser.ID, currentUser.Email, currentUser.Name, currentUser.Role, histRoleID, currentUser.IsActive, deletedBy)
 	}
 
-	// 2. Delete user
-	_, err = r.db.Exec("DELETE FROM Users WHERE ID = @p1", id)
-	return err
+	// 2. Mark the user deleted; the row stays so activity logs keep their names until it is purged
+	res, err := r.db.Exec("UPDATE Users SET DeletedAt = GETDATE(), DeletedBy = @p1, IsLoggedIn = 0 WHERE ID = @p2 AND DeletedAt IS NULL", deletedBy, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func (r *userRepository) GetAll(page, limit int, search string, roleID int) ([]models.User, int, error) {
 	offset := (page - 1) * limit
-	whereClause := "WHERE 1=1"
+	whereClause := "WHERE u.DeletedAt IS NULL"
 	params := []interface{}{}
 
 	if search != "" {
@@ -226,7 +282,7 @@ func (r *userRepository) GetAll(page, limit int, search string, roleID int) ([]m
 	}
 
 	// Get Data
-	query := fmt.Sprintf(`SELECT u.ID, u.Email, u.Name, r.Name, u.RoleID, u.IsActive, u.ProfilePicture, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.CreatedBy, u.UpdatedBy 
+	query := fmt.Sprintf(`SELECT u.ID, u.Email, u.Name, r.Name, u.RoleID, u.IsActive, u.ProfilePicture, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.LockedUntil, u.IsServiceAccount, COALESCE(u.AllowedNetworks, ''), COALESCE(u.DeniedNetworks, ''), u.CreatedBy, u.UpdatedBy 
 						  FROM Users u 
 						  LEFT JOIN Roles r ON u.RoleID = r.ID 
 						  %s ORDER BY u.ID DESC OFFSET %d ROWS FETCH NEXT %d ROWS ONLY`, whereClause, offset, limit)
@@ -241,11 +297,11 @@ func (r *userRepository) GetAll(page, limit int, search string, roleID int) ([]m
 	for rows.Next() {
 		var u models.User
 		var pp sql.NullString
-		var lastLogin, lastLogout sql.NullTime
+		var lastLogin, lastLogout, lockedUntil sql.NullTime
 		var roleID sql.NullInt64
 		var createdBy, updatedBy sql.NullString
 
-		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &createdBy, &updatedBy); err != nil {
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &lockedUntil, &u.IsServiceAccount, &u.AllowedNetworks, &u.DeniedNetworks, &createdBy, &updatedBy); err != nil {
 			continue
 		}
 		if roleID.Valid {
@@ -260,6 +316,9 @@ func (r *userRepository) GetAll(page, limit int, search string, roleID int) ([]m
 		if lastLogout.Valid {
 			u.LastLogout = &lastLogout.Time
 		}
+		if lockedUntil.Valid {
+			u.LockedUntil = &lockedUntil.Time
+		}
 		if createdBy.Valid {
 			u.CreatedBy = createdBy.String
 		}
@@ -272,45 +331,77 @@ func (r *userRepository) GetAll(page, limit int, search string, roleID int) ([]m
 	return users, total, nil
 }
 
+// UpdatePassword swaps the stored hash for the same password, e.g. when rehashing.
 func (r *userRepository) UpdatePassword(id int, hashedPassword string) error {
-	_, err := r.db.Exec("UPDATE Users SET Password = @p1 WHERE ID = @p2", hashedPassword, id)
+	_, err := r.db.Exec("UPDATE Users SET Password = @p1, PlaintextRehashBefore = NULL WHERE ID = @p2 AND DeletedAt IS NULL", hashedPassword, id)
 	return err
 }
 
 func (r *userRepository) UpdatePasswordByEmail(email string, hashedPassword string) error {
-	_, err := r.db.Exec("UPDATE Users SET Password = @p1 WHERE Email = @p2", hashedPassword, email)
+	_, err := r.db.Exec("UPDATE Users SET Password = @p1 WHERE Email = @p2 AND DeletedAt IS NULL", hashedPassword, email)
+	return err
+}
+
+// ChangePassword stores a new password chosen by the user or an admin, restarting its age
+// and clearing any forced change.
+func (r *userRepository) ChangePassword(id int, hashedPassword string) error {
+	_, err := r.db.Exec("UPDATE Users SET Password = @p1, PasswordChangedAt = GETDATE(), MustChangePassword = 0, PlaintextRehashBefore = NULL WHERE ID = @p2 AND DeletedAt IS NULL", hashedPassword, id)
+	return err
+}
+
+func (r *userRepository) SetMustChangePassword(id int, mustChange bool) error {
+	_, err := r.db.Exec("UPDATE Users SET MustChangePassword = @p1 WHERE ID = @p2 AND DeletedAt IS NULL", mustChange, id)
 	return err
 }
 
 func (r *userRepository) UpdateLastLogin(id int) error {
-	_, err := r.db.Exec("UPDATE Users SET LastLogin = GETDATE() WHERE ID = @p1", id)
+	_, err := r.db.Exec("UPDATE Users SET LastLogin = GETDATE() WHERE ID = @p1 AND DeletedAt IS NULL", id)
 	return err
 }
 
 func (r *userRepository) UpdateLastLogout(email string) error {
-	_, err := r.db.Exec("UPDATE Users SET LastLogout = GETDATE() WHERE Email = @p1", email)
+	_, err := r.db.Exec("UPDATE Users SET LastLogout = GETDATE() WHERE Email = @p1 AND DeletedAt IS NULL", email)
 	return err
 }
 
-func (r *userRepository) UpdateFailedAttempts(id int, attempts int) error {
-	_, err := r.db.Exec("UPDATE Users SET FailedLoginAttempts = @p1 WHERE ID = @p2", attempts, id)
+// IncrementFailedAttempts adds one to the failed attempt counter and returns the
+// new value. The increment happens in SQL so concurrent failures are all counted.
+func (r *userRepository) IncrementFailedAttempts(id int) (int, error) {
+	var attempts int
+	err := r.db.QueryRow("UPDATE Users SET FailedLoginAttempts = FailedLoginAttempts + 1 OUTPUT inserted.FailedLoginAttempts WHERE ID = @p1 AND DeletedAt IS NULL", id).Scan(&attempts)
+	return attempts, err
+}
+
+// LockUntil locks the account without touching the failed attempt counter.
+func (r *userRepository) LockUntil(id int, lockedUntil time.Time) error {
+	_, err := r.db.Exec("UPDATE Users SET LockedUntil = @p1 WHERE ID = @p2 AND DeletedAt IS NULL", lockedUntil, id)
+	return err
+}
+
+// UpdateLockout sets the failed attempt counter and lock expiry together; a nil lockedUntil unlocks.
+func (r *userRepository) UpdateLockout(id int, attempts int, lockedUntil *time.Time) error {
+	var until interface{}
+	if lockedUntil != nil {
+		until = *lockedUntil
+	}
+	_, err := r.db.Exec("UPDATE Users SET FailedLoginAttempts = @p1, LockedUntil = @p2 WHERE ID = @p3 AND DeletedAt IS NULL", attempts, until, id)
 	return err
 }
 
 func (r *userRepository) UpdateProfilePicture(email string, filename string) error {
-	_, err := r.db.Exec("UPDATE Users SET ProfilePicture = @p1 WHERE Email = @p2", filename, email)
+	_, err := r.db.Exec("UPDATE Users SET ProfilePicture = @p1 WHERE Email = @p2 AND DeletedAt IS NULL", filename, email)
 	return err
 }
 
 func (r *userRepository) UpdateAvatar(email string, avatar []byte, avatarType string) error {
-	_, err := r.db.Exec("UPDATE Users SET Avatar = @p1, AvatarType = @p2 WHERE Email = @p3", avatar, avatarType, email)
+	_, err := r.db.Exec("UPDATE Users SET Avatar = @p1, AvatarType = @p2 WHERE Email = @p3 AND DeletedAt IS NULL", avatar, avatarType, email)
 	return err
 }
 
 func (r *userRepository) GetAvatar(email string) ([]byte, string, error) {
 	var avatar []byte
 	var avatarType sql.NullString
-	err := r.db.QueryRow("SELECT Avatar, AvatarType FROM Users WHERE Email = @p1", email).Scan(&avatar, &avatarType)
+	err := r.db.QueryRow("SELECT Avatar, AvatarType FROM Users WHERE Email = @p1 AND DeletedAt IS NULL", email).Scan(&avatar, &avatarType)
 	if err != nil {
 		return nil, "", err
 	}
@@ -320,7 +411,7 @@ func (r *userRepository) GetAvatar(email string) ([]byte, string, error) {
 func (r *userRepository) GetAvatarByID(id int) ([]byte, string, error) {
 	var avatar []byte
 	var avatarType sql.NullString
-	err := r.db.QueryRow("SELECT Avatar, AvatarType FROM Users WHERE ID = @p1", id).Scan(&avatar, &avatarType)
+	err := r.db.QueryRow("SELECT Avatar, AvatarType FROM Users WHERE ID = @p1 AND DeletedAt IS NULL", id).Scan(&avatar, &avatarType)
 	if err != nil {
 		return nil, "", err
 	}
@@ -328,72 +419,32 @@ func (r *userRepository) GetAvatarByID(id int) ([]byte, string, error) {
 }
 
 func (r *userRepository) RemoveAvatar(email string) error {
-	_, err := r.db.Exec("UPDATE Users SET Avatar = NULL, AvatarType = NULL WHERE Email = @p1", email)
+	_, err := r.db.Exec("UPDATE Users SET Avatar = NULL, AvatarType = NULL WHERE Email = @p1 AND DeletedAt IS NULL", email)
 	return err
 }
 
 func (r *userRepository) EmailExists(email string) (bool, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM Users WHERE Email = @p1", email).Scan(&count)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM Users WHERE Email = @p1 AND DeletedAt IS NULL", email).Scan(&count)
 	return count > 0, err
 }
 
 func (r *userRepository) LogActivity(email, action, details string) {
 	// First get user ID from email
 	var userID int
-	err := r.db.QueryRow("SELECT ID FROM Users WHERE Email = @p1", email).Scan(&userID)
+	err := r.db.QueryRow("SELECT ID FROM Users WHERE Email = @p1 AND DeletedAt IS NULL", email).Scan(&userID)
 	if err != nil {
 		// fmt.Printf("Error getting user ID for activity log: %v\n", err)
 		return
 	}
 
-	_, err = r.db.Exec("INSERT INTO ActivityLogs (UserID, Action, Details) VALUES (@p1, @p2, @p3)", userID, action, details)
+	err = audit.Append(r.db, audit.Entry{UserID: userID, Action: action, Details: details})
 	if err != nil {
-		// fmt.Printf("Error logging activity: %v\n", err)
+		log.Printf("Error logging activity %s for %s: %v", action, email, err)
 	}
 }
 
 func (r *userRepository) UpdateLoginStatus(email string, isLoggedIn bool) error {
-	_, err := r.db.Exec("UPDATE Users SET IsLoggedIn = @p1 WHERE Email = @p2", isLoggedIn, email)
+	_, err := r.db.Exec("UPDATE Users SET IsLoggedIn = @p1 WHERE Email = @p2 AND DeletedAt IS NULL", isLoggedIn, email)
 	return err
 }
-
-func (r *userRepository) GetActiveUsers() ([]models.User, error) {
-	query := `SELECT u.ID, u.Email, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.ProfilePicture, u.LastLogin, u.LastLogout, u.FailedLoginAttempts, u.IsLoggedIn
-			  FROM Users u 
-			  LEFT JOIN Roles r ON u.RoleID = r.ID 
-			  WHERE u.IsLoggedIn = 1`
-	
-	rows, err := r.db.Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var users []models.User
-	for rows.Next() {
-		var u models.User
-		var pp sql.NullString
-		var lastLogin, lastLogout sql.NullTime
-		var roleID sql.NullInt64
-
-		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &roleID, &u.IsActive, &pp, &lastLogin, &lastLogout, &u.FailedLoginAttempts, &u.IsLoggedIn); err != nil {
-			continue
-		}
-		if roleID.Valid {
-			u.RoleID = int(roleID.Int64)
-		}
-		if pp.Valid {
-			u.ProfilePicture = pp.String
-		}
-		if lastLogin.Valid {
-			u.LastLogin = &lastLogin.Time
-		}
-		if lastLogout.Valid {
-			u.LastLogout = &lastLogout.Time
-		}
-		users = append(users, u)
-	}
-
-	return users, nil
-}
\ No newline at end of file
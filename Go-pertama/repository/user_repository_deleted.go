@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"go-pertama/models"
+	"time"
+)
+
+// purgeUserQueries remove everything that belongs to a user before the user
+// row itself. ActivityLogs stay: deleting them would break the hash chain.
+var purgeUserQueries = []string{
+	"DELETE FROM refresh_tokens WHERE user_id = @p1",
+	"DELETE FROM sessions WHERE user_id = @p1",
+	"DELETE FROM api_keys WHERE user_id = @p1",
+	"DELETE FROM user_mfa WHERE user_id = @p1",
+	"DELETE FROM mfa_recovery_codes WHERE user_id = @p1",
+	"DELETE FROM mfa_challenges WHERE user_id = @p1",
+	"DELETE FROM user_identities WHERE user_id = @p1",
+	"DELETE FROM password_histories WHERE user_id = @p1",
+	"DELETE FROM password_reset_tokens WHERE user_id = @p1",
+	"DELETE FROM email_verification_tokens WHERE user_id = @p1",
+	"DELETE FROM invitations WHERE accepted_user_id = @p1",
+	"DELETE FROM known_devices WHERE user_id = @p1",
+	"DELETE FROM security_events WHERE user_id = @p1",
+	"DELETE FROM UserHistory WHERE UserID = @p1",
+	"DELETE FROM Users WHERE ID = @p1 AND DeletedAt IS NOT NULL",
+}
+
+func (r *userRepository) GetDeleted(page, limit int, search string) ([]models.User, int, error) {
+	offset := (page - 1) * limit
+	whereClause := "WHERE u.DeletedAt IS NOT NULL"
+	params := []interface{}{}
+
+	if search != "" {
+		whereClause += " AND (u.Name LIKE @p1 OR u.Email LIKE @p1)"
+		params = append(params, "%"+search+"%")
+	}
+
+	var total int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM Users u "+whereClause, params...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`SELECT u.ID, u.Email, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.IsServiceAccount, u.LastLogin, u.CreatedBy, u.DeletedAt, u.DeletedBy
+						  FROM Users u
+						  LEFT JOIN Roles r ON u.RoleID = r.ID
+						  %s ORDER BY u.DeletedAt DESC OFFSET %d ROWS FETCH NEXT %d ROWS ONLY`, whereClause, offset, limit)
+
+	rows, err := r.db.Query(query, params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		u, err := scanDeletedUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *u)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *userRepository) GetDeletedByID(id int) (*models.User, error) {
+	row := r.db.QueryRow(`SELECT u.ID, u.Email, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.IsServiceAccount, u.LastLogin, u.CreatedBy, u.DeletedAt, u.DeletedBy
+		FROM Users u
+		LEFT JOIN Roles r ON u.RoleID = r.ID
+		WHERE u.ID = @p1 AND u.DeletedAt IS NOT NULL`, id)
+	return scanDeletedUser(row)
+}
+
+func scanDeletedUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var u models.User
+	var role, createdBy, deletedBy sql.NullString
+	var roleID sql.NullInt64
+	var lastLogin, deletedAt sql.NullTime
+	if err := row.Scan(&u.ID, &u.Email, &u.Name, &role, &roleID, &u.IsActive, &u.IsServiceAccount, &lastLogin, &createdBy, &deletedAt, &deletedBy); err != nil {
+		return nil, err
+	}
+	u.Role = role.String
+	u.RoleID = int(roleID.Int64)
+	u.CreatedBy = createdBy.String
+	u.DeletedBy = deletedBy.String
+	if lastLogin.Valid {
+		u.LastLogin = &lastLogin.Time
+	}
+	if deletedAt.Valid {
+		u.DeletedAt = &deletedAt.Time
+	}
+	return &u, nil
+}
+
+func (r *userRepository) Restore(id int, restoredBy string) error {
+	res, err := r.db.Exec("UPDATE Users SET DeletedAt = NULL, DeletedBy = NULL, UpdatedBy = @p1, UpdatedAt = GETDATE() WHERE ID = @p2 AND DeletedAt IS NOT NULL", restoredBy, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if u, err := r.GetByID(id); err == nil {
+		histQuery := `INSERT INTO UserHistory (UserID, Email, Name, Role, RoleID, IsActive, Action, ChangedBy, ChangedAt)
+					  VALUES (@p1, @p2, @p3, @p4, @p5, @p6, 'RESTORE', @p7, GETDATE())`
+		var histRoleID interface{} = u.RoleID
+		if u.RoleID == 0 {
+			histRoleID = nil
+		}
+		r.db.Exec(histQuery, u.ID, u.Email, u.Name, u.Role, histRoleID, u.IsActive, restoredBy)
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes users deleted before the given time, one
+// transaction per user, and returns the emails of those removed.
+func (r *userRepository) PurgeDeleted(before time.Time) ([]string, error) {
+	rows, err := r.db.Query("SELECT ID, Email FROM Users WHERE DeletedAt IS NOT NULL AND DeletedAt < @p1", before)
+	if err != nil {
+		return nil, err
+	}
+	type purgeTarget struct {
+		id    int
+		email string
+	}
+	var targets []purgeTarget
+	for rows.Next() {
+		var t purgeTarget
+		if err := rows.Scan(&t.id, &t.email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var purged []string
+	for _, t := range targets {
+		if err := r.purgeUser(t.id); err != nil {
+			return purged, fmt.Errorf("purging user %d: %w", t.id, err)
+		}
+		purged = append(purged, t.email)
+	}
+	return purged, nil
+}
+
+func (r *userRepository) purgeUser(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, q := range purgeUserQueries {
+		if _, err := tx.Exec(q, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
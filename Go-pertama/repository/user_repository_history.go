@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+	"go-pertama/models"
+)
+
+func (r *userRepository) GetHistoryEntry(historyID int) (*models.UserHistory, error) {
+	var h models.UserHistory
+	var roleID sql.NullInt64
+	err := r.db.QueryRow(`SELECT ID, UserID, Email, Name, Role, RoleID, IsActive, Action, ChangedBy, ChangedAt FROM UserHistory WHERE ID = @p1`, historyID).
+		Scan(&h.ID, &h.UserID, &h.Email, &h.Name, &h.Role, &roleID, &h.IsActive, &h.Action, &h.ChangedBy, &h.ChangedAt)
+	if err != nil {
+		return nil, err
+	}
+	if roleID.Valid {
+		h.RoleID = int(roleID.Int64)
+	}
+	return &h, nil
+}
+
+// EmailTakenByOther reports whether a live user other than userID has the email.
+func (r *userRepository) EmailTakenByOther(email string, userID int) (bool, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM Users WHERE Email = @p1 AND ID <> @p2 AND DeletedAt IS NULL", email, userID).Scan(&count)
+	return count > 0, err
+}
+
+// ApplySnapshot puts a history entry back on its user, undeleting the user
+// if needed. The state it replaces is recorded as a RESTORE history row.
+func (r *userRepository) ApplySnapshot(entry *models.UserHistory, restoredBy string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO UserHistory (UserID, Email, Name, Role, RoleID, IsActive, Action, ChangedBy, ChangedAt)
+		SELECT ID, Email, Name, Role, RoleID, IsActive, 'RESTORE', @p1, GETDATE() FROM Users WHERE ID = @p2`, restoredBy, entry.UserID)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE Users SET Email=@p1, Name=@p2, Role=@p3, RoleID=@p4, IsActive=@p5, DeletedAt=NULL, DeletedBy=NULL, UpdatedBy=@p6, UpdatedAt=GETDATE() WHERE ID=@p7`,
+		entry.Email, entry.Name, entry.Role, nullableRoleID(entry.RoleID), entry.IsActive, restoredBy, entry.UserID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// Recreate inserts a user that was removed from Users, under its old ID so
+// its activity logs and history line up again. The snapshot itself is
+// recorded as the RESTORE history row since there is no earlier state.
+func (r *userRepository) Recreate(entry *models.UserHistory, hashedPassword, restoredBy string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`SET IDENTITY_INSERT Users ON;
+		INSERT INTO Users (ID, Email, Password, Name, Role, RoleID, IsActive, CreatedAt, CreatedBy, UpdatedBy)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, GETDATE(), @p8, @p8);
+		SET IDENTITY_INSERT Users OFF;`,
+		entry.UserID, entry.Email, hashedPassword, entry.Name, entry.Role, nullableRoleID(entry.RoleID), entry.IsActive, restoredBy)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO UserHistory (UserID, Email, Name, Role, RoleID, IsActive, Action, ChangedBy, ChangedAt)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, 'RESTORE', @p7, GETDATE())`,
+		entry.UserID, entry.Email, entry.Name, entry.Role, nullableRoleID(entry.RoleID), entry.IsActive, restoredBy)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// nullableRoleID stores 0 as NULL, like Create and Update do.
+func nullableRoleID(roleID int) interface{} {
+	if roleID == 0 {
+		return nil
+	}
+	return roleID
+}
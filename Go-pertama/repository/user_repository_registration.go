@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"go-pertama/models"
+)
+
+// CreateRegistration inserts an inactive self-registered user and returns its ID.
+func (r *userRepository) CreateRegistration(user *models.User) (int, error) {
+	query := `INSERT INTO Users (Email, Password, Name, Role, RoleID, IsActive, IsServiceAccount, RegistrationStatus, CreatedAt, CreatedBy)
+		OUTPUT INSERTED.ID
+		VALUES (@p1, @p2, @p3, @p4, @p5, 0, 0, @p6, GETDATE(), @p7)`
+	var id int
+	err := r.db.QueryRow(query, user.Email, user.Password, user.Name, user.Role, nullableRoleID(user.RoleID), user.RegistrationStatus, user.CreatedBy).Scan(&id)
+	return id, err
+}
+
+// UpdateRegistrationStatus moves a self-registered user from one registration
+// status to the next. An empty status ends the registration, and activate
+// turns the account on. It returns sql.ErrNoRows if the user is not in status from.
+func (r *userRepository) UpdateRegistrationStatus(id int, from, to string, activate bool, updatedBy string) error {
+	res, err := r.db.Exec(`UPDATE Users SET RegistrationStatus = NULLIF(@p1, ''), IsActive = CASE WHEN @p2 = 1 THEN 1 ELSE IsActive END, UpdatedBy = @p3, UpdatedAt = GETDATE()
+		WHERE ID = @p4 AND RegistrationStatus = @p5 AND DeletedAt IS NULL`, to, activate, updatedBy, id, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetRegistrations lists inactive self-registered users, oldest first. An
+// empty status lists every registration still in progress.
+func (r *userRepository) GetRegistrations(status string, page, limit int) ([]models.User, int, error) {
+	offset := (page - 1) * limit
+	whereClause := "WHERE u.RegistrationStatus IS NOT NULL AND u.IsActive = 0 AND u.DeletedAt IS NULL"
+	params := []interface{}{}
+
+	if status != "" {
+		whereClause += " AND u.RegistrationStatus = @p1"
+		params = append(params, status)
+	}
+
+	var total int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM Users u "+whereClause, params...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`SELECT u.ID, u.Email, u.Name, COALESCE(r.Name, u.Role), u.RoleID, u.IsActive, u.RegistrationStatus, u.CreatedBy
+						  FROM Users u
+						  LEFT JOIN Roles r ON u.RoleID = r.ID
+						  %s ORDER BY u.CreatedAt ASC, u.ID ASC OFFSET %d ROWS FETCH NEXT %d ROWS ONLY`, whereClause, offset, limit)
+
+	rows, err := r.db.Query(query, params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var u models.User
+		var role, createdBy sql.NullString
+		var roleID sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &role, &roleID, &u.IsActive, &u.RegistrationStatus, &createdBy); err != nil {
+			return nil, 0, err
+		}
+		u.Role = role.String
+		u.RoleID = int(roleID.Int64)
+		u.CreatedBy = createdBy.String
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrInvalidAPIKey     = errors.New("invalid api key")
+	ErrAPIKeyExpired     = errors.New("api key expired")
+	ErrNotServiceAccount = errors.New("api keys can only be created for service accounts")
+)
+
+// apiKeyIDLength is the number of hex characters after APIKeyPrefix that
+// identify a key, e.g. "gpk_1a2b3c4d_<secret>".
+const apiKeyIDLength = 8
+
+type APIKeyService interface {
+	List(userID int) ([]models.APIKey, error)
+	Get(id int64) (*models.APIKey, error)
+	Create(req models.CreateAPIKeyRequest, actor *auth.Principal) (*models.CreateAPIKeyResponse, error)
+	Update(id int64, req models.UpdateAPIKeyRequest, actor *auth.Principal) (*models.APIKey, error)
+	Revoke(id int64, actor *auth.Principal) error
+	AuthenticateKey(key, ip string) (*auth.Principal, error)
+	LogKeyUsage(principal *auth.Principal, method, path string)
+}
+
+type apiKeyService struct {
+	repo     repository.APIKeyRepository
+	userRepo repository.UserRepository
+	roleRepo repository.RoleRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository) APIKeyService {
+	return &apiKeyService{repo: repo, userRepo: userRepo, roleRepo: roleRepo}
+}
+
+func (s *apiKeyService) List(userID int) ([]models.APIKey, error) {
+	return s.repo.FindAll(userID)
+}
+
+func (s *apiKeyService) Get(id int64) (*models.APIKey, error) {
+	key, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+// Create issues a new key and returns it in plain text. It cannot be shown again.
+func (s *apiKeyService) Create(req models.CreateAPIKeyRequest, actor *auth.Principal) (*models.CreateAPIKeyResponse, error) {
+	user, err := s.userRepo.GetByID(req.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if !user.IsServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+	if err := validateAPIKeyFields(req.Name, req.Scopes, req.ExpiresAt, actor); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, apiKeyIDLength/2)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	secret, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	prefix := models.APIKeyPrefix + hex.EncodeToString(id)
+	plain := prefix + "_" + secret
+
+	key := &models.APIKey{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		KeyHash:   auth.HashToken(plain),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: actor.Email,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := s.repo.Create(key); err != nil {
+		return nil, err
+	}
+	key.UserEmail = user.Email
+
+	s.userRepo.LogActivity(actor.Email, "API_KEY_CREATED", fmt.Sprintf("Created API key %q (%s) for %s with scopes %s", key.Name, prefix, user.Email, strings.Join(key.Scopes, ", ")))
+	return &models.CreateAPIKeyResponse{Key: plain, APIKey: key}, nil
+}
+
+func (s *apiKeyService) Update(id int64, req models.UpdateAPIKeyRequest, actor *auth.Principal) (*models.APIKey, error) {
+	key, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return nil, errors.New("api key is revoked")
+	}
+	if err := validateAPIKeyFields(req.Name, req.Scopes, req.ExpiresAt, actor); err != nil {
+		return nil, err
+	}
+
+	key.Name = strings.TrimSpace(req.Name)
+	key.Scopes = req.Scopes
+	key.ExpiresAt = req.ExpiresAt
+	key.UpdatedAt = time.Now()
+	if err := s.repo.Update(key); err != nil {
+		return nil, err
+	}
+
+	s.userRepo.LogActivity(actor.Email, "API_KEY_UPDATED", fmt.Sprintf("Updated API key %q (%s) of %s, scopes %s", key.Name, key.Prefix, key.UserEmail, strings.Join(key.Scopes, ", ")))
+	return key, nil
+}
+
+func (s *apiKeyService) Revoke(id int64, actor *auth.Principal) error {
+	key, err := s.repo.FindByID(id)
+	if err != nil {
+		return ErrAPIKeyNotFound
+	}
+	if err := s.repo.Revoke(id); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(actor.Email, "API_KEY_REVOKED", fmt.Sprintf("Revoked API key %q (%s) of %s", key.Name, key.Prefix, key.UserEmail))
+	return nil
+}
+
+// AuthenticateKey resolves a presented key to the service account acting
+// through it. The principal only gets the permissions that both the account's
+// role and the key's scopes allow.
+func (s *apiKeyService) AuthenticateKey(plain, ip string) (*auth.Principal, error) {
+	prefixLen := len(models.APIKeyPrefix) + apiKeyIDLength
+	if !strings.HasPrefix(plain, models.APIKeyPrefix) || len(plain) <= prefixLen+1 || plain[prefixLen] != '_' {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.FindByPrefix(plain[:prefixLen])
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(plain)), []byte(key.KeyHash)) != 1 || key.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	user, err := s.userRepo.GetByID(key.UserID)
+	if err != nil || !user.IsActive || !user.IsServiceAccount {
+		return nil, ErrInvalidAPIKey
+	}
+
+	granted, err := s.roleRepo.GetPermissionCodesByEmail(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	s.repo.TouchUsage(key.ID, ip)
+
+	return &auth.Principal{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		Role:        user.Role,
+		Permissions: intersect(granted, key.Scopes),
+		APIKeyID:    key.ID,
+		APIKeyName:  key.Name,
+	}, nil
+}
+
+// LogKeyUsage records a request made with an API key in ActivityLogs.
+func (s *apiKeyService) LogKeyUsage(principal *auth.Principal, method, path string) {
+	s.repo.LogUsage(principal.UserID, principal.APIKeyID, "API_KEY_USED", fmt.Sprintf("%s %s with API key %q", method, path, principal.APIKeyName))
+}
+
+// validateAPIKeyFields checks a key's settings. Scopes must be known permission
+// codes that the actor holds, so nobody can mint a key stronger than themselves.
+func validateAPIKeyFields(name string, scopes []string, expiresAt *time.Time, actor *auth.Principal) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is required")
+	}
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !isKnownPermission(scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		if !actor.HasPermission(scope) {
+			return fmt.Errorf("you cannot grant scope %q", scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.New("expiry must be in the future")
+	}
+	return nil
+}
+
+func isKnownPermission(code string) bool {
+	for _, p := range models.DefaultPermissions {
+		if p.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+func intersect(a, b []string) []string {
+	result := []string{}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				result = append(result, x)
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+
+	"go-pertama/audit"
+)
+
+type AuditService interface {
+	VerifyActivityLogs() (*audit.Result, error)
+}
+
+type auditService struct {
+	db        *sql.DB
+	verifyKey ed25519.PublicKey
+}
+
+// NewAuditService checks the activity log chain; verifyKey may be nil, in
+// which case checkpoint signatures are not checked.
+func NewAuditService(db *sql.DB, verifyKey ed25519.PublicKey) AuditService {
+	return &auditService{db: db, verifyKey: verifyKey}
+}
+
+func (s *auditService) VerifyActivityLogs() (*audit.Result, error) {
+	return audit.Verify(s.db, s.verifyKey)
+}
@@ -4,93 +4,364 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"go-pertama/auth"
 	"go-pertama/config"
 	"go-pertama/models"
 	"go-pertama/repository"
-	"strings"
+	"log"
+	"time"
+)
 
-	"golang.org/x/crypto/bcrypt"
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token already used, all sessions revoked")
 )
 
 type AuthService interface {
-	Login(req models.LoginRequest) (*models.LoginResponse, error)
-	Logout(email string) error
+	Login(req models.LoginRequest, client models.ClientInfo) (*models.LoginResponse, error)
+	VerifyMFA(req models.MFAVerifyRequest, client models.ClientInfo) (*models.LoginResponse, error)
+	LoginWithIdentity(user *models.User, client models.ClientInfo) (*models.LoginResponse, error)
+	Refresh(refreshToken string, client models.ClientInfo) (*models.LoginResponse, error)
+	Logout(email, sessionID string) error
+	RevokeAll(userID int) error
 	ChangePassword(email string, req models.ChangePasswordRequest) error
 }
 
 type authService struct {
-	userRepo repository.UserRepository
-	config   *config.Config
+	userRepo       repository.UserRepository
+	refreshRepo    repository.RefreshTokenRepository
+	sessions       SessionService
+	configs        ConfigService
+	passwords      PasswordService
+	authenticators []Authenticator
+	mfa            MFAService
+	networks       NetworkPolicyService
+	monitor        LoginMonitorService
+	tokens         *auth.TokenManager
+	config         *config.Config
 }
 
-func NewAuthService(userRepo repository.UserRepository, cfg *config.Config) AuthService {
+func NewAuthService(userRepo repository.UserRepository, refreshRepo repository.RefreshTokenRepository, sessions SessionService, configs ConfigService, passwords PasswordService, authenticators []Authenticator, mfa MFAService, networks NetworkPolicyService, monitor LoginMonitorService, tokens *auth.TokenManager, cfg *config.Config) AuthService {
 	return &authService{
-		userRepo: userRepo,
-		config:   cfg,
+		userRepo:       userRepo,
+		refreshRepo:    refreshRepo,
+		sessions:       sessions,
+		configs:        configs,
+		passwords:      passwords,
+		authenticators: authenticators,
+		mfa:            mfa,
+		networks:       networks,
+		monitor:        monitor,
+		tokens:         tokens,
+		config:         cfg,
 	}
 }
 
-func (s *authService) Login(req models.LoginRequest) (*models.LoginResponse, error) {
+func (s *authService) Login(req models.LoginRequest, client models.ClientInfo) (*models.LoginResponse, error) {
 	user, err := s.userRepo.GetByEmail(req.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("invalid credentials")
+		if err != sql.ErrNoRows {
+			return nil, errors.New("database connection error")
 		}
-		return nil, errors.New("database connection error")
+		// Directory users may log in with a name that is not an email; the authenticators decide
+		user = nil
+	}
+
+	if user != nil {
+		if err := s.checkLoginAllowed(user); err != nil {
+			return nil, err
+		}
+	}
+
+	authed, err := s.authenticate(req.Email, req.Password, user)
+	if err == nil {
+		if user == nil || authed.ID != user.ID {
+			if err := s.checkLoginAllowed(authed); err != nil {
+				return nil, err
+			}
+		}
+		// Checked only once the password is right, so the answer does not reveal which accounts are restricted
+		if err := s.networks.Check(authed.ID, client.IPAddress, "login"); err != nil {
+			return nil, err
+		}
+
+		// With MFA enabled the password only earns a challenge; the session starts in VerifyMFA.
+		// Failed attempts are only reset there, so a known password alone does not clear a lockout.
+		if s.mfa.Enabled(authed.ID) {
+			challenge, err := s.mfa.StartChallenge(authed.ID)
+			if err != nil {
+				return nil, errors.New("database connection error")
+			}
+			return &models.LoginResponse{
+				Message:        "Two-factor verification required",
+				MFARequired:    true,
+				ChallengeToken: challenge,
+			}, nil
+		}
+
+		return s.completeLogin(authed, client)
+	}
+
+	if user == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	newAttempts, err := s.recordFailedAttempt(user, "Wrong password")
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("invalid credentials. Failed attempts: %d", newAttempts)
+}
+
+// recordFailedAttempt counts a wrong password or verification code towards the
+// lockout policy. It returns the new count, or an AccountLockedError when this
+// failure locks the account.
+func (s *authService) recordFailedAttempt(user *models.User, reason string) (int, error) {
+	// The count comes back from the database so parallel guesses cannot share one attempt
+	newAttempts, err := s.userRepo.IncrementFailedAttempts(user.ID)
+	if err != nil {
+		return 0, errors.New("database connection error")
+	}
+	s.userRepo.LogActivity(user.Email, "LOGIN_FAILED", fmt.Sprintf("%s. Attempt: %d", reason, newAttempts))
+
+	if lockFor := loadLockoutPolicy(s.configs).LockDuration(newAttempts); lockFor > 0 {
+		until := time.Now().Add(lockFor)
+		s.userRepo.LockUntil(user.ID, until)
+		s.userRepo.LogActivity(user.Email, "LOCKOUT", fmt.Sprintf("Account locked for %s after %d failed attempts", lockFor, newAttempts))
+		return newAttempts, &AccountLockedError{Until: until}
 	}
+	return newAttempts, nil
+}
 
+// checkLoginAllowed rejects inactive, service and currently locked accounts.
+func (s *authService) checkLoginAllowed(user *models.User) error {
 	if !user.IsActive {
-		return nil, errors.New("account is inactive")
+		switch user.RegistrationStatus {
+		case models.RegistrationUnverified:
+			return errors.New("please confirm your email address first")
+		case models.RegistrationPendingApproval:
+			return errors.New("account is awaiting approval")
+		}
+		return errors.New("account is inactive")
+	}
+	if user.IsServiceAccount {
+		return errors.New("service accounts cannot log in, use an API key")
 	}
 
-	passwordMatch := false
-	isPlainText := false
+	// Locked accounts unlock themselves once LockedUntil has passed
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		s.userRepo.LogActivity(user.Email, "LOGIN_FAILED", "Login attempt while account is locked")
+		return &AccountLockedError{Until: *user.LockedUntil}
+	}
+	return nil
+}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
-	if err == nil {
-		passwordMatch = true
-	} else {
-		// Fallback: Check if it's a legacy plain text password
-		if user.Password == req.Password {
-			passwordMatch = true
-			isPlainText = true
+// authenticate asks each configured authenticator in turn; the first to accept the password wins.
+// A backend that fails (e.g. the directory is unreachable) is logged and skipped.
+func (s *authService) authenticate(login, password string, user *models.User) (*models.User, error) {
+	for _, a := range s.authenticators {
+		authed, err := a.Authenticate(login, password, user)
+		if err == nil {
+			return authed, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("%s authentication error for %s: %v", a.Name(), login, err)
 		}
 	}
+	return nil, ErrInvalidCredentials
+}
 
-	if passwordMatch {
-		// Reset failed attempts and update LastLogin
-		s.userRepo.UpdateLastLogin(user.ID)
-		s.userRepo.UpdateLoginStatus(user.Email, true)
+// VerifyMFA finishes a login that was paused for a second factor.
+func (s *authService) VerifyMFA(req models.MFAVerifyRequest, client models.ClientInfo) (*models.LoginResponse, error) {
+	userID, err := s.mfa.ChallengeUser(req.ChallengeToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, errors.New("database connection error")
+	}
+	// The account may have been locked or disabled since the password was accepted
+	if err := s.checkLoginAllowed(user); err != nil {
+		return nil, err
+	}
 
-		// If it was plain text, migrate to bcrypt hash automatically
-		if isPlainText {
-			hashed, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-			s.userRepo.UpdatePassword(user.ID, string(hashed))
+	if _, err := s.mfa.VerifyChallenge(req.ChallengeToken, req.Code); err != nil {
+		// Wrong codes count like wrong passwords, otherwise new challenges would allow unlimited guessing
+		if errors.Is(err, ErrInvalidMFACode) {
+			if _, lockErr := s.recordFailedAttempt(user, "Wrong verification code"); lockErr != nil {
+				return nil, lockErr
+			}
 		}
+		return nil, err
+	}
 
-		// Generate Token
-		token := fmt.Sprintf("sql-jwt-token-%s-secret-%s", req.Email, strings.Split(s.config.JWT.Secret, "-")[0])
+	if err := s.networks.Check(user.ID, client.IPAddress, "two-factor login"); err != nil {
+		return nil, err
+	}
+	return s.completeLogin(user, client)
+}
 
-		s.userRepo.LogActivity(req.Email, "LOGIN", "User logged in")
+// LoginWithIdentity starts a session for a user authenticated by an external
+// identity provider. Identities are linked to accounts by email, so the same
+// checks as a password login apply, including a local second factor.
+func (s *authService) LoginWithIdentity(user *models.User, client models.ClientInfo) (*models.LoginResponse, error) {
+	if err := s.checkLoginAllowed(user); err != nil {
+		return nil, err
+	}
+	if err := s.networks.Check(user.ID, client.IPAddress, "single sign-on"); err != nil {
+		return nil, err
+	}
 
+	if s.mfa.Enabled(user.ID) {
+		challenge, err := s.mfa.StartChallenge(user.ID)
+		if err != nil {
+			return nil, errors.New("database connection error")
+		}
 		return &models.LoginResponse{
-			Message: "Login successful",
-			Token:   token,
-			Success: true,
-			User:    user,
+			Message:        "Two-factor verification required",
+			MFARequired:    true,
+			ChallengeToken: challenge,
 		}, nil
-	} else {
-		// Increment failed attempts
-		newAttempts := user.FailedLoginAttempts + 1
-		s.userRepo.UpdateFailedAttempts(user.ID, newAttempts)
+	}
+	return s.completeLogin(user, client)
+}
+
+// completeLogin starts a session for a fully authenticated user and issues its tokens.
+func (s *authService) completeLogin(user *models.User, client models.ClientInfo) (*models.LoginResponse, error) {
+	// Only a finished login, including any second factor, resets failed attempts
+	s.userRepo.UpdateLastLogin(user.ID)
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		s.userRepo.UpdateLockout(user.ID, 0, nil)
+	}
 
-		s.userRepo.LogActivity(req.Email, "LOGIN_FAILED", fmt.Sprintf("Wrong password. Attempt: %d", newAttempts))
-		return nil, fmt.Errorf("invalid credentials. Failed attempts: %d", newAttempts)
+	// An expired password stays usable for this login, but every other route is blocked until it is changed
+	if !user.MustChangePassword && s.passwords.Expired(user) {
+		s.userRepo.SetMustChangePassword(user.ID, true)
+		user.MustChangePassword = true
+		s.userRepo.LogActivity(user.Email, "PASSWORD_EXPIRED", "Password exceeded its maximum age, change required")
 	}
+
+	// Each login is its own session; the session ID doubles as the refresh token family
+	session, err := s.sessions.Start(user, client, time.Now().Add(s.config.JWT.RefreshExpiry))
+	if err != nil {
+		return nil, errors.New("database connection error")
+	}
+	resp, err := s.issueTokens(user, session.ID, client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.userRepo.LogActivity(user.Email, "LOGIN", "User logged in")
+	s.monitor.Inspect(user, client)
+
+	resp.Message = "Login successful"
+	if user.MustChangePassword {
+		resp.Message = "Login successful, password change required"
+	}
+	return resp, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a rotated
+// refresh token. Presenting an already-used token revokes the whole family.
+func (s *authService) Refresh(refreshToken string, client models.ClientInfo) (*models.LoginResponse, error) {
+	stored, err := s.refreshRepo.FindByHash(auth.HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return nil, s.handleRefreshReuse(stored)
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	ok, err := s.refreshRepo.MarkUsed(stored.ID)
+	if err != nil {
+		return nil, errors.New("database connection error")
+	}
+	if !ok {
+		return nil, s.handleRefreshReuse(stored)
+	}
+
+	user, err := s.userRepo.GetByID(stored.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !user.IsActive || !s.sessions.IsActive(stored.FamilyID) {
+		s.sessions.Revoke(stored.FamilyID)
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := s.networks.Check(user.ID, client.IPAddress, "token refresh"); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.issueTokens(user, stored.FamilyID, client)
+	if err != nil {
+		return nil, err
+	}
+	s.sessions.Extend(stored.FamilyID, time.Now().Add(s.config.JWT.RefreshExpiry))
+	resp.Message = "Token refreshed"
+	return resp, nil
+}
+
+func (s *authService) handleRefreshReuse(stored *models.RefreshToken) error {
+	s.sessions.Revoke(stored.FamilyID)
+	if user, err := s.userRepo.GetByID(stored.UserID); err == nil {
+		s.userRepo.LogActivity(user.Email, "REFRESH_TOKEN_REUSE", "Reused refresh token detected, session revoked")
+	}
+	return ErrRefreshTokenReused
+}
+
+// issueTokens signs an access token and stores a new refresh token in the given family.
+func (s *authService) issueTokens(user *models.User, familyID string, client models.ClientInfo) (*models.LoginResponse, error) {
+	accessToken, claims, err := s.tokens.Issue(user, familyID)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	refreshToken, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+	err = s.refreshRepo.Create(&models.RefreshToken{
+		UserID:     user.ID,
+		TokenHash:  auth.HashToken(refreshToken),
+		FamilyID:   familyID,
+		DeviceInfo: truncate(client.UserAgent, 255),
+		IPAddress:  client.IPAddress,
+		ExpiresAt:  time.Now().Add(s.config.JWT.RefreshExpiry),
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	expiresAt := claims.ExpiresAt.Time
+	return &models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    &expiresAt,
+		Success:      true,
+		User:         user,
+	}, nil
 }
 
-func (s *authService) Logout(email string) error {
-	s.userRepo.UpdateLoginStatus(email, false)
+// RevokeAll ends every session of the user.
+func (s *authService) RevokeAll(userID int) error {
+	return s.sessions.RevokeAllForUser(userID)
+}
+
+// Logout ends the current session only; other devices stay signed in.
+func (s *authService) Logout(email, sessionID string) error {
+	if sessionID != "" {
+		s.sessions.Revoke(sessionID)
+	} else if user, err := s.userRepo.GetByEmail(email); err == nil {
+		// Legacy tokens carry no session, so sign out everywhere
+		s.sessions.RevokeAllForUser(user.ID)
+	}
 	err := s.userRepo.UpdateLastLogout(email)
 	if err == nil {
 		s.userRepo.LogActivity(email, "LOGOUT", "User logged out")
@@ -105,21 +376,15 @@ func (s *authService) ChangePassword(email string, req models.ChangePasswordRequ
 	}
 
 	// Verify old password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword))
-	if err != nil {
-		// Try plain text
-		if user.Password != req.OldPassword {
-			return errors.New("incorrect old password")
-		}
+	if !s.passwords.Verify(user, req.OldPassword) {
+		return errors.New("incorrect old password")
 	}
 
-	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
+	if err := s.passwords.Validate(user.ID, user.Email, req.NewPassword); err != nil {
 		return err
 	}
 
-	err = s.userRepo.UpdatePasswordByEmail(email, string(hashedPassword))
+	err = s.passwords.Save(user.ID, req.NewPassword)
 	if err == nil {
 		s.userRepo.LogActivity(email, "CHANGE_PASSWORD", "Password changed successfully")
 	}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-pertama/auth"
+	"go-pertama/config"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator checks a password login against one backend. user is the Users
+// row matching the login name, or nil when there is none. On success it returns
+// the local user to sign in; ErrInvalidCredentials means "not accepted here" and
+// the next authenticator is tried.
+type Authenticator interface {
+	Name() string
+	Authenticate(login, password string, user *models.User) (*models.User, error)
+}
+
+// NewAuthenticators builds the chain listed in AUTH_PROVIDERS.
+func NewAuthenticators(cfg *config.Config, userRepo repository.UserRepository, roleRepo repository.RoleRepository, passwords PasswordService) ([]Authenticator, error) {
+	var chain []Authenticator
+	for _, name := range strings.Split(cfg.Auth.Providers, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "local":
+			chain = append(chain, &localAuthenticator{passwords: passwords})
+		case "ldap":
+			if cfg.LDAP.URL == "" || cfg.LDAP.UserDNTemplates == "" {
+				return nil, errors.New("ldap authentication needs LDAP_URL and LDAP_USER_DN_TEMPLATES")
+			}
+			chain = append(chain, NewLDAPAuthenticator(auth.NewLDAPClient(cfg.LDAP), userRepo, roleRepo, passwords, cfg.LDAP))
+		default:
+			return nil, fmt.Errorf("unknown auth provider %q", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("AUTH_PROVIDERS is empty")
+	}
+	return chain, nil
+}
+
+// localAuthenticator checks the bcrypt hash stored in Users.Password.
+type localAuthenticator struct {
+	passwords PasswordService
+}
+
+func (a *localAuthenticator) Name() string { return "local" }
+
+func (a *localAuthenticator) Authenticate(login, password string, user *models.User) (*models.User, error) {
+	if user == nil || !a.passwords.Verify(user, password) {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// ldapAuthenticator binds to the directory as the user and creates or updates
+// the matching Users row, keyed by the directory's email attribute.
+type ldapAuthenticator struct {
+	client   *auth.LDAPClient
+	userRepo repository.UserRepository
+	accounts externalAccounts
+	cfg      config.LDAPConfig
+	roleMap  []groupRole
+}
+
+func NewLDAPAuthenticator(client *auth.LDAPClient, userRepo repository.UserRepository, roleRepo repository.RoleRepository, passwords PasswordService, cfg config.LDAPConfig) Authenticator {
+	return &ldapAuthenticator{
+		client:   client,
+		userRepo: userRepo,
+		accounts: externalAccounts{userRepo: userRepo, roleRepo: roleRepo, passwords: passwords, source: "LDAP"},
+		cfg:      cfg,
+		roleMap:  parseRoleMapping(cfg.RoleMapping, ";"),
+	}
+}
+
+func (a *ldapAuthenticator) Name() string { return "ldap" }
+
+func (a *ldapAuthenticator) Authenticate(login, password string, user *models.User) (*models.User, error) {
+	entry, err := a.client.Authenticate(login, password)
+	if err != nil {
+		if errors.Is(err, auth.ErrLDAPInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if entry.Email == "" {
+		return nil, fmt.Errorf("ldap entry %s has no %s attribute", entry.DN, a.cfg.EmailAttribute)
+	}
+
+	groups := ldapGroupNames(entry.Groups)
+	if user == nil || !strings.EqualFold(user.Email, entry.Email) {
+		user, err = a.userRepo.GetByEmail(entry.Email)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if !a.cfg.AutoProvision {
+				return nil, ErrInvalidCredentials
+			}
+			roleName := mappedRole(a.roleMap, groups)
+			if roleName == "" {
+				roleName = a.cfg.DefaultRole
+			}
+			return a.accounts.provision(entry.Email, entry.Name, roleName)
+		case err != nil:
+			return nil, errors.New("database connection error")
+		}
+	}
+
+	if err := a.accounts.syncRole(user, mappedRole(a.roleMap, groups)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ldapGroupNames returns each group DN together with its CN, so mappings can
+// use either "CN=App Admins,OU=Groups,DC=corp" or just "App Admins".
+func ldapGroupNames(dns []string) []string {
+	names := make([]string, 0, len(dns)*2)
+	for _, dn := range dns {
+		names = append(names, dn)
+		first, _, _ := strings.Cut(dn, ",")
+		if key, value, ok := strings.Cut(first, "="); ok && strings.EqualFold(strings.TrimSpace(key), "cn") {
+			names = append(names, strings.TrimSpace(value))
+		}
+	}
+	return names
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/config"
+	"go-pertama/models"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type ldapTestEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// ldapTestServer answers just enough of LDAPv3 for LDAPClient: simple binds,
+// searches and unbind. Like many real servers it accepts a bind with an empty
+// password as anonymous, so the client has to refuse those itself.
+type ldapTestServer struct {
+	ln      net.Listener
+	entries []ldapTestEntry
+
+	mu    sync.Mutex
+	binds []string
+}
+
+func newLDAPTestServer(t *testing.T, entries ...ldapTestEntry) *ldapTestServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &ldapTestServer{ln: ln, entries: entries}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *ldapTestServer) URL() string { return "ldap://" + s.ln.Addr().String() }
+
+// bindAttempts returns the DNs of every bind so far, in order.
+func (s *ldapTestServer) bindAttempts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func (s *ldapTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			s.mu.Unlock()
+
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if password == "" {
+				code = ldap.LDAPResultSuccess
+			} else if e := s.find(dn); e != nil && e.password == password {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			s.search(conn, id, op)
+		default:
+			return
+		}
+	}
+}
+
+func (s *ldapTestServer) find(dn string) *ldapTestEntry {
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].dn, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+// search matches a base object by DN, and a subtree search by any
+// "(attribute=value)" of the entry appearing in the filter.
+func (s *ldapTestServer) search(conn net.Conn, id int64, op *ber.Packet) {
+	base := op.Children[0].Data.String()
+	scope, _ := op.Children[1].Value.(int64)
+	filter, _ := ldap.DecompileFilter(op.Children[6])
+	var requested []string
+	for _, a := range op.Children[7].Children {
+		requested = append(requested, a.Data.String())
+	}
+
+	for _, e := range s.entries {
+		match := false
+		if scope == ldap.ScopeBaseObject {
+			match = strings.EqualFold(e.dn, base)
+		} else if strings.HasSuffix(strings.ToLower(e.dn), ","+strings.ToLower(base)) {
+			for name, values := range e.attrs {
+				for _, v := range values {
+					match = match || strings.Contains(filter, "("+name+"="+v+")")
+				}
+			}
+		}
+		if !match {
+			continue
+		}
+
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for _, name := range requested {
+			if len(e.attrs[name]) == 0 {
+				continue
+			}
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, v := range e.attrs[name] {
+				values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+			attribute.AppendChild(values)
+			attributes.AppendChild(attribute)
+		}
+		entry.AppendChild(attributes)
+		conn.Write(ldapMessage(id, entry).Bytes())
+	}
+	conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapMessage(id, result)
+}
+
+// A directory with people under two OUs, so a login needs the second DN template
+// when the first does not exist for that user.
+func newTestDirectory(t *testing.T) *ldapTestServer {
+	return newLDAPTestServer(t,
+		ldapTestEntry{
+			dn:       "uid=alice,ou=people,dc=example,dc=com",
+			password: "alice-secret",
+			attrs: map[string][]string{
+				"uid":         {"alice"},
+				"mail":        {"alice@example.com"},
+				"displayName": {"Alice Admin"},
+				"memberOf":    {"cn=App Admins,ou=groups,dc=example,dc=com", "cn=Staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+		ldapTestEntry{
+			dn:       "cn=bob,ou=contractors,dc=example,dc=com",
+			password: "bob-secret",
+			attrs: map[string][]string{
+				"cn":          {"bob"},
+				"mail":        {"bob@example.com"},
+				"displayName": {"Bob Builder"},
+				"memberOf":    {"cn=Editors,ou=groups,dc=example,dc=com"},
+			},
+		},
+		ldapTestEntry{
+			dn:       "uid=carol@example.com,ou=people,dc=example,dc=com",
+			password: "carol-secret",
+			attrs: map[string][]string{
+				"uid":         {"carol@example.com"},
+				"displayName": {"Carol No Mail"},
+			},
+		},
+	)
+}
+
+func testLDAPConfig(url string) config.LDAPConfig {
+	return config.LDAPConfig{
+		URL:             url,
+		Timeout:         5 * time.Second,
+		UserDNTemplates: "uid={username},ou=people,dc=example,dc=com; cn={username},ou=contractors,dc=example,dc=com",
+		EmailAttribute:  "mail",
+		NameAttribute:   "displayName",
+		GroupAttribute:  "memberOf",
+		RoleMapping:     "cn=App Admins,ou=groups,dc=example,dc=com=admin;Editors=editor",
+		DefaultRole:     "user",
+		AutoProvision:   true,
+	}
+}
+
+func newTestLDAPAuthenticator(cfg config.LDAPConfig, users *fakeUserRepo) Authenticator {
+	return NewLDAPAuthenticator(auth.NewLDAPClient(cfg), users, newFakeRoleRepo("admin", "editor", "user"), fakePasswords{}, cfg)
+}
+
+func TestLDAPAuthenticatorBindsWithEachDNTemplate(t *testing.T) {
+	dir := newTestDirectory(t)
+	users := &fakeUserRepo{}
+	a := newTestLDAPAuthenticator(testLDAPConfig(dir.URL()), users)
+
+	alice, err := a.Authenticate("alice", "alice-secret", nil)
+	if err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	if alice.Email != "alice@example.com" {
+		t.Errorf("alice email = %q", alice.Email)
+	}
+
+	bob, err := a.Authenticate("bob", "bob-secret", nil)
+	if err != nil {
+		t.Fatalf("bob: %v", err)
+	}
+	if bob.Email != "bob@example.com" {
+		t.Errorf("bob email = %q", bob.Email)
+	}
+
+	want := []string{
+		"uid=alice,ou=people,dc=example,dc=com",
+		"uid=bob,ou=people,dc=example,dc=com",
+		"cn=bob,ou=contractors,dc=example,dc=com",
+	}
+	if got := dir.bindAttempts(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("binds = %q, want %q", got, want)
+	}
+}
+
+func TestLDAPAuthenticatorSearchesBaseDN(t *testing.T) {
+	dir := newTestDirectory(t)
+	cfg := testLDAPConfig(dir.URL())
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.UserFilter = "(|(uid={username})(cn={username}))"
+	users := &fakeUserRepo{}
+
+	user, err := newTestLDAPAuthenticator(cfg, users).Authenticate("bob", "bob-secret", nil)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Email != "bob@example.com" || user.Name != "Bob Builder" {
+		t.Errorf("user = %q %q", user.Email, user.Name)
+	}
+}
+
+func TestLDAPAuthenticatorRejectsWrongPassword(t *testing.T) {
+	dir := newTestDirectory(t)
+	users := &fakeUserRepo{}
+	a := newTestLDAPAuthenticator(testLDAPConfig(dir.URL()), users)
+
+	if _, err := a.Authenticate("alice", "bob-secret", nil); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := a.Authenticate("nobody", "alice-secret", nil); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("unknown user: err = %v, want ErrInvalidCredentials", err)
+	}
+	if users.count() != 0 {
+		t.Errorf("%d users created after failed logins", users.count())
+	}
+}
+
+func TestLDAPAuthenticatorRejectsEmptyPassword(t *testing.T) {
+	dir := newTestDirectory(t)
+	users := &fakeUserRepo{}
+	a := newTestLDAPAuthenticator(testLDAPConfig(dir.URL()), users)
+
+	if _, err := a.Authenticate("alice", "", nil); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	// The test server would have accepted it as an anonymous bind
+	if binds := dir.bindAttempts(); len(binds) != 0 {
+		t.Errorf("empty password reached the directory: %q", binds)
+	}
+}
+
+func TestLDAPAuthenticatorMapsGroupsToRoles(t *testing.T) {
+	dir := newTestDirectory(t)
+	users := &fakeUserRepo{}
+	existing := users.add(models.User{Email: "bob@example.com", Name: "Bob", Role: "user", RoleID: 3, IsActive: true})
+	a := newTestLDAPAuthenticator(testLDAPConfig(dir.URL()), users)
+
+	// Mapped by the group's full DN when the account is created
+	alice, err := a.Authenticate("alice", "alice-secret", nil)
+	if err != nil {
+		t.Fatalf("alice: %v", err)
+	}
+	if alice.Role != "admin" || alice.RoleID != 1 {
+		t.Errorf("alice role = %s (%d), want admin", alice.Role, alice.RoleID)
+	}
+
+	// Mapped by CN, and synced onto an existing account
+	bob, err := a.Authenticate("bob", "bob-secret", existing)
+	if err != nil {
+		t.Fatalf("bob: %v", err)
+	}
+	if bob.ID != existing.ID || bob.Role != "editor" {
+		t.Errorf("bob = ID %d role %s, want ID %d role editor", bob.ID, bob.Role, existing.ID)
+	}
+	if stored, _ := users.GetByID(existing.ID); stored.Role != "editor" || stored.UpdatedBy != "LDAP" {
+		t.Errorf("stored bob role = %s updated by %q", stored.Role, stored.UpdatedBy)
+	}
+	if !users.logged("ROLE_SYNC bob@example.com") {
+		t.Error("role change not logged")
+	}
+}
+
+func TestLDAPAuthenticatorCreatesUserOnFirstLogin(t *testing.T) {
+	dir := newTestDirectory(t)
+	cfg := testLDAPConfig(dir.URL())
+	cfg.RoleMapping = ""
+	users := &fakeUserRepo{}
+
+	user, err := newTestLDAPAuthenticator(cfg, users).Authenticate("bob", "bob-secret", nil)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	stored, err := users.GetByEmail("bob@example.com")
+	if err != nil {
+		t.Fatalf("no Users row created: %v", err)
+	}
+	if stored.ID != user.ID || stored.Name != "Bob Builder" || stored.Role != "user" || !stored.IsActive || stored.CreatedBy != "LDAP" {
+		t.Errorf("created row = %+v", stored)
+	}
+	if !strings.HasPrefix(stored.Password, "hashed:") || stored.Password == "hashed:bob-secret" {
+		t.Errorf("created row should get an unusable password, got %q", stored.Password)
+	}
+	if !users.logged("LDAP_PROVISIONED bob@example.com") {
+		t.Error("provisioning not logged")
+	}
+
+	// A second login finds the row instead of creating another
+	if _, err := newTestLDAPAuthenticator(cfg, users).Authenticate("bob", "bob-secret", nil); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if users.count() != 1 {
+		t.Errorf("%d users after two logins, want 1", users.count())
+	}
+}
+
+func TestLDAPAuthenticatorWithoutAutoProvision(t *testing.T) {
+	dir := newTestDirectory(t)
+	cfg := testLDAPConfig(dir.URL())
+	cfg.AutoProvision = false
+	users := &fakeUserRepo{}
+
+	if _, err := newTestLDAPAuthenticator(cfg, users).Authenticate("bob", "bob-secret", nil); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if users.count() != 0 {
+		t.Errorf("%d users created", users.count())
+	}
+}
+
+func TestLDAPAuthenticatorIgnoresLoginNameAsEmail(t *testing.T) {
+	dir := newTestDirectory(t)
+	users := &fakeUserRepo{}
+	victim := users.add(models.User{Email: "carol@example.com", Name: "Carol", Role: "admin", RoleID: 1, IsActive: true})
+	a := newTestLDAPAuthenticator(testLDAPConfig(dir.URL()), users)
+
+	// The entry has no mail attribute, so the typed name must not pick the account
+	user, err := a.Authenticate("carol@example.com", "carol-secret", nil)
+	if err == nil {
+		t.Fatalf("login without a directory email succeeded as user %d", user.ID)
+	}
+	if stored, _ := users.GetByID(victim.ID); stored.Role != "admin" || users.count() != 1 {
+		t.Errorf("users changed: role %s, %d rows", stored.Role, users.count())
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go-pertama/config"
+)
+
+var ErrCaptchaFailed = errors.New("captcha verification failed")
+
+// CaptchaVerifier checks the token a CAPTCHA widget gave the browser.
+// Verify returns ErrCaptchaFailed when the token is rejected.
+type CaptchaVerifier interface {
+	Verify(token, remoteIP string) error
+	SiteKey() string
+}
+
+// NewCaptchaVerifier returns a siteverify client, or a verifier that accepts
+// everything when no verify URL is configured.
+func NewCaptchaVerifier(cfg config.CaptchaConfig) CaptchaVerifier {
+	if cfg.VerifyURL == "" {
+		return noCaptcha{}
+	}
+	return &SiteVerifyCaptcha{
+		verifyURL: cfg.VerifyURL,
+		siteKey:   cfg.SiteKey,
+		secret:    cfg.Secret,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type noCaptcha struct{}
+
+func (noCaptcha) Verify(token, remoteIP string) error { return nil }
+func (noCaptcha) SiteKey() string                     { return "" }
+
+// SiteVerifyCaptcha speaks the siteverify protocol shared by reCAPTCHA,
+// hCaptcha and Turnstile: a form POST of secret, response and remoteip
+// answered with {"success": true|false}.
+type SiteVerifyCaptcha struct {
+	verifyURL string
+	siteKey   string
+	secret    string
+	client    *http.Client
+}
+
+func (c *SiteVerifyCaptcha) SiteKey() string { return c.siteKey }
+
+func (c *SiteVerifyCaptcha) Verify(token, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaFailed
+	}
+
+	resp, err := c.client.PostForm(c.verifyURL, url.Values{
+		"secret":   {c.secret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	})
+	if err != nil {
+		return fmt.Errorf("captcha verification unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha verification unavailable: %s", resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification unavailable: %w", err)
+	}
+	if !result.Success {
+		return ErrCaptchaFailed
+	}
+	return nil
+}
@@ -3,19 +3,24 @@ package services
 import (
 	"encoding/json"
 	"errors"
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/repository"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type ConfigService interface {
 	GetAllConfigs(search, typeFilter string, page, limit int) ([]models.SystemConfig, int64, error)
 	GetConfigByID(id int64) (*models.SystemConfig, error)
-	CreateConfig(config *models.SystemConfig, createdBy string) error
-	UpdateConfig(id int64, updateData *models.SystemConfig, updatedBy string, ip string, changeReason string) error
+	CreateConfig(config *models.SystemConfig, actor *auth.Principal) error
+	UpdateConfig(id int64, updateData *models.SystemConfig, actor *auth.Principal, ip string, changeReason string) error
 	DeleteConfig(id int64) error
 	GetConfigHistory(id int64) ([]models.SystemConfigHistory, error)
+	GetInt(key string, fallback int) int
+	GetBool(key string, fallback bool) bool
+	GetString(key string, fallback string) string
 }
 
 type configService struct {
@@ -34,7 +39,7 @@ func (s *configService) GetConfigByID(id int64) (*models.SystemConfig, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *configService) CreateConfig(config *models.SystemConfig, createdBy string) error {
+func (s *configService) CreateConfig(config *models.SystemConfig, actor *auth.Principal) error {
 	// Validate Data Type
 	if err := validateValue(config.MainValue, config.DataType); err != nil {
 		return err
@@ -46,14 +51,15 @@ func (s *configService) CreateConfig(config *models.SystemConfig, createdBy stri
 		return errors.New("config key already exists")
 	}
 
-	config.CreatedBy = createdBy
+	config.CreatedBy = actor.Email
+	config.UpdatedBy = actor.Email
 	config.CreatedAt = time.Now()
 	config.IsActive = true // Default
 
 	return s.repo.Create(config)
 }
 
-func (s *configService) UpdateConfig(id int64, updateData *models.SystemConfig, updatedBy string, ip string, changeReason string) error {
+func (s *configService) UpdateConfig(id int64, updateData *models.SystemConfig, actor *auth.Principal, ip string, changeReason string) error {
 	existing, err := s.repo.FindByID(id)
 	if err != nil {
 		return err
@@ -71,7 +77,7 @@ func (s *configService) UpdateConfig(id int64, updateData *models.SystemConfig,
 		NewValue:     updateData.MainValue,
 		ChangeReason: changeReason,
 		ChangedAt:    time.Now(),
-		ChangedBy:    updatedBy,
+		ChangedBy:    actor.Email,
 		IPAddress:    ip,
 	}
 
@@ -80,7 +86,7 @@ func (s *configService) UpdateConfig(id int64, updateData *models.SystemConfig,
 	existing.AlternativeValue = updateData.AlternativeValue
 	existing.Description = updateData.Description
 	existing.IsActive = updateData.IsActive
-	existing.UpdatedBy = updatedBy
+	existing.UpdatedBy = actor.Email
 	existing.UpdatedAt = time.Now()
 
 	if err := s.repo.CreateHistory(history); err != nil {
@@ -98,6 +104,41 @@ func (s *configService) GetConfigHistory(id int64) ([]models.SystemConfigHistory
 	return s.repo.GetHistory(id)
 }
 
+// GetInt returns the active integer config for key, or fallback when it is missing or invalid.
+func (s *configService) GetInt(key string, fallback int) int {
+	config, err := s.repo.FindByKey(key)
+	if err != nil || !config.IsActive {
+		return fallback
+	}
+	value, err := strconv.Atoi(config.MainValue)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetBool returns the active boolean config for key, or fallback when it is missing or invalid.
+func (s *configService) GetBool(key string, fallback bool) bool {
+	config, err := s.repo.FindByKey(key)
+	if err != nil || !config.IsActive {
+		return fallback
+	}
+	value, err := strconv.ParseBool(config.MainValue)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// GetString returns the active config value for key, or fallback when it is missing or blank.
+func (s *configService) GetString(key string, fallback string) string {
+	config, err := s.repo.FindByKey(key)
+	if err != nil || !config.IsActive || strings.TrimSpace(config.MainValue) == "" {
+		return fallback
+	}
+	return config.MainValue
+}
+
 func validateValue(value string, dataType models.DataType) error {
 	switch dataType {
 	case models.TypeInteger:
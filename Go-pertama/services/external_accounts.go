@@ -0,0 +1,125 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+// groupRole is one "group=role" entry of a role mapping.
+type groupRole struct {
+	group string
+	role  string
+}
+
+// parseRoleMapping reads "group=role" pairs separated by sep. The last "=" splits
+// each pair, so group DNs such as "CN=Admins,DC=corp" can be used as keys.
+func parseRoleMapping(value, sep string) []groupRole {
+	var mapping []groupRole
+	for _, entry := range strings.Split(value, sep) {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			continue
+		}
+		group, role := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		if group != "" && role != "" {
+			mapping = append(mapping, groupRole{group: group, role: role})
+		}
+	}
+	return mapping
+}
+
+// mappedRole returns the role of the first mapping entry that matches one of the groups.
+func mappedRole(mapping []groupRole, groups []string) string {
+	for _, m := range mapping {
+		for _, g := range groups {
+			if strings.EqualFold(g, m.group) {
+				return m.role
+			}
+		}
+	}
+	return ""
+}
+
+// externalAccounts creates and updates Users rows for people who authenticate
+// somewhere else (an OIDC provider or LDAP), labelled with source in audit fields.
+type externalAccounts struct {
+	userRepo  repository.UserRepository
+	roleRepo  repository.RoleRepository
+	passwords PasswordService
+	source    string
+}
+
+// provision creates an account on first login. It gets a random password nobody
+// knows; a local password can be set later through the reset flow.
+func (a externalAccounts) provision(email, name, roleName string) (*models.User, error) {
+	role, err := a.roleRepo.FindByName(roleName)
+	if err != nil {
+		return nil, fmt.Errorf("role %q for new %s users does not exist", roleName, a.source)
+	}
+
+	hashed, err := unusablePassword(a.passwords)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = email
+	}
+	err = a.userRepo.Create(&models.User{
+		Email:     email,
+		Password:  hashed,
+		Name:      name,
+		Role:      role.Name,
+		RoleID:    role.ID,
+		IsActive:  true,
+		CreatedBy: a.source,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.userRepo.GetByEmail(email)
+	if err != nil {
+		return nil, errors.New("database connection error")
+	}
+	a.userRepo.LogActivity(user.Email, a.source+"_PROVISIONED", fmt.Sprintf("Account created by %s login with role %s", a.source, role.Name))
+	return user, nil
+}
+
+// syncRole moves the user to roleName. An empty roleName, e.g. when none of the
+// user's groups is mapped, keeps the current role.
+func (a externalAccounts) syncRole(user *models.User, roleName string) error {
+	if roleName == "" || strings.EqualFold(roleName, user.Role) {
+		return nil
+	}
+	role, err := a.roleRepo.FindByName(roleName)
+	if err != nil {
+		return fmt.Errorf("role %q from the %s role mapping does not exist", roleName, a.source)
+	}
+
+	previous := user.Role
+	user.Role = role.Name
+	user.RoleID = role.ID
+	user.UpdatedBy = a.source
+	if err := a.userRepo.Update(user); err != nil {
+		return err
+	}
+	a.userRepo.LogActivity(user.Email, "ROLE_SYNC", fmt.Sprintf("Role changed from %s to %s by %s group membership", previous, role.Name, a.source))
+	return nil
+}
+
+// unusablePassword returns the hash of a random password that is never shown,
+// for accounts that do not sign in with a local password.
+func unusablePassword(passwords PasswordService) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return passwords.Hash(base64.RawURLEncoding.EncodeToString(b))
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+// fakeUserRepo keeps Users rows in memory. Only the methods the tests reach are
+// implemented; anything else panics through the nil embedded interface.
+type fakeUserRepo struct {
+	repository.UserRepository
+
+	mu       sync.Mutex
+	users    []*models.User
+	activity []string
+}
+
+func (r *fakeUserRepo) add(user models.User) *models.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.ID = len(r.users) + 1
+	r.users = append(r.users, &user)
+	return &user
+}
+
+func (r *fakeUserRepo) GetByEmail(email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		// SQL Server compares with a case-insensitive collation
+		if strings.EqualFold(u.Email, email) {
+			copy := *u
+			return &copy, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *fakeUserRepo) GetByID(id int) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id < 1 || id > len(r.users) {
+		return nil, sql.ErrNoRows
+	}
+	copy := *r.users[id-1]
+	return &copy, nil
+}
+
+func (r *fakeUserRepo) Create(user *models.User) error {
+	r.add(*user)
+	return nil
+}
+
+func (r *fakeUserRepo) Update(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user.ID < 1 || user.ID > len(r.users) {
+		return sql.ErrNoRows
+	}
+	copy := *user
+	r.users[user.ID-1] = &copy
+	return nil
+}
+
+func (r *fakeUserRepo) LogActivity(email, action, details string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.activity = append(r.activity, action+" "+email)
+}
+
+func (r *fakeUserRepo) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.users)
+}
+
+func (r *fakeUserRepo) logged(entry string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, a := range r.activity {
+		if a == entry {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeRoleRepo struct {
+	repository.RoleRepository
+	roles []models.Role
+}
+
+func newFakeRoleRepo(names ...string) *fakeRoleRepo {
+	r := &fakeRoleRepo{}
+	for i, name := range names {
+		r.roles = append(r.roles, models.Role{ID: i + 1, Name: name, IsActive: true})
+	}
+	return r
+}
+
+func (r *fakeRoleRepo) FindByName(name string) (*models.Role, error) {
+	for i := range r.roles {
+		if strings.EqualFold(r.roles[i].Name, name) {
+			role := r.roles[i]
+			return &role, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// fakePasswords hashes by prefixing, which is enough to tell a stored hash from
+// the password a test typed.
+type fakePasswords struct {
+	PasswordService
+}
+
+func (fakePasswords) Hash(password string) (string, error) {
+	return "hashed:" + password, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrImpersonationDisabled = errors.New("impersonation is disabled")
+	ErrNotImpersonating      = errors.New("this session is not an impersonation")
+)
+
+type ImpersonationService interface {
+	Start(targetID int, actor *auth.Principal, client models.ClientInfo) (*models.LoginResponse, error)
+	End(principal *auth.Principal) error
+}
+
+type impersonationService struct {
+	sessionRepo repository.SessionRepository
+	sessions    SessionService
+	userRepo    repository.UserRepository
+	roles       RoleService
+	configs     ConfigService
+	tokens      *auth.TokenManager
+}
+
+func NewImpersonationService(sessionRepo repository.SessionRepository, sessions SessionService, userRepo repository.UserRepository, roles RoleService, configs ConfigService, tokens *auth.TokenManager) ImpersonationService {
+	return &impersonationService{
+		sessionRepo: sessionRepo,
+		sessions:    sessions,
+		userRepo:    userRepo,
+		roles:       roles,
+		configs:     configs,
+		tokens:      tokens,
+	}
+}
+
+// Start opens a short session as the target user, tagged with the admin.
+// Only an access token is issued, so the session cannot be refreshed past
+// impersonation_minutes.
+func (s *impersonationService) Start(targetID int, actor *auth.Principal, client models.ClientInfo) (*models.LoginResponse, error) {
+	minutes := s.configs.GetInt("impersonation_minutes", 30)
+	if minutes <= 0 {
+		return nil, ErrImpersonationDisabled
+	}
+	if actor.Impersonating() {
+		return nil, errors.New("end the current impersonation first")
+	}
+	if actor.APIKeyID != 0 {
+		return nil, errors.New("API keys cannot impersonate users")
+	}
+
+	target, err := s.userRepo.GetByID(targetID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if target.ID == actor.UserID {
+		return nil, errors.New("you cannot impersonate yourself")
+	}
+	if !target.IsActive {
+		return nil, errors.New("account is inactive")
+	}
+	if target.IsServiceAccount {
+		return nil, errors.New("service accounts cannot be impersonated")
+	}
+
+	// Nobody may gain a permission by impersonating, so the target's role must be covered by the actor's
+	permissions, err := s.roles.GetPermissionsByEmail(target.Email)
+	if err != nil {
+		return nil, errors.New("database connection error")
+	}
+	for _, p := range permissions {
+		if !actor.HasPermission(p) {
+			return nil, fmt.Errorf("you cannot impersonate a user with permission %q", p)
+		}
+	}
+
+	id, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+	now := time.Now()
+	impersonatorID := actor.UserID
+	session := &models.Session{
+		ID:             id,
+		UserID:         target.ID,
+		ImpersonatorID: &impersonatorID,
+		IPAddress:      client.IPAddress,
+		UserAgent:      truncate(client.UserAgent, 255),
+		CreatedAt:      now,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(time.Duration(minutes) * time.Minute),
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, errors.New("database connection error")
+	}
+
+	token, claims, err := s.tokens.Issue(target, session.ID)
+	if err != nil {
+		s.sessionRepo.Revoke(session.ID)
+		return nil, errors.New("failed to generate token")
+	}
+	expiresAt := claims.ExpiresAt.Time
+	if session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+
+	s.userRepo.LogActivity(actor.Email, "IMPERSONATE_START", fmt.Sprintf("Started impersonating %s (ID %d) until %s", target.Email, target.ID, session.ExpiresAt.Format(time.RFC3339)))
+	s.userRepo.LogActivity(target.Email, "IMPERSONATE_START", fmt.Sprintf("Impersonated by %s (ID %d) until %s", actor.Email, actor.UserID, session.ExpiresAt.Format(time.RFC3339)))
+
+	target.Password = ""
+	target.ImpersonatedBy = &models.Impersonator{ID: actor.UserID, Email: actor.Email, Name: actor.Name}
+	return &models.LoginResponse{
+		Message:   "Impersonation started",
+		Token:     token,
+		ExpiresAt: &expiresAt,
+		Success:   true,
+		User:      target,
+	}, nil
+}
+
+// End closes the impersonation session the request was made with.
+func (s *impersonationService) End(principal *auth.Principal) error {
+	if !principal.Impersonating() {
+		return ErrNotImpersonating
+	}
+	if err := s.sessions.Revoke(principal.SessionID); err != nil {
+		return err
+	}
+
+	s.userRepo.LogActivity(principal.ImpersonatorEmail, "IMPERSONATE_END", fmt.Sprintf("Stopped impersonating %s (ID %d)", principal.Email, principal.UserID))
+	s.userRepo.LogActivity(principal.Email, "IMPERSONATE_END", fmt.Sprintf("Impersonation by %s (ID %d) ended", principal.ImpersonatorEmail, principal.ImpersonatorID))
+	return nil
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/mailer"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+	ErrInvitationPending  = errors.New("a pending invitation already exists for this email, resend it instead")
+	ErrInvitationClosed   = errors.New("invitation was already accepted or revoked")
+)
+
+// maxInvitationHours caps how long an invitation link can stay valid.
+const maxInvitationHours = 30 * 24
+
+type InvitationService interface {
+	List(status, search string, page, limit int) (*models.InvitationsResponse, error)
+	Create(req models.CreateInvitationRequest, actor *auth.Principal) (*models.Invitation, error)
+	Resend(id int64, actor *auth.Principal) (*models.Invitation, error)
+	Revoke(id int64, actor *auth.Principal) error
+	Lookup(token string) (*models.Invitation, error)
+	Accept(req models.AcceptInvitationRequest, client models.ClientInfo) error
+}
+
+type invitationService struct {
+	repo      repository.InvitationRepository
+	userRepo  repository.UserRepository
+	roleRepo  repository.RoleRepository
+	configs   ConfigService
+	passwords PasswordService
+	mailer    mailer.Mailer
+	publicURL string
+}
+
+func NewInvitationService(repo repository.InvitationRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository, configs ConfigService, passwords PasswordService, m mailer.Mailer, publicURL string) InvitationService {
+	return &invitationService{
+		repo:      repo,
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+		configs:   configs,
+		passwords: passwords,
+		mailer:    m,
+		publicURL: strings.TrimRight(publicURL, "/"),
+	}
+}
+
+func (s *invitationService) List(status, search string, page, limit int) (*models.InvitationsResponse, error) {
+	switch status {
+	case "", models.InvitationPending, models.InvitationAccepted, models.InvitationRevoked, models.InvitationExpired:
+	default:
+		return nil, fmt.Errorf("unknown invitation status %q", status)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 5
+	}
+
+	invitations, total, err := s.repo.FindAll(status, search, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range invitations {
+		invitations[i].Status = invitations[i].CurrentStatus()
+	}
+	return &models.InvitationsResponse{Data: invitations, Total: total, Page: page, Limit: limit}, nil
+}
+
+func (s *invitationService) Create(req models.CreateInvitationRequest, actor *auth.Principal) (*models.Invitation, error) {
+	email := strings.TrimSpace(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, errors.New("invalid email address")
+	}
+	if exists, _ := s.userRepo.EmailExists(email); exists {
+		return nil, errors.New("email already exists")
+	}
+	if _, err := s.repo.FindPendingByEmail(email); err == nil {
+		return nil, ErrInvitationPending
+	}
+
+	role, err := s.roleRepo.FindByID(req.RoleID)
+	if err != nil {
+		return nil, errors.New("role not found")
+	}
+	if !role.IsActive {
+		return nil, fmt.Errorf("role %q is inactive", role.Name)
+	}
+
+	hours := req.ExpiresInHours
+	if hours == 0 {
+		hours = s.configs.GetInt("invitation_expiry_hours", 72)
+	}
+	if hours < 1 || hours > maxInvitationHours {
+		return nil, fmt.Errorf("invitations can be valid for 1 to %d hours", maxInvitationHours)
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	invitation := &models.Invitation{
+		Email:     email,
+		Name:      strings.TrimSpace(req.Name),
+		RoleID:    role.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(time.Duration(hours) * time.Hour),
+		SentAt:    now,
+		InvitedBy: actor.Name,
+		CreatedAt: now,
+	}
+	if err := s.repo.Create(invitation); err != nil {
+		return nil, errors.New("database connection error")
+	}
+	invitation.RoleName = role.Name
+	invitation.Status = models.InvitationPending
+
+	s.send(invitation, token)
+	s.userRepo.LogActivity(actor.Email, "INVITATION_CREATED", fmt.Sprintf("Invited %s as %s, link valid until %s", email, role.Name, invitation.ExpiresAt.Format("2006-01-02 15:04")))
+	return invitation, nil
+}
+
+// Resend emails a new link, valid for as long as the first one was. Links
+// sent before stop working.
+func (s *invitationService) Resend(id int64, actor *auth.Principal) (*models.Invitation, error) {
+	invitation, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, ErrInvitationNotFound
+	}
+	if status := invitation.CurrentStatus(); status == models.InvitationAccepted || status == models.InvitationRevoked {
+		return nil, ErrInvitationClosed
+	}
+
+	validFor := invitation.ExpiresAt.Sub(invitation.SentAt)
+	if validFor <= 0 {
+		validFor = time.Duration(s.configs.GetInt("invitation_expiry_hours", 72)) * time.Hour
+	}
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	invitation.TokenHash = auth.HashToken(token)
+	invitation.SentAt = time.Now()
+	invitation.ExpiresAt = invitation.SentAt.Add(validFor)
+	if err := s.repo.Resend(id, invitation.TokenHash, invitation.ExpiresAt); err != nil {
+		return nil, errors.New("database connection error")
+	}
+	invitation.Status = models.InvitationPending
+
+	s.send(invitation, token)
+	s.userRepo.LogActivity(actor.Email, "INVITATION_RESENT", fmt.Sprintf("Resent invitation %d to %s, link valid until %s", id, invitation.Email, invitation.ExpiresAt.Format("2006-01-02 15:04")))
+	return invitation, nil
+}
+
+func (s *invitationService) Revoke(id int64, actor *auth.Principal) error {
+	invitation, err := s.repo.FindByID(id)
+	if err != nil {
+		return ErrInvitationNotFound
+	}
+	ok, err := s.repo.Revoke(id, actor.Name)
+	if err != nil {
+		return errors.New("database connection error")
+	}
+	if !ok {
+		return ErrInvitationClosed
+	}
+	s.userRepo.LogActivity(actor.Email, "INVITATION_REVOKED", fmt.Sprintf("Revoked invitation %d to %s", id, invitation.Email))
+	return nil
+}
+
+func (s *invitationService) send(invitation *models.Invitation, token string) {
+	link := fmt.Sprintf("%s/accept-invitation?token=%s", s.publicURL, url.QueryEscape(token))
+	greeting := "Hello"
+	if invitation.Name != "" {
+		greeting += " " + invitation.Name
+	}
+	err := s.mailer.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("%s,\n\n%s has invited you to create an account. Open the link below to choose your password:\n\n%s\n\n"+
+			"The link expires at %s and can be used once. If you were not expecting this, you can ignore this email.\n",
+			greeting, invitation.InvitedBy, link, invitation.ExpiresAt.Format("2006-01-02 15:04 MST")),
+	})
+	if err != nil {
+		log.Printf("Failed to send invitation email to %s: %v", invitation.Email, err)
+	}
+}
+
+// Lookup returns the pending invitation behind a link, so the accept page can
+// show who it is for.
+func (s *invitationService) Lookup(token string) (*models.Invitation, error) {
+	invitation, err := s.repo.FindByHash(auth.HashToken(token))
+	if err != nil || invitation.CurrentStatus() != models.InvitationPending {
+		return nil, ErrInvalidInvitation
+	}
+	invitation.Status = models.InvitationPending
+	return invitation, nil
+}
+
+// Accept consumes the invitation and creates the user with the invited email
+// and role and the password the invitee chose.
+func (s *invitationService) Accept(req models.AcceptInvitationRequest, client models.ClientInfo) error {
+	invitation, err := s.Lookup(req.Token)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = invitation.Name
+	}
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if exists, _ := s.userRepo.EmailExists(invitation.Email); exists {
+		return errors.New("email already exists")
+	}
+	if err := s.passwords.Validate(0, invitation.Email, req.Password); err != nil {
+		return err
+	}
+	hashedPassword, err := s.passwords.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.repo.MarkAccepted(invitation.ID)
+	if err != nil {
+		return errors.New("database connection error")
+	}
+	if !ok {
+		return ErrInvalidInvitation
+	}
+
+	user := models.User{
+		Email:     invitation.Email,
+		Password:  hashedPassword,
+		Name:      name,
+		Role:      invitation.RoleName,
+		RoleID:    invitation.RoleID,
+		IsActive:  true,
+		CreatedBy: invitation.InvitedBy,
+		UpdatedBy: invitation.InvitedBy,
+	}
+	if err := s.userRepo.Create(&user); err != nil {
+		// Let the invitee try again, e.g. after a duplicate email was removed
+		s.repo.Reopen(invitation.ID)
+		return errors.New("database connection error")
+	}
+	if created, err := s.userRepo.GetByEmail(invitation.Email); err == nil {
+		s.repo.SetAcceptedUser(invitation.ID, created.ID)
+		s.passwords.Remember(created.ID, hashedPassword)
+	}
+
+	s.userRepo.LogActivity(invitation.Email, "INVITATION_ACCEPTED", fmt.Sprintf("Accepted invitation %d from %s as %s from %s", invitation.ID, invitation.InvitedBy, invitation.RoleName, client.IPAddress))
+	return nil
+}
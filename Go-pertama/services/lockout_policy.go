@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// AccountLockedError is returned by Login while an account is locked out.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("account locked until %s", e.Until.Format(time.RFC3339))
+}
+
+// RetryAfter is how long the caller has to wait before trying again.
+func (e *AccountLockedError) RetryAfter() time.Duration {
+	d := time.Until(e.Until)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// LockoutPolicy decides how long an account is locked after repeated failed logins.
+type LockoutPolicy struct {
+	MaxAttempts       int
+	Duration          time.Duration
+	BackoffMultiplier int
+	MaxDuration       time.Duration
+}
+
+// loadLockoutPolicy reads the policy from system_configs on every call so edits apply immediately.
+func loadLockoutPolicy(configs ConfigService) LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts:       configs.GetInt("max_login_attempts", 5),
+		Duration:          time.Duration(configs.GetInt("lockout_duration_minutes", 15)) * time.Minute,
+		BackoffMultiplier: configs.GetInt("lockout_backoff_multiplier", 2),
+		MaxDuration:       time.Duration(configs.GetInt("lockout_max_duration_minutes", 1440)) * time.Minute,
+	}
+}
+
+// LockDuration returns how long to lock the account after the given number of
+// consecutive failures, or 0 if this failure does not trigger a lockout.
+// Every MaxAttempts failures lock the account again, each time longer by BackoffMultiplier.
+func (p LockoutPolicy) LockDuration(attempts int) time.Duration {
+	if p.MaxAttempts <= 0 || p.Duration <= 0 || attempts < p.MaxAttempts || attempts%p.MaxAttempts != 0 {
+		return 0
+	}
+
+	d := p.Duration
+	for i := 1; i < attempts/p.MaxAttempts; i++ {
+		if p.BackoffMultiplier > 1 {
+			d *= time.Duration(p.BackoffMultiplier)
+		}
+		if p.MaxDuration > 0 && d >= p.MaxDuration {
+			return p.MaxDuration
+		}
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		return p.MaxDuration
+	}
+	return d
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyLockDuration(t *testing.T) {
+	policy := LockoutPolicy{MaxAttempts: 5, Duration: 15 * time.Minute, BackoffMultiplier: 2, MaxDuration: time.Hour}
+
+	tests := []struct {
+		name     string
+		policy   LockoutPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{"below the limit", policy, 4, 0},
+		{"first lockout", policy, 5, 15 * time.Minute},
+		{"between lockouts", policy, 6, 0},
+		{"second lockout doubles", policy, 10, 30 * time.Minute},
+		{"third lockout reaches the cap", policy, 15, time.Hour},
+		{"later lockouts stay at the cap", policy, 40, time.Hour},
+		{"no backoff", LockoutPolicy{MaxAttempts: 5, Duration: 15 * time.Minute, BackoffMultiplier: 1, MaxDuration: time.Hour}, 10, 15 * time.Minute},
+		{"no cap", LockoutPolicy{MaxAttempts: 5, Duration: 15 * time.Minute, BackoffMultiplier: 2}, 20, 2 * time.Hour},
+		{"cap below the first lockout", LockoutPolicy{MaxAttempts: 5, Duration: 15 * time.Minute, BackoffMultiplier: 2, MaxDuration: 10 * time.Minute}, 5, 10 * time.Minute},
+		{"lockout disabled", LockoutPolicy{MaxAttempts: 0, Duration: 15 * time.Minute}, 5, 0},
+		{"zero duration", LockoutPolicy{MaxAttempts: 5}, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.LockDuration(tt.attempts); got != tt.want {
+				t.Errorf("LockDuration(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
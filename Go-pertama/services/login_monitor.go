@@ -0,0 +1,235 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/geoip"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrSecurityEventNotFound     = errors.New("security event not found")
+	ErrSecurityEventAcknowledged = errors.New("security event already acknowledged")
+)
+
+// minTravelKm ignores jumps smaller than GeoIP's accuracy, e.g. a phone
+// moving between mobile and office networks in the same region.
+const minTravelKm = 300
+
+// LoginMonitorService remembers each user's devices and flags logins from a
+// new device, a new country or a place too far from the previous login to
+// have travelled in between.
+type LoginMonitorService interface {
+	Inspect(user *models.User, client models.ClientInfo)
+	ListOwn(userID int, open bool, page, limit int) (*models.SecurityEventsResponse, error)
+	List(filter models.SecurityEventFilter) (*models.SecurityEventsResponse, error)
+	AcknowledgeOwn(id int64, actor *auth.Principal) error
+	Acknowledge(id int64, actor *auth.Principal) error
+}
+
+type loginMonitorService struct {
+	repo     repository.SecurityEventRepository
+	userRepo repository.UserRepository
+	configs  ConfigService
+	geo      *geoip.Reader
+	notifier SecurityNotifier
+}
+
+func NewLoginMonitorService(repo repository.SecurityEventRepository, userRepo repository.UserRepository, configs ConfigService, geo *geoip.Reader, notifier SecurityNotifier) LoginMonitorService {
+	return &loginMonitorService{repo: repo, userRepo: userRepo, configs: configs, geo: geo, notifier: notifier}
+}
+
+// Inspect runs after a successful login. It never blocks the login: failures
+// are logged and the login goes ahead.
+func (s *loginMonitorService) Inspect(user *models.User, client models.ClientInfo) {
+	if !s.configs.GetBool("login_alerts_enabled", true) {
+		return
+	}
+
+	now := time.Now()
+	loc := s.geo.Lookup(client.IPAddress)
+	fingerprint := deviceFingerprint(client)
+
+	devices, err := s.repo.CountDevices(user.ID)
+	if err != nil {
+		log.Printf("Login monitor: cannot read devices of %s: %v", user.Email, err)
+		return
+	}
+
+	var reasons, details []string
+	device, err := s.repo.FindDevice(user.ID, fingerprint)
+	known := err == nil
+	// The very first login only teaches us the device; there is nothing to compare with
+	if devices > 0 {
+		if !known {
+			reasons = append(reasons, models.LoginFlagNewDevice)
+			details = append(details, "Sign-in from a device not seen before")
+		}
+		if loc != nil && loc.Country != "" {
+			countries, err := s.repo.KnownCountries(user.ID)
+			if err == nil && len(countries) > 0 && !containsString(countries, loc.Country) {
+				reasons = append(reasons, models.LoginFlagNewCountry)
+				details = append(details, fmt.Sprintf("Sign-in from %s, a country not seen before", loc.Country))
+			}
+		}
+		if last, err := s.repo.LastDevice(user.ID); err == nil {
+			if km, kmh, ok := travelSpeed(last, loc, now); ok && km >= minTravelKm && kmh > float64(s.configs.GetInt("impossible_travel_kmh", 1000)) {
+				reasons = append(reasons, models.LoginFlagImpossibleTravel)
+				details = append(details, fmt.Sprintf("%.0f km from the previous sign-in (%s) %s earlier, about %.0f km/h",
+					km, last.IPAddress, now.Sub(last.LastSeenAt).Round(time.Minute), kmh))
+			}
+		}
+	}
+
+	if !known {
+		device = &models.KnownDevice{UserID: user.ID, Fingerprint: fingerprint, FirstSeenAt: now}
+	}
+	device.UserAgent = truncate(client.UserAgent, 255)
+	device.IPAddress = client.IPAddress
+	device.LastSeenAt = now
+	if loc != nil {
+		device.Country = loc.Country
+		device.Latitude, device.Longitude = loc.Latitude, loc.Longitude
+	}
+	if err := s.repo.SaveDevice(device); err != nil {
+		log.Printf("Login monitor: cannot save device of %s: %v", user.Email, err)
+	}
+
+	if len(reasons) == 0 {
+		return
+	}
+	event := &models.SecurityEvent{
+		UserID:    user.ID,
+		Reasons:   reasons,
+		Details:   strings.Join(details, "; "),
+		IPAddress: client.IPAddress,
+		UserAgent: truncate(client.UserAgent, 255),
+		Country:   device.Country,
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateEvent(event); err != nil {
+		log.Printf("Login monitor: cannot save security event for %s: %v", user.Email, err)
+		return
+	}
+	s.userRepo.LogActivity(user.Email, "SUSPICIOUS_LOGIN", fmt.Sprintf("%s from %s (event %d)", event.Details, client.IPAddress, event.ID))
+
+	if s.notifier != nil {
+		go func() {
+			if err := s.notifier.NotifySuspiciousLogin(user, event); err != nil {
+				log.Printf("Login monitor: %v", err)
+			}
+		}()
+	}
+}
+
+func (s *loginMonitorService) ListOwn(userID int, open bool, page, limit int) (*models.SecurityEventsResponse, error) {
+	return s.List(models.SecurityEventFilter{UserID: userID, Open: open, Page: page, Limit: limit})
+}
+
+func (s *loginMonitorService) List(filter models.SecurityEventFilter) (*models.SecurityEventsResponse, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+	events, total, err := s.repo.ListEvents(filter)
+	if err != nil {
+		return nil, errors.New("database connection error")
+	}
+	return &models.SecurityEventsResponse{Data: events, Total: total, Page: filter.Page, Limit: filter.Limit}, nil
+}
+
+// AcknowledgeOwn lets users confirm that a flagged login was them.
+func (s *loginMonitorService) AcknowledgeOwn(id int64, actor *auth.Principal) error {
+	event, err := s.repo.FindEvent(id)
+	if err != nil || event.UserID != actor.UserID {
+		return ErrSecurityEventNotFound
+	}
+	return s.acknowledge(event, actor)
+}
+
+// Acknowledge closes any user's event after an admin has reviewed it.
+func (s *loginMonitorService) Acknowledge(id int64, actor *auth.Principal) error {
+	event, err := s.repo.FindEvent(id)
+	if err != nil {
+		return ErrSecurityEventNotFound
+	}
+	return s.acknowledge(event, actor)
+}
+
+func (s *loginMonitorService) acknowledge(event *models.SecurityEvent, actor *auth.Principal) error {
+	ok, err := s.repo.Acknowledge(event.ID, actor.Email)
+	if err != nil {
+		return errors.New("database connection error")
+	}
+	if !ok {
+		return ErrSecurityEventAcknowledged
+	}
+	s.userRepo.LogActivity(actor.Email, "SECURITY_EVENT_ACK", fmt.Sprintf("Acknowledged security event %d of %s", event.ID, event.UserEmail))
+	return nil
+}
+
+// versionNumbers are dropped from user agents so browser updates keep the fingerprint.
+var versionNumbers = regexp.MustCompile(`[0-9]+([._][0-9]+)*`)
+
+// deviceFingerprint identifies a browser on a network: the user agent without
+// version numbers plus the /24 (IPv4) or /48 (IPv6) the address is in.
+func deviceFingerprint(client models.ClientInfo) string {
+	network := client.IPAddress
+	if addr, err := netip.ParseAddr(client.IPAddress); err == nil {
+		addr = addr.Unmap()
+		bits := 48
+		if addr.Is4() {
+			bits = 24
+		}
+		if prefix, err := addr.Prefix(bits); err == nil {
+			network = prefix.String()
+		}
+	}
+	sum := sha256.Sum256([]byte(versionNumbers.ReplaceAllString(client.UserAgent, "") + "\n" + network))
+	return hex.EncodeToString(sum[:])
+}
+
+// travelSpeed returns the distance from the previous login and the speed
+// needed to cover it, when both places have coordinates.
+func travelSpeed(last *models.KnownDevice, loc *geoip.Location, now time.Time) (km, kmh float64, ok bool) {
+	if last.Latitude == nil || last.Longitude == nil || loc == nil || loc.Latitude == nil || loc.Longitude == nil {
+		return 0, 0, false
+	}
+	km = haversineKm(*last.Latitude, *last.Longitude, *loc.Latitude, *loc.Longitude)
+	hours := now.Sub(last.LastSeenAt).Hours()
+	if hours <= 0 {
+		return km, math.Inf(1), true
+	}
+	return km, km / hours, true
+}
+
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrMFANotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFASetupNotStarted  = errors.New("two-factor setup has not been started")
+	ErrInvalidMFACode      = errors.New("invalid verification code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge, please log in again")
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	mfaRecoveryCodeCount    = 10
+)
+
+type MFAService interface {
+	Status(userID int) (*models.MFAStatus, error)
+	Enabled(userID int) bool
+	BeginSetup(user *models.User) (*models.MFASetupResponse, error)
+	Confirm(userID int, code string) ([]string, error)
+	RegenerateRecoveryCodes(userID int, code string) ([]string, error)
+	Disable(user *models.User, password, code string) error
+	Reset(userID int, actor *auth.Principal) error
+	StartChallenge(userID int) (string, error)
+	ChallengeUser(token string) (int, error)
+	VerifyChallenge(token, code string) (int, error)
+}
+
+type mfaService struct {
+	repo      repository.MFARepository
+	userRepo  repository.UserRepository
+	passwords PasswordService
+	issuer    string
+}
+
+func NewMFAService(repo repository.MFARepository, userRepo repository.UserRepository, passwords PasswordService, issuer string) MFAService {
+	return &mfaService{repo: repo, userRepo: userRepo, passwords: passwords, issuer: issuer}
+}
+
+func (s *mfaService) Status(userID int) (*models.MFAStatus, error) {
+	mfa, err := s.repo.FindByUserID(userID)
+	if err != nil || !mfa.Enabled {
+		return &models.MFAStatus{}, nil
+	}
+	left, err := s.repo.CountRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MFAStatus{Enabled: true, ConfirmedAt: mfa.ConfirmedAt, RecoveryCodesLeft: left}, nil
+}
+
+func (s *mfaService) Enabled(userID int) bool {
+	mfa, err := s.repo.FindByUserID(userID)
+	return err == nil && mfa.Enabled
+}
+
+// BeginSetup stores a fresh, not yet enabled secret. Calling it again replaces a pending secret.
+func (s *mfaService) BeginSetup(user *models.User) (*models.MFASetupResponse, error) {
+	if s.Enabled(user.ID) {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.Save(&models.UserMFA{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFASetupResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm enables MFA once the user proves their app generates valid codes,
+// and returns the recovery codes. They are only ever shown this once.
+func (s *mfaService) Confirm(userID int, code string) ([]string, error) {
+	mfa, err := s.repo.FindByUserID(userID)
+	if err != nil {
+		return nil, ErrMFASetupNotStarted
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, ok := auth.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.ConfirmedAt = &now
+	mfa.LastUsedStep = step
+	mfa.UpdatedAt = now
+	if err := s.repo.Save(mfa); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.newRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.logActivity(userID, "MFA_ENABLED", "Two-factor authentication enabled")
+	return codes, nil
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := s.checkCode(userID, code); err != nil {
+		return nil, err
+	}
+	codes, err := s.newRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	s.logActivity(userID, "MFA_RECOVERY_CODES", "Recovery codes regenerated")
+	return codes, nil
+}
+
+// Disable turns MFA off for the user themself, which needs both the password and a current code.
+func (s *mfaService) Disable(user *models.User, password, code string) error {
+	if !s.passwords.Verify(user, password) {
+		return errors.New("incorrect password")
+	}
+	if err := s.checkCode(user.ID, code); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(user.ID); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(user.Email, "MFA_DISABLED", "Two-factor authentication disabled")
+	return nil
+}
+
+// Reset removes another user's MFA, e.g. after they lost their device.
+func (s *mfaService) Reset(userID int, actor *auth.Principal) error {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if !s.Enabled(userID) {
+		return ErrMFANotEnabled
+	}
+	if err := s.repo.Delete(userID); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(actor.Email, "MFA_RESET", fmt.Sprintf("Reset two-factor authentication for %s", user.Email))
+	s.userRepo.LogActivity(user.Email, "MFA_RESET", fmt.Sprintf("Two-factor authentication reset by %s", actor.Email))
+	return nil
+}
+
+// StartChallenge is called after a correct password and returns the token the
+// client must send back with a code to /auth/mfa/verify.
+func (s *mfaService) StartChallenge(userID int) (string, error) {
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateChallenge(&models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ChallengeUser returns the user a pending challenge belongs to, so the
+// account can be checked before a code is tried.
+func (s *mfaService) ChallengeUser(token string) (int, error) {
+	challenge, err := s.repo.FindChallenge(auth.HashToken(token))
+	if err != nil || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= mfaChallengeMaxAttempts {
+		return 0, ErrInvalidMFAChallenge
+	}
+	return challenge.UserID, nil
+}
+
+// VerifyChallenge checks the code for a pending challenge and returns the user ID on success.
+func (s *mfaService) VerifyChallenge(token, code string) (int, error) {
+	challenge, err := s.repo.FindChallenge(auth.HashToken(token))
+	if err != nil || challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= mfaChallengeMaxAttempts {
+		return 0, ErrInvalidMFAChallenge
+	}
+
+	if err := s.checkCode(challenge.UserID, code); err != nil {
+		s.repo.IncrementChallengeAttempts(challenge.ID)
+		s.logActivity(challenge.UserID, "MFA_FAILED", fmt.Sprintf("Invalid verification code. Attempt: %d", challenge.Attempts+1))
+		return 0, err
+	}
+
+	ok, err := s.repo.UseChallenge(challenge.ID)
+	if err != nil || !ok {
+		return 0, ErrInvalidMFAChallenge
+	}
+	return challenge.UserID, nil
+}
+
+// checkCode accepts a TOTP code or an unused recovery code.
+func (s *mfaService) checkCode(userID int, code string) error {
+	mfa, err := s.repo.FindByUserID(userID)
+	if err != nil || !mfa.Enabled {
+		return ErrMFANotEnabled
+	}
+
+	if step, ok := auth.ValidateTOTP(mfa.Secret, code, time.Now()); ok {
+		if used, err := s.repo.UseStep(userID, step); err != nil || !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(userID, auth.HashToken(normalizeRecoveryCode(code)))
+	if err != nil || !used {
+		return ErrInvalidMFACode
+	}
+	s.logActivity(userID, "MFA_RECOVERY_CODE_USED", "Signed in with a recovery code")
+	return nil
+}
+
+func (s *mfaService) newRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, mfaRecoveryCodeCount)
+	hashes := make([]string, mfaRecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = raw[:4] + "-" + raw[4:]
+		hashes[i] = auth.HashToken(raw)
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *mfaService) logActivity(userID int, action, details string) {
+	if user, err := s.userRepo.GetByID(userID); err == nil {
+		s.userRepo.LogActivity(user.Email, action, details)
+	}
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
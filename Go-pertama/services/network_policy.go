@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var ErrInvalidNetworkList = errors.New("invalid network list")
+
+// NetworkPolicyService enforces the CIDR allow and deny lists of roles and users.
+type NetworkPolicyService interface {
+	// Check returns auth.ErrNetworkDenied, and logs a SECURITY event, when the
+	// user may not act from ip. where names the login step or request path.
+	Check(userID int, ip, where string) error
+}
+
+type networkPolicyService struct {
+	userRepo repository.UserRepository
+}
+
+func NewNetworkPolicyService(userRepo repository.UserRepository) NetworkPolicyService {
+	return &networkPolicyService{userRepo: userRepo}
+}
+
+func (s *networkPolicyService) Check(userID int, ip, where string) error {
+	rules, err := s.userRepo.GetNetworkRules(userID)
+	if err != nil {
+		return errors.New("database connection error")
+	}
+	if rules.RoleAllowedNetworks == "" && rules.RoleDeniedNetworks == "" && rules.AllowedNetworks == "" && rules.DeniedNetworks == "" {
+		return nil
+	}
+
+	reason := networkDenial(rules, ip)
+	if reason == "" {
+		return nil
+	}
+	s.userRepo.LogActivity(rules.Email, "SECURITY", fmt.Sprintf("Access from %s denied (%s): %s", ip, where, reason))
+	return auth.ErrNetworkDenied
+}
+
+// networkDenial returns why ip is refused, or "" when it is allowed. A deny
+// list always wins, and every non-empty allow list must contain the address,
+// so a user's own lists can only narrow what the role permits.
+func networkDenial(rules *models.NetworkRules, ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "client address is unknown"
+	}
+
+	lists := []struct {
+		owner, allowed, denied string
+	}{
+		{fmt.Sprintf("role %s", rules.RoleName), rules.RoleAllowedNetworks, rules.RoleDeniedNetworks},
+		{"user", rules.AllowedNetworks, rules.DeniedNetworks},
+	}
+	for _, l := range lists {
+		denied, err := auth.ParseNetworks(l.denied)
+		if err != nil {
+			// Lists are validated when saved; fail closed if one was edited in the database
+			log.Printf("Invalid denied networks for %s of %s: %v", l.owner, rules.Email, err)
+			return fmt.Sprintf("%s has an invalid deny list", l.owner)
+		}
+		if auth.NetworksContain(denied, addr) {
+			return fmt.Sprintf("address is in the deny list of %s", l.owner)
+		}
+	}
+	for _, l := range lists {
+		allowed, err := auth.ParseNetworks(l.allowed)
+		if err != nil {
+			log.Printf("Invalid allowed networks for %s of %s: %v", l.owner, rules.Email, err)
+			return fmt.Sprintf("%s has an invalid allow list", l.owner)
+		}
+		if len(allowed) > 0 && !auth.NetworksContain(allowed, addr) {
+			return fmt.Sprintf("address is not in the allow list of %s", l.owner)
+		}
+	}
+	return ""
+}
+
+// validateNetworks checks a list before it is saved.
+func validateNetworks(field, list string) error {
+	if _, err := auth.ParseNetworks(list); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidNetworkList, field, err)
+	}
+	return nil
+}
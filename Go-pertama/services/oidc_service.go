@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/config"
+	"go-pertama/models"
+	"go-pertama/repository"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOIDCDisabled        = errors.New("single sign-on is not enabled")
+	ErrOIDCInvalidState    = errors.New("single sign-on request expired, please try again")
+	ErrOIDCEmailUnverified = errors.New("your identity provider did not confirm your email address")
+	ErrOIDCNoAccount       = errors.New("no account exists for this email, ask an administrator to create one")
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCService interface {
+	Status() models.OIDCStatus
+	Begin() (target, state string, err error)
+	Finish(ctx context.Context, state, code string) (*models.User, error)
+}
+
+type oidcService struct {
+	client   *auth.OIDCClient
+	repo     repository.OIDCRepository
+	userRepo repository.UserRepository
+	accounts externalAccounts
+	cfg      config.OIDCConfig
+	roleMap  []groupRole
+}
+
+func NewOIDCService(client *auth.OIDCClient, repo repository.OIDCRepository, userRepo repository.UserRepository, roleRepo repository.RoleRepository, passwords PasswordService, cfg config.OIDCConfig) OIDCService {
+	return &oidcService{
+		client:   client,
+		repo:     repo,
+		userRepo: userRepo,
+		accounts: externalAccounts{userRepo: userRepo, roleRepo: roleRepo, passwords: passwords, source: "OIDC"},
+		cfg:      cfg,
+		roleMap:  parseRoleMapping(cfg.RoleMapping, ","),
+	}
+}
+
+func (s *oidcService) Status() models.OIDCStatus {
+	if !s.cfg.Enabled {
+		return models.OIDCStatus{}
+	}
+	return models.OIDCStatus{Enabled: true, Provider: s.cfg.ProviderName}
+}
+
+// Begin stores a fresh state, nonce and PKCE verifier and returns the provider's
+// login URL. The caller must tie state to the browser, see Finish.
+func (s *oidcService) Begin() (string, string, error) {
+	if !s.cfg.Enabled {
+		return "", "", ErrOIDCDisabled
+	}
+
+	state, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.repo.CreateState(&models.OIDCLoginState{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	target, err := s.client.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+	return target, state, nil
+}
+
+// Finish validates the callback and returns the local user for the identity,
+// linking or creating one on first login and syncing the role from group claims.
+// The state must already be known to come from the browser that called Begin.
+func (s *oidcService) Finish(ctx context.Context, state, code string) (*models.User, error) {
+	if !s.cfg.Enabled {
+		return nil, ErrOIDCDisabled
+	}
+
+	stored, err := s.repo.TakeState(auth.HashToken(state))
+	if err != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrOIDCInvalidState
+	}
+
+	claims, err := s.client.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.resolveUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.accounts.syncRole(user, mappedRole(s.roleMap, claims.Groups)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *oidcService) resolveUser(claims *models.OIDCClaims) (*models.User, error) {
+	provider := s.cfg.ProviderName
+	identity, err := s.repo.FindIdentity(provider, claims.Subject)
+	if err == nil {
+		s.repo.TouchIdentity(identity.ID)
+		user, err := s.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			return nil, errors.New("database connection error")
+		}
+		return user, nil
+	}
+
+	// First login with this identity: match an account by email, which the provider must vouch for
+	if claims.Email == "" || !(claims.EmailVerified || s.cfg.TrustEmail) {
+		return nil, ErrOIDCEmailUnverified
+	}
+
+	user, err := s.userRepo.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		s.userRepo.LogActivity(user.Email, "OIDC_LINKED", fmt.Sprintf("Linked %s identity %s", provider, claims.Subject))
+	case errors.Is(err, sql.ErrNoRows):
+		if !s.cfg.AutoProvision {
+			return nil, ErrOIDCNoAccount
+		}
+		roleName := mappedRole(s.roleMap, claims.Groups)
+		if roleName == "" {
+			roleName = s.cfg.DefaultRole
+		}
+		if user, err = s.accounts.provision(claims.Email, claims.Name, roleName); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("database connection error")
+	}
+
+	now := time.Now()
+	err = s.repo.CreateIdentity(&models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/config"
+	"go-pertama/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	testOIDCClientID     = "go-pertama"
+	testOIDCClientSecret = "client-secret"
+	testOIDCRedirectURL  = "http://app.example.com/auth/oidc/callback"
+)
+
+// testIdentityProvider serves discovery, JWKS and a token endpoint that checks
+// PKCE, and signs ID tokens with a key generated for the test.
+type testIdentityProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testAuthorization
+}
+
+// testAuthorization is what the provider remembers between the browser's visit
+// and the code exchange.
+type testAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	p := &testIdentityProvider{t: t, key: key, codes: map[string]testAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize plays the browser's visit to the provider: it accepts the login URL
+// from Begin and returns the code the provider would redirect back with. The
+// ID token for that code carries claims; a "nonce" claim overrides the
+// requested one.
+func (p *testIdentityProvider) authorize(loginURL string, claims jwt.MapClaims) string {
+	p.t.Helper()
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		p.t.Fatalf("login URL: %v", err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != testOIDCClientID || q.Get("redirect_uri") != testOIDCRedirectURL || q.Get("response_type") != "code" {
+		p.t.Fatalf("unexpected login URL %s", loginURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Fatalf("login URL without a PKCE challenge: %s", loginURL)
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" {
+		p.t.Fatalf("login URL without state or nonce: %s", loginURL)
+	}
+
+	code, err := auth.NewOpaqueToken()
+	if err != nil {
+		p.t.Fatalf("code: %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = testAuthorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	return code
+}
+
+func (p *testIdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testOIDCClientID || secret != testOIDCClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	authz, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || base64.RawURLEncoding.EncodeToString(sum[:]) != authz.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   testOIDCClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authz.nonce,
+	}
+	for k, v := range authz.claims {
+		claims[k] = v
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = "test-key"
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+// fakeOIDCRepo keeps login states and linked identities in memory.
+type fakeOIDCRepo struct {
+	mu         sync.Mutex
+	states     map[string]*models.OIDCLoginState
+	identities []models.UserIdentity
+}
+
+func (r *fakeOIDCRepo) FindIdentity(provider, subject string) (*models.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOIDCRepo) CreateIdentity(identity *models.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *fakeOIDCRepo) TouchIdentity(id int64) error {
+	return nil
+}
+
+func (r *fakeOIDCRepo) CreateState(state *models.OIDCLoginState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.states == nil {
+		r.states = map[string]*models.OIDCLoginState{}
+	}
+	copy := *state
+	r.states[state.StateHash] = &copy
+	return nil
+}
+
+func (r *fakeOIDCRepo) TakeState(hash string) (*models.OIDCLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[hash]
+	if !ok || state.UsedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	now := time.Now()
+	state.UsedAt = &now
+	copy := *state
+	return &copy, nil
+}
+
+type oidcTestEnv struct {
+	provider *testIdentityProvider
+	repo     *fakeOIDCRepo
+	users    *fakeUserRepo
+	service  OIDCService
+}
+
+func newOIDCTestEnv(t *testing.T, configure func(*config.OIDCConfig)) *oidcTestEnv {
+	provider := newTestIdentityProvider(t)
+	cfg := config.OIDCConfig{
+		Enabled:       true,
+		ProviderName:  "test-idp",
+		IssuerURL:     provider.server.URL,
+		ClientID:      testOIDCClientID,
+		ClientSecret:  testOIDCClientSecret,
+		RedirectURL:   testOIDCRedirectURL,
+		Scopes:        "openid email profile",
+		GroupsClaim:   "groups",
+		RoleMapping:   "admins=admin,developers=editor",
+		DefaultRole:   "user",
+		AutoProvision: true,
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	env := &oidcTestEnv{provider: provider, repo: &fakeOIDCRepo{}, users: &fakeUserRepo{}}
+	env.service = NewOIDCService(auth.NewOIDCClient(cfg), env.repo, env.users, newFakeRoleRepo("admin", "editor", "user"), fakePasswords{}, cfg)
+	return env
+}
+
+// login runs Begin, the provider visit and Finish as the browser would.
+func (e *oidcTestEnv) login(t *testing.T, claims jwt.MapClaims) (*models.User, error) {
+	t.Helper()
+	loginURL, state, err := e.service.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if got := mustQuery(t, loginURL).Get("state"); got != state {
+		t.Fatalf("login URL state %q, Begin returned %q", got, state)
+	}
+	code := e.provider.authorize(loginURL, claims)
+	return e.service.Finish(context.Background(), state, code)
+}
+
+func mustQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("parse %q: %v", rawURL, err)
+	}
+	return u.Query()
+}
+
+func TestOIDCLoginWithPKCE(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	existing := env.users.add(models.User{Email: "dana@example.com", Name: "Dana", Role: "user", RoleID: 3, IsActive: true})
+
+	user, err := env.login(t, jwt.MapClaims{"sub": "subject-1", "email": "dana@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Fatalf("signed in as user %d, want %d", user.ID, existing.ID)
+	}
+
+	// Later logins go by the linked subject, even once the email has changed at the provider
+	user, err = env.login(t, jwt.MapClaims{"sub": "subject-1", "email": "dana.new@example.com", "email_verified": false})
+	if err != nil {
+		t.Fatalf("second Finish: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("second login as user %d, want %d", user.ID, existing.ID)
+	}
+	if len(env.repo.identities) != 1 {
+		t.Errorf("%d identities, want 1", len(env.repo.identities))
+	}
+}
+
+func TestOIDCLoginRejectsWrongCodeVerifier(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	loginURL, state, err := env.service.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code := env.provider.authorize(loginURL, jwt.MapClaims{"sub": "subject-1", "email": "dana@example.com", "email_verified": true})
+
+	env.repo.states[auth.HashToken(state)].CodeVerifier = "not-the-verifier-that-was-challenged"
+	if _, err := env.service.Finish(context.Background(), state, code); err == nil {
+		t.Fatal("code exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCLoginRejectsWrongNonce(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+
+	_, err := env.login(t, jwt.MapClaims{"sub": "subject-1", "email": "dana@example.com", "email_verified": true, "nonce": "some-other-login"})
+	if !errors.Is(err, auth.ErrOIDCNonceMismatch) {
+		t.Fatalf("err = %v, want ErrOIDCNonceMismatch", err)
+	}
+	if env.users.count() != 0 {
+		t.Errorf("%d users created", env.users.count())
+	}
+}
+
+func TestOIDCLoginRejectsExpiredOrReusedState(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	claims := jwt.MapClaims{"sub": "subject-1", "email": "dana@example.com", "email_verified": true}
+
+	loginURL, state, err := env.service.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code := env.provider.authorize(loginURL, claims)
+	if _, err := env.service.Finish(context.Background(), state, code); err != nil {
+		t.Fatalf("first Finish: %v", err)
+	}
+	code = env.provider.authorize(loginURL, claims)
+	if _, err := env.service.Finish(context.Background(), state, code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("reused state: err = %v, want ErrOIDCInvalidState", err)
+	}
+
+	loginURL, state, err = env.service.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	env.repo.states[auth.HashToken(state)].ExpiresAt = time.Now().Add(-time.Second)
+	code = env.provider.authorize(loginURL, claims)
+	if _, err := env.service.Finish(context.Background(), state, code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("expired state: err = %v, want ErrOIDCInvalidState", err)
+	}
+
+	if _, err := env.service.Finish(context.Background(), "never-issued", code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Errorf("unknown state: err = %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCLoginRequiresVerifiedEmail(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	existing := env.users.add(models.User{Email: "dana@example.com", Name: "Dana", Role: "user", RoleID: 3, IsActive: true})
+
+	for _, verified := range []interface{}{false, "false", nil} {
+		claims := jwt.MapClaims{"sub": "attacker", "email": "dana@example.com"}
+		if verified != nil {
+			claims["email_verified"] = verified
+		}
+		if _, err := env.login(t, claims); !errors.Is(err, ErrOIDCEmailUnverified) {
+			t.Errorf("email_verified=%v: err = %v, want ErrOIDCEmailUnverified", verified, err)
+		}
+	}
+	if len(env.repo.identities) != 0 || env.users.count() != 1 {
+		t.Errorf("unverified email linked or created accounts: %d identities, %d users", len(env.repo.identities), env.users.count())
+	}
+
+	// Providers that never send the claim can be trusted explicitly
+	trusting := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.TrustEmail = true })
+	trusting.users.add(*existing)
+	if _, err := trusting.login(t, jwt.MapClaims{"sub": "subject-1", "email": "dana@example.com"}); err != nil {
+		t.Errorf("OIDC_TRUST_EMAIL: %v", err)
+	}
+}
+
+func TestOIDCLoginLinksExistingUserByEmail(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+	existing := env.users.add(models.User{Email: "Dana@Example.com", Name: "Dana", Role: "user", RoleID: 3, IsActive: true})
+
+	user, err := env.login(t, jwt.MapClaims{"sub": "subject-1", "email": "dana@example.com", "email_verified": true, "name": "Dana D."})
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if user.ID != existing.ID || env.users.count() != 1 {
+		t.Fatalf("signed in as user %d with %d users, want existing user %d", user.ID, env.users.count(), existing.ID)
+	}
+
+	if len(env.repo.identities) != 1 {
+		t.Fatalf("%d identities, want 1", len(env.repo.identities))
+	}
+	identity := env.repo.identities[0]
+	if identity.UserID != existing.ID || identity.Provider != "test-idp" || identity.Subject != "subject-1" {
+		t.Errorf("identity = %+v", identity)
+	}
+	if !env.users.logged("OIDC_LINKED Dana@Example.com") {
+		t.Error("link not logged")
+	}
+}
+
+func TestOIDCLoginProvisionsNewUser(t *testing.T) {
+	env := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.RoleMapping = "" })
+
+	user, err := env.login(t, jwt.MapClaims{"sub": "subject-2", "email": "erin@example.com", "email_verified": "true", "name": "Erin"})
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	stored, err := env.users.GetByEmail("erin@example.com")
+	if err != nil {
+		t.Fatalf("no Users row created: %v", err)
+	}
+	if stored.ID != user.ID || stored.Name != "Erin" || stored.Role != "user" || !stored.IsActive || stored.CreatedBy != "OIDC" {
+		t.Errorf("created row = %+v", stored)
+	}
+	if len(env.repo.identities) != 1 || env.repo.identities[0].UserID != user.ID {
+		t.Errorf("identities = %+v", env.repo.identities)
+	}
+	if !env.users.logged("OIDC_PROVISIONED erin@example.com") {
+		t.Error("provisioning not logged")
+	}
+
+	closed := newOIDCTestEnv(t, func(cfg *config.OIDCConfig) { cfg.AutoProvision = false })
+	if _, err := closed.login(t, jwt.MapClaims{"sub": "subject-2", "email": "erin@example.com", "email_verified": true}); !errors.Is(err, ErrOIDCNoAccount) {
+		t.Errorf("without auto-provisioning: err = %v, want ErrOIDCNoAccount", err)
+	}
+	if closed.users.count() != 0 {
+		t.Errorf("%d users created without auto-provisioning", closed.users.count())
+	}
+}
+
+func TestOIDCLoginMapsGroupsToRoles(t *testing.T) {
+	env := newOIDCTestEnv(t, nil)
+
+	// The first mapping entry the user matches wins, whatever the claim order
+	user, err := env.login(t, jwt.MapClaims{"sub": "subject-3", "email": "frank@example.com", "email_verified": true, "groups": []string{"developers", "admins"}})
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if user.Role != "admin" || user.RoleID != 1 {
+		t.Errorf("provisioned role = %s (%d), want admin", user.Role, user.RoleID)
+	}
+
+	// Synced on every login; a single group may come as a plain string
+	user, err = env.login(t, jwt.MapClaims{"sub": "subject-3", "groups": "developers"})
+	if err != nil {
+		t.Fatalf("second Finish: %v", err)
+	}
+	if stored, _ := env.users.GetByID(user.ID); stored.Role != "editor" || stored.UpdatedBy != "OIDC" {
+		t.Errorf("synced role = %s updated by %q, want editor by OIDC", stored.Role, stored.UpdatedBy)
+	}
+
+	// Without a mapped group the current role is kept
+	if _, err := env.login(t, jwt.MapClaims{"sub": "subject-3", "groups": []string{"sales"}}); err != nil {
+		t.Fatalf("third Finish: %v", err)
+	}
+	if stored, _ := env.users.GetByID(user.ID); stored.Role != "editor" {
+		t.Errorf("unmapped groups changed the role to %s", stored.Role)
+	}
+}
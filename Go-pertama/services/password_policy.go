@@ -0,0 +1,278 @@
+package services
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go-pertama/auth"
+	"go-pertama/config"
+	"go-pertama/models"
+	"go-pertama/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordViolation describes one password policy rule that was not met.
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a rejected password failed.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// maxPasswordBytes is the longest password bcrypt can hash. Longer ones are
+// rejected by the policy rather than failing when they are stored.
+const maxPasswordBytes = 72
+
+// PasswordPolicy holds the rules configured in system_configs.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistoryCount  int
+	MaxAge        time.Duration
+	CheckBreached bool
+}
+
+// loadPasswordPolicy reads the policy from system_configs on every call so edits apply immediately.
+func loadPasswordPolicy(configs ConfigService) PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     configs.GetInt("password_min_length", 8),
+		RequireUpper:  configs.GetBool("password_require_uppercase", true),
+		RequireLower:  configs.GetBool("password_require_lowercase", true),
+		RequireDigit:  configs.GetBool("password_require_digit", true),
+		RequireSymbol: configs.GetBool("password_require_symbol", false),
+		HistoryCount:  configs.GetInt("password_history_count", 5),
+		MaxAge:        time.Duration(configs.GetInt("password_max_age_days", 0)) * 24 * time.Hour,
+		CheckBreached: configs.GetBool("password_check_breached", true),
+	}
+}
+
+// Check applies the rules that only need the password itself.
+func (p PasswordPolicy) Check(email, password string) []PasswordViolation {
+	var violations []PasswordViolation
+	add := func(rule, message string) {
+		violations = append(violations, PasswordViolation{Rule: rule, Message: message})
+	}
+
+	if password == "" {
+		add("required", "Password is required")
+		return violations
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case unicode.IsPunct(c) || unicode.IsSymbol(c):
+			hasSymbol = true
+		}
+	}
+
+	if p.MinLength > 0 && len([]rune(password)) < p.MinLength {
+		add("min_length", "Password must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if len(password) > maxPasswordBytes {
+		add("max_length", "Password must be at most "+strconv.Itoa(maxPasswordBytes)+" bytes long")
+	}
+	if p.RequireUpper && !hasUpper {
+		add("uppercase", "Password must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add("lowercase", "Password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add("digit", "Password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add("symbol", "Password must contain a symbol")
+	}
+	if email != "" && strings.EqualFold(password, email) {
+		add("not_email", "Password must not be the same as the email address")
+	}
+	if p.CheckBreached && auth.IsBreachedPassword(password) {
+		add("breached", "Password is too common and appears in known data breaches")
+	}
+	return violations
+}
+
+// Expired reports whether a password last changed at changedAt is past MaxAge.
+func (p PasswordPolicy) Expired(changedAt *time.Time) bool {
+	if p.MaxAge <= 0 || changedAt == nil {
+		return false
+	}
+	return time.Since(*changedAt) > p.MaxAge
+}
+
+// PasswordService is the single place passwords are verified, validated and stored.
+type PasswordService interface {
+	Verify(user *models.User, password string) bool
+	Hash(password string) (string, error)
+	Validate(userID int, email, password string) error
+	Save(userID int, password string) error
+	Remember(userID int, hashedPassword string) error
+	Expired(user *models.User) bool
+}
+
+type passwordService struct {
+	userRepo       repository.UserRepository
+	historyRepo    repository.PasswordHistoryRepository
+	configs        ConfigService
+	cost           int
+	allowPlaintext bool
+}
+
+func NewPasswordService(userRepo repository.UserRepository, historyRepo repository.PasswordHistoryRepository, configs ConfigService, cfg config.AuthConfig) PasswordService {
+	cost := cfg.BcryptCost
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &passwordService{
+		userRepo:       userRepo,
+		historyRepo:    historyRepo,
+		configs:        configs,
+		cost:           cost,
+		allowPlaintext: cfg.AllowPlaintextPasswords,
+	}
+}
+
+// Verify checks a login password. Legacy clear-text values only match while
+// AUTH_ALLOW_PLAINTEXT_PASSWORDS is on and the user's rehash deadline has not
+// passed. Matching clear-text or weaker bcrypt hashes are upgraded in place.
+func (s *passwordService) Verify(user *models.User, password string) bool {
+	cost, err := bcrypt.Cost([]byte(user.Password))
+	if err != nil {
+		if !s.plaintextAllowed(user) || subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+			return false
+		}
+		s.rehash(user, password, "Legacy plain-text password rehashed")
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return false
+	}
+	if cost < s.cost {
+		s.rehash(user, password, fmt.Sprintf("Password rehashed from bcrypt cost %d to %d", cost, s.cost))
+	}
+	return true
+}
+
+func (s *passwordService) plaintextAllowed(user *models.User) bool {
+	if !s.allowPlaintext {
+		return false
+	}
+	return user.PlaintextRehashBefore == nil || time.Now().Before(*user.PlaintextRehashBefore)
+}
+
+func (s *passwordService) rehash(user *models.User, password, details string) {
+	hashed, err := s.Hash(password)
+	if err != nil {
+		return
+	}
+	if s.userRepo.UpdatePassword(user.ID, hashed) == nil {
+		user.Password = hashed
+		s.userRepo.LogActivity(user.Email, "PASSWORD_REHASH", details)
+	}
+}
+
+// Hash returns a bcrypt hash at the configured cost.
+func (s *passwordService) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), s.cost)
+	return string(hashed), err
+}
+
+// Validate checks the password against the policy. userID is 0 for users that
+// do not exist yet, which skips the reuse check.
+func (s *passwordService) Validate(userID int, email, password string) error {
+	policy := loadPasswordPolicy(s.configs)
+	violations := policy.Check(email, password)
+
+	if userID != 0 && password != "" && policy.HistoryCount > 0 && s.reused(userID, password, policy.HistoryCount) {
+		violations = append(violations, PasswordViolation{
+			Rule:    "history",
+			Message: "Password must not match any of the last " + strconv.Itoa(policy.HistoryCount) + " passwords",
+		})
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (s *passwordService) reused(userID int, password string, count int) bool {
+	// The current password counts even if it predates the history table
+	if user, err := s.userRepo.GetByID(userID); err == nil {
+		// Compared directly so a clear-text value still counts as reuse
+		if user.Password == password || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil {
+			return true
+		}
+	}
+
+	entries, err := s.historyRepo.Recent(userID, count)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if bcrypt.CompareHashAndPassword([]byte(entry.PasswordHash), []byte(password)) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Save hashes and stores a new password that has already passed Validate.
+// It also clears any pending forced change.
+func (s *passwordService) Save(userID int, password string) error {
+	hashed, err := s.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.ChangePassword(userID, hashed); err != nil {
+		return err
+	}
+	return s.Remember(userID, hashed)
+}
+
+// Remember adds a hash to the user's password history and trims old entries.
+func (s *passwordService) Remember(userID int, hashedPassword string) error {
+	err := s.historyRepo.Add(&models.PasswordHistory{
+		UserID:       userID,
+		PasswordHash: hashedPassword,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if keep := loadPasswordPolicy(s.configs).HistoryCount; keep > 0 {
+		return s.historyRepo.Prune(userID, keep)
+	}
+	return nil
+}
+
+func (s *passwordService) Expired(user *models.User) bool {
+	return loadPasswordPolicy(s.configs).Expired(user.PasswordChangedAt)
+}
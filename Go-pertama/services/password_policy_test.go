@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheckMaxLength(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8}
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"72 bytes", strings.Repeat("a", 72), false},
+		{"73 bytes", strings.Repeat("a", 73), true},
+		{"multibyte characters over 72 bytes", strings.Repeat("é", 37), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := false
+			for _, v := range policy.Check("", tt.password) {
+				if v.Rule == "max_length" {
+					got = true
+				}
+			}
+			if got != tt.want {
+				t.Errorf("max_length violation = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
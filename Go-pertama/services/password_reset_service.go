@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/mailer"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrResetRateLimited  = errors.New("too many password reset requests, please try again later")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+type PasswordResetService interface {
+	RequestReset(email string, client models.ClientInfo) error
+	ResetPassword(req models.ResetPasswordRequest, client models.ClientInfo) error
+}
+
+type passwordResetService struct {
+	userRepo  repository.UserRepository
+	resetRepo repository.PasswordResetRepository
+	sessions  SessionService
+	configs   ConfigService
+	passwords PasswordService
+	mailer    mailer.Mailer
+	publicURL string
+}
+
+func NewPasswordResetService(userRepo repository.UserRepository, resetRepo repository.PasswordResetRepository, sessions SessionService, configs ConfigService, passwords PasswordService, m mailer.Mailer, publicURL string) PasswordResetService {
+	return &passwordResetService{
+		userRepo:  userRepo,
+		resetRepo: resetRepo,
+		sessions:  sessions,
+		configs:   configs,
+		passwords: passwords,
+		mailer:    m,
+		publicURL: strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// RequestReset emails a reset link if the address belongs to an active user.
+// The result is the same whether or not the email exists, so callers cannot probe for accounts.
+func (s *passwordResetService) RequestReset(email string, client models.ClientInfo) error {
+	email = strings.TrimSpace(email)
+	since := time.Now().Add(-time.Hour)
+
+	if n, err := s.resetRepo.CountByIPSince(client.IPAddress, since); err != nil {
+		return errors.New("database connection error")
+	} else if n >= int64(s.configs.GetInt("password_reset_max_per_ip_hour", 10)) {
+		return ErrResetRateLimited
+	}
+	if n, err := s.resetRepo.CountByEmailSince(email, since); err != nil {
+		return errors.New("database connection error")
+	} else if n >= int64(s.configs.GetInt("password_reset_max_per_email_hour", 3)) {
+		return ErrResetRateLimited
+	}
+
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	record := &models.PasswordResetToken{
+		Email:     email,
+		TokenHash: auth.HashToken(token),
+		IPAddress: client.IPAddress,
+		ExpiresAt: time.Now().Add(time.Duration(s.configs.GetInt("password_reset_token_minutes", 30)) * time.Minute),
+		CreatedAt: time.Now(),
+	}
+
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil || !user.IsActive {
+		// Record the attempt without a user; the token is never sent anywhere
+		if err := s.resetRepo.Create(record); err != nil {
+			return errors.New("database connection error")
+		}
+		return nil
+	}
+
+	record.UserID = user.ID
+	if err := s.resetRepo.Create(record); err != nil {
+		return errors.New("database connection error")
+	}
+
+	// Sent in the background: unknown emails return without sending, and the
+	// SMTP round trip would otherwise tell which emails are registered
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.publicURL, url.QueryEscape(token))
+	mailer.SendInBackground(s.mailer, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires at %s and can be used once. If you did not request this, you can ignore this email.\n",
+			user.Name, link, record.ExpiresAt.Format("2006-01-02 15:04 MST")),
+	})
+
+	s.userRepo.LogActivity(user.Email, "PASSWORD_RESET_REQUEST", "Password reset requested from "+client.IPAddress)
+	return nil
+}
+
+// ResetPassword consumes the token, sets the new password and signs the user out everywhere.
+func (s *passwordResetService) ResetPassword(req models.ResetPasswordRequest, client models.ClientInfo) error {
+	stored, err := s.resetRepo.FindByHash(auth.HashToken(req.Token))
+	if err != nil || stored.UserID == 0 || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByID(stored.UserID)
+	if err != nil || !user.IsActive {
+		return ErrInvalidResetToken
+	}
+
+	// Validate before consuming the token so the user can retry with a better password
+	if err := s.passwords.Validate(user.ID, user.Email, req.NewPassword); err != nil {
+		return err
+	}
+
+	ok, err := s.resetRepo.MarkUsed(stored.ID)
+	if err != nil {
+		return errors.New("database connection error")
+	}
+	if !ok {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.passwords.Save(user.ID, req.NewPassword); err != nil {
+		return err
+	}
+
+	// Proving ownership of the mailbox also clears any lockout
+	s.userRepo.UpdateLockout(user.ID, 0, nil)
+	s.resetRepo.InvalidateForUser(user.ID)
+	s.sessions.RevokeAllForUser(user.ID)
+
+	s.userRepo.LogActivity(user.Email, "PASSWORD_RESET", "Password reset via emailed link from "+client.IPAddress+", all sessions revoked")
+	return nil
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/mailer"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var (
+	ErrRegistrationDisabled     = errors.New("registration is disabled")
+	ErrEmailDomainNotAllowed    = errors.New("registration is not open to this email domain")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+	ErrRegistrationNotPending   = errors.New("registration is not awaiting approval")
+)
+
+// registrationCreatedBy is recorded as CreatedBy on self-registered users.
+const registrationCreatedBy = "self-registration"
+
+type RegistrationService interface {
+	Settings() models.RegistrationSettings
+	Register(req models.RegisterRequest, client models.ClientInfo) error
+	VerifyEmail(token string, client models.ClientInfo) (string, error)
+	GetRegistrations(status string, page, limit int) (*models.UsersResponse, error)
+	Approve(id int, actor *auth.Principal) error
+	Reject(id int, reason string, actor *auth.Principal) error
+}
+
+type registrationService struct {
+	userRepo  repository.UserRepository
+	roleRepo  repository.RoleRepository
+	tokenRepo repository.EmailVerificationRepository
+	configs   ConfigService
+	passwords PasswordService
+	captcha   CaptchaVerifier
+	mailer    mailer.Mailer
+	publicURL string
+}
+
+func NewRegistrationService(userRepo repository.UserRepository, roleRepo repository.RoleRepository, tokenRepo repository.EmailVerificationRepository, configs ConfigService, passwords PasswordService, captcha CaptchaVerifier, m mailer.Mailer, publicURL string) RegistrationService {
+	return &registrationService{
+		userRepo:  userRepo,
+		roleRepo:  roleRepo,
+		tokenRepo: tokenRepo,
+		configs:   configs,
+		passwords: passwords,
+		captcha:   captcha,
+		mailer:    m,
+		publicURL: strings.TrimRight(publicURL, "/"),
+	}
+}
+
+func (s *registrationService) Settings() models.RegistrationSettings {
+	settings := models.RegistrationSettings{
+		Enabled:          s.configs.GetBool("registration_enabled", false),
+		RequiresApproval: s.configs.GetBool("registration_requires_approval", true),
+		AllowedDomains:   s.allowedDomains(),
+	}
+	if settings.Enabled {
+		settings.CaptchaSiteKey = s.captcha.SiteKey()
+	}
+	return settings
+}
+
+// allowedDomains reads registration_allowed_domains, a comma separated list
+// of domains such as "example.com" or "*.example.com". Empty allows any domain.
+func (s *registrationService) allowedDomains() []string {
+	domains := []string{}
+	for _, d := range strings.Split(s.configs.GetString("registration_allowed_domains", ""), ",") {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+func (s *registrationService) domainAllowed(email string) bool {
+	domains := s.allowedDomains()
+	if len(domains) == 0 {
+		return true
+	}
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	for _, d := range domains {
+		if domain == d {
+			return true
+		}
+		if wildcard, ok := strings.CutPrefix(d, "*."); ok && strings.HasSuffix(domain, "."+wildcard) {
+			return true
+		}
+	}
+	return false
+}
+
+// Register creates an inactive user and emails a verification link. When the
+// email is already taken the answer is the same, so callers cannot probe for
+// accounts: an unverified registration gets a fresh link, anyone else a note
+// that they already have an account.
+func (s *registrationService) Register(req models.RegisterRequest, client models.ClientInfo) error {
+	if !s.configs.GetBool("registration_enabled", false) {
+		return ErrRegistrationDisabled
+	}
+	if err := s.captcha.Verify(req.CaptchaToken, client.IPAddress); err != nil {
+		return err
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return errors.New("invalid email address")
+	}
+	if !s.domainAllowed(email) {
+		return ErrEmailDomainNotAllowed
+	}
+	if err := s.passwords.Validate(0, email, req.Password); err != nil {
+		return err
+	}
+	// Hashed even when the email is taken, so the response time does not tell
+	hashedPassword, err := s.passwords.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.userRepo.GetByEmail(email)
+	if err == nil {
+		return s.registerExisting(existing, hashedPassword, client)
+	}
+	if err != sql.ErrNoRows {
+		return errors.New("database connection error")
+	}
+
+	roleName := s.configs.GetString("registration_default_role", "user")
+	role, err := s.roleRepo.FindByName(roleName)
+	if err != nil || !role.IsActive {
+		log.Printf("Registration role %q is missing or inactive", roleName)
+		return fmt.Errorf("registration role %q is not available", roleName)
+	}
+
+	// The account gets no usable password until the email is verified, see VerifyEmail
+	placeholder, err := unusablePassword(s.passwords)
+	if err != nil {
+		return err
+	}
+	user := &models.User{
+		Email:              email,
+		Password:           placeholder,
+		Name:               strings.TrimSpace(req.Name),
+		Role:               role.Name,
+		RoleID:             role.ID,
+		RegistrationStatus: models.RegistrationUnverified,
+		CreatedBy:          registrationCreatedBy,
+	}
+	user.ID, err = s.userRepo.CreateRegistration(user)
+	if err != nil {
+		// Lost a race with another registration for the same email
+		if _, lookupErr := s.userRepo.GetByEmail(email); lookupErr == nil {
+			return nil
+		}
+		return errors.New("database connection error")
+	}
+
+	if err := s.sendVerification(user, hashedPassword); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(email, "REGISTER", "Self-registered from "+client.IPAddress)
+	return nil
+}
+
+// registerExisting answers a sign-up for an email that is already taken. An
+// unverified registration gets a new link carrying the new password; earlier
+// links stop working, so only the mailbox owner decides which password wins.
+func (s *registrationService) registerExisting(user *models.User, hashedPassword string, client models.ClientInfo) error {
+	if user.RegistrationStatus != models.RegistrationUnverified {
+		mailer.SendInBackground(s.mailer, mailer.Message{
+			To:      user.Email,
+			Subject: "You already have an account",
+			Body: fmt.Sprintf("Hello %s,\n\nSomeone tried to sign up with this email address, but you already have an account. "+
+				"You can sign in at %s, or use \"Forgot password\" there if you no longer know your password.\n\n"+
+				"If this was not you, you can ignore this email.\n", user.Name, s.publicURL),
+		})
+		return nil
+	}
+
+	s.tokenRepo.InvalidateForUser(user.ID)
+	if err := s.sendVerification(user, hashedPassword); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(user.Email, "REGISTER", "Registration repeated from "+client.IPAddress+", verification link sent again")
+	return nil
+}
+
+// sendVerification emails a new link that sets hashedPassword when it is used.
+// The email goes out in the background, like the "already have an account"
+// notice, so the response time does not tell whether the email was taken.
+func (s *registrationService) sendVerification(user *models.User, hashedPassword string) error {
+	token, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	record := &models.EmailVerificationToken{
+		UserID:       user.ID,
+		TokenHash:    auth.HashToken(token),
+		PasswordHash: hashedPassword,
+		ExpiresAt:    time.Now().Add(time.Duration(s.configs.GetInt("registration_token_hours", 24)) * time.Hour),
+		CreatedAt:    time.Now(),
+	}
+	if err := s.tokenRepo.Create(record); err != nil {
+		return errors.New("database connection error")
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.publicURL, url.QueryEscape(token))
+	mailer.SendInBackground(s.mailer, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nThanks for signing up. Open the link below to confirm your email address:\n\n%s\n\n"+
+			"The link expires at %s and can be used once. If you did not sign up, you can ignore this email.\n",
+			user.Name, link, record.ExpiresAt.Format("2006-01-02 15:04 MST")),
+	})
+	return nil
+}
+
+// VerifyEmail consumes the token and either activates the user or queues it
+// for approval, depending on registration_requires_approval. It returns the
+// new registration status, which is empty once the user is active.
+func (s *registrationService) VerifyEmail(token string, client models.ClientInfo) (string, error) {
+	stored, err := s.tokenRepo.FindByHash(auth.HashToken(token))
+	if err != nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return "", ErrInvalidVerificationToken
+	}
+
+	user, err := s.userRepo.GetByID(stored.UserID)
+	if err != nil || user.RegistrationStatus != models.RegistrationUnverified {
+		return "", ErrInvalidVerificationToken
+	}
+
+	ok, err := s.tokenRepo.MarkUsed(stored.ID)
+	if err != nil {
+		return "", errors.New("database connection error")
+	}
+	if !ok || stored.PasswordHash == "" {
+		return "", ErrInvalidVerificationToken
+	}
+
+	// The password chosen with this link becomes live only now, set by whoever controls the mailbox
+	if err := s.userRepo.ChangePassword(user.ID, stored.PasswordHash); err != nil {
+		return "", errors.New("database connection error")
+	}
+	s.passwords.Remember(user.ID, stored.PasswordHash)
+
+	next, activate := "", true
+	if s.configs.GetBool("registration_requires_approval", true) {
+		next, activate = models.RegistrationPendingApproval, false
+	}
+	if err := s.userRepo.UpdateRegistrationStatus(user.ID, models.RegistrationUnverified, next, activate, registrationCreatedBy); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrInvalidVerificationToken
+		}
+		return "", errors.New("database connection error")
+	}
+
+	details := "Email verified from " + client.IPAddress
+	if activate {
+		details += ", account activated"
+	} else {
+		details += ", awaiting approval"
+	}
+	s.userRepo.LogActivity(user.Email, "VERIFY_EMAIL", details)
+	return next, nil
+}
+
+func (s *registrationService) GetRegistrations(status string, page, limit int) (*models.UsersResponse, error) {
+	if status != "" && status != models.RegistrationUnverified && status != models.RegistrationPendingApproval {
+		return nil, fmt.Errorf("unknown registration status %q", status)
+	}
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 5
+	}
+
+	users, total, err := s.userRepo.GetRegistrations(status, page, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.UsersResponse{Data: users, Total: total, Page: page, Limit: limit}, nil
+}
+
+func (s *registrationService) Approve(id int, actor *auth.Principal) error {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.RegistrationStatus != models.RegistrationPendingApproval {
+		return ErrRegistrationNotPending
+	}
+
+	err = s.userRepo.UpdateRegistrationStatus(id, models.RegistrationPendingApproval, "", true, actor.Name)
+	if err == sql.ErrNoRows {
+		return ErrRegistrationNotPending
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been approved",
+		Body:    fmt.Sprintf("Hello %s,\n\nYour account has been approved. You can now sign in at %s.\n", user.Name, s.publicURL),
+	})
+	if err != nil {
+		log.Printf("Failed to send approval email to %s: %v", user.Email, err)
+	}
+
+	s.userRepo.LogActivity(actor.Email, "REGISTRATION_APPROVED", fmt.Sprintf("Approved registration of %s (user ID %d)", user.Email, id))
+	return nil
+}
+
+// Reject deletes a registration that is still unverified or awaiting
+// approval. Only users who proved their email are told about it.
+func (s *registrationService) Reject(id int, reason string, actor *auth.Principal) error {
+	user, err := s.userRepo.GetByID(id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.RegistrationStatus == "" {
+		return ErrRegistrationNotPending
+	}
+
+	if err := s.userRepo.Delete(id, actor.Name); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return err
+	}
+	s.tokenRepo.InvalidateForUser(id)
+
+	if user.RegistrationStatus == models.RegistrationPendingApproval {
+		body := fmt.Sprintf("Hello %s,\n\nYour request for an account was not approved.\n", user.Name)
+		if reason = strings.TrimSpace(reason); reason != "" {
+			body += "\nReason: " + reason + "\n"
+		}
+		if err := s.mailer.Send(mailer.Message{To: user.Email, Subject: "Your account request", Body: body}); err != nil {
+			log.Printf("Failed to send rejection email to %s: %v", user.Email, err)
+		}
+	}
+
+	details := fmt.Sprintf("Rejected registration of %s (user ID %d)", user.Email, id)
+	if reason != "" {
+		details += ": " + reason
+	}
+	s.userRepo.LogActivity(actor.Email, "REGISTRATION_REJECTED", details)
+	return nil
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"fmt"
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/repository"
 	"time"
@@ -9,9 +11,13 @@ import (
 type RoleService interface {
 	GetAllRoles(page, limit int, search string) (*models.RolesResponse, error)
 	GetRoleByID(id int) (*models.Role, error)
-	CreateRole(role *models.Role, createdBy string) error
-	UpdateRole(role *models.Role, updatedBy string) error
+	CreateRole(role *models.Role, actor *auth.Principal) error
+	UpdateRole(role *models.Role, actor *auth.Principal) error
 	DeleteRole(id int) error
+	GetAllPermissions() ([]models.Permission, error)
+	GetRolePermissions(roleID int) ([]models.Permission, error)
+	SetRolePermissions(roleID int, codes []string, actor *auth.Principal) ([]models.Permission, error)
+	GetPermissionsByEmail(email string) ([]string, error)
 }
 
 type roleService struct {
@@ -47,29 +53,106 @@ func (s *roleService) GetRoleByID(id int) (*models.Role, error) {
 	return s.repo.FindByID(id)
 }
 
-func (s *roleService) CreateRole(role *models.Role, createdBy string) error {
-	role.CreatedBy = createdBy
-	role.UpdatedBy = createdBy
+func (s *roleService) CreateRole(role *models.Role, actor *auth.Principal) error {
+	if err := validateRoleNetworks(role); err != nil {
+		return err
+	}
+	role.CreatedBy = actor.Email
+	role.UpdatedBy = actor.Email
 	role.CreatedAt = time.Now()
 	role.UpdatedAt = time.Now()
 	return s.repo.Create(role)
 }
 
-func (s *roleService) UpdateRole(role *models.Role, updatedBy string) error {
+func (s *roleService) UpdateRole(role *models.Role, actor *auth.Principal) error {
 	existingRole, err := s.repo.FindByID(role.ID)
 	if err != nil {
 		return err
 	}
+	if err := validateRoleNetworks(role); err != nil {
+		return err
+	}
 
 	existingRole.Name = role.Name
 	existingRole.Description = role.Description
 	existingRole.IsActive = role.IsActive
-	existingRole.UpdatedBy = updatedBy
+	existingRole.AllowedNetworks = role.AllowedNetworks
+	existingRole.DeniedNetworks = role.DeniedNetworks
+	existingRole.UpdatedBy = actor.Email
 	existingRole.UpdatedAt = time.Now()
 
 	return s.repo.Update(existingRole)
 }
 
+func validateRoleNetworks(role *models.Role) error {
+	if err := validateNetworks("allowed networks", role.AllowedNetworks); err != nil {
+		return err
+	}
+	return validateNetworks("denied networks", role.DeniedNetworks)
+}
+
 func (s *roleService) DeleteRole(id int) error {
 	return s.repo.Delete(id)
 }
+
+func (s *roleService) GetAllPermissions() ([]models.Permission, error) {
+	return s.repo.FindAllPermissions()
+}
+
+func (s *roleService) GetRolePermissions(roleID int) ([]models.Permission, error) {
+	if _, err := s.repo.FindByID(roleID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetPermissions(roleID)
+}
+
+// SetRolePermissions replaces the role's permission set. Unknown codes are rejected.
+func (s *roleService) SetRolePermissions(roleID int, codes []string, actor *auth.Principal) ([]models.Permission, error) {
+	role, err := s.repo.FindByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.repo.FindPermissionsByCodes(codes)
+	if err != nil {
+		return nil, err
+	}
+	if len(permissions) != len(uniqueStrings(codes)) {
+		known := make(map[string]bool, len(permissions))
+		for _, p := range permissions {
+			known[p.Code] = true
+		}
+		for _, code := range codes {
+			if !known[code] {
+				return nil, fmt.Errorf("unknown permission: %s", code)
+			}
+		}
+	}
+
+	role.UpdatedBy = actor.Email
+	role.UpdatedAt = time.Now()
+	if err := s.repo.Update(role); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ReplacePermissions(role, permissions); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (s *roleService) GetPermissionsByEmail(email string) ([]string, error) {
+	return s.repo.GetPermissionCodesByEmail(email)
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var out []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
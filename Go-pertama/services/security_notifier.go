@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-pertama/mailer"
+	"go-pertama/models"
+)
+
+// SecurityNotifier is told about every flagged login. Notifiers run in the
+// background; an error is only logged.
+type SecurityNotifier interface {
+	NotifySuspiciousLogin(user *models.User, event *models.SecurityEvent) error
+}
+
+// MailSecurityNotifier emails the user so they can react if it was not them.
+type MailSecurityNotifier struct {
+	mailer    mailer.Mailer
+	publicURL string
+}
+
+func NewMailSecurityNotifier(m mailer.Mailer, publicURL string) *MailSecurityNotifier {
+	return &MailSecurityNotifier{mailer: m, publicURL: publicURL}
+}
+
+func (n *MailSecurityNotifier) NotifySuspiciousLogin(user *models.User, event *models.SecurityEvent) error {
+	return n.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf("Hello %s,\n\nYour account was signed in to at %s:\n\n%s\n\nAddress: %s\nDevice: %s\n\n"+
+			"If this was you, you can ignore this email or acknowledge the alert under Security at %s. "+
+			"If it was not, change your password now and sign out of your other sessions.\n",
+			user.Name, event.CreatedAt.Format("2006-01-02 15:04 MST"), event.Details, event.IPAddress, event.UserAgent, n.publicURL),
+	})
+}
+
+// WebhookSecurityNotifier POSTs each event as JSON, e.g. to a SIEM or chat
+// integration. With a secret, X-Signature carries "sha256=" and the hex
+// HMAC-SHA256 of the body.
+type WebhookSecurityNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookSecurityNotifier(url, secret string) *WebhookSecurityNotifier {
+	return &WebhookSecurityNotifier{url: url, secret: secret, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookSecurityNotifier) NotifySuspiciousLogin(user *models.User, event *models.SecurityEvent) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"type":  "suspicious_login",
+		"event": event,
+		"user":  map[string]interface{}{"id": user.ID, "email": user.Email, "name": user.Name},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SecurityNotifiers sends to every notifier and reports all failures.
+type SecurityNotifiers []SecurityNotifier
+
+func (ns SecurityNotifiers) NotifySuspiciousLogin(user *models.User, event *models.SecurityEvent) error {
+	var failed []string
+	for _, n := range ns {
+		if err := n.NotifySuspiciousLogin(user, event); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("notification failed: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
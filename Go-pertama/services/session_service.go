@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/repository"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService interface {
+	Start(user *models.User, client models.ClientInfo, expiresAt time.Time) (*models.Session, error)
+	Extend(sessionID string, expiresAt time.Time) error
+	IsActive(sessionID string) bool
+	ListActive() ([]models.SessionInfo, error)
+	ListForUser(email, currentSessionID string) ([]models.SessionInfo, error)
+	Revoke(sessionID string) error
+	RevokeAllForUser(userID int) error
+	RevokeOwn(email, sessionID string) error
+	Kick(req models.KickRequest, actor *auth.Principal) error
+}
+
+type sessionService struct {
+	repo        repository.SessionRepository
+	refreshRepo repository.RefreshTokenRepository
+	userRepo    repository.UserRepository
+}
+
+func NewSessionService(repo repository.SessionRepository, refreshRepo repository.RefreshTokenRepository, userRepo repository.UserRepository) SessionService {
+	return &sessionService{repo: repo, refreshRepo: refreshRepo, userRepo: userRepo}
+}
+
+func (s *sessionService) Start(user *models.User, client models.ClientInfo, expiresAt time.Time) (*models.Session, error) {
+	id, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:         id,
+		UserID:     user.ID,
+		IPAddress:  client.IPAddress,
+		UserAgent:  truncate(client.UserAgent, 255),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.repo.Create(session); err != nil {
+		return nil, err
+	}
+
+	s.userRepo.UpdateLoginStatus(user.Email, true)
+	return session, nil
+}
+
+func (s *sessionService) Extend(sessionID string, expiresAt time.Time) error {
+	return s.repo.Extend(sessionID, expiresAt)
+}
+
+func (s *sessionService) IsActive(sessionID string) bool {
+	session, err := s.repo.FindByID(sessionID)
+	if err != nil {
+		return false
+	}
+	return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
+
+func (s *sessionService) ListActive() ([]models.SessionInfo, error) {
+	return s.repo.ListActive()
+}
+
+func (s *sessionService) ListForUser(email, currentSessionID string) ([]models.SessionInfo, error) {
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.repo.ListActiveForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke ends one session and its refresh token family.
+func (s *sessionService) Revoke(sessionID string) error {
+	session, err := s.repo.FindByID(sessionID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+	if err := s.repo.Revoke(sessionID); err != nil {
+		return err
+	}
+	if err := s.refreshRepo.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+	return s.syncLoginStatus(session.UserID)
+}
+
+func (s *sessionService) RevokeAllForUser(userID int) error {
+	if err := s.repo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	if err := s.refreshRepo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	return s.syncLoginStatus(userID)
+}
+
+// RevokeOwn lets a user sign out one of their own devices.
+func (s *sessionService) RevokeOwn(email, sessionID string) error {
+	user, err := s.userRepo.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	session, err := s.repo.FindByID(sessionID)
+	if err != nil || session.UserID != user.ID || session.ImpersonatorID != nil {
+		return ErrSessionNotFound
+	}
+	if err := s.Revoke(sessionID); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(email, "REVOKE_SESSION", fmt.Sprintf("Signed out device %s (%s)", session.IPAddress, session.UserAgent))
+	return nil
+}
+
+func (s *sessionService) Kick(req models.KickRequest, actor *auth.Principal) error {
+	user, err := s.userRepo.GetByEmail(req.Email)
+	if err != nil {
+		return err
+	}
+
+	if req.SessionID == "" {
+		if err := s.RevokeAllForUser(user.ID); err != nil {
+			return err
+		}
+		s.userRepo.LogActivity(actor.Email, "KICK_USER", "Forced logout for "+req.Email)
+		return nil
+	}
+
+	session, err := s.repo.FindByID(req.SessionID)
+	if err != nil || session.UserID != user.ID {
+		return ErrSessionNotFound
+	}
+	if err := s.Revoke(req.SessionID); err != nil {
+		return err
+	}
+	s.userRepo.LogActivity(actor.Email, "KICK_USER", fmt.Sprintf("Forced logout for %s (session from %s)", req.Email, session.IPAddress))
+	return nil
+}
+
+// syncLoginStatus keeps the legacy Users.IsLoggedIn flag in step with the sessions table.
+func (s *sessionService) syncLoginStatus(userID int) error {
+	count, err := s.repo.CountActiveForUser(userID)
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.userRepo.UpdateLoginStatus(user.Email, count > 0)
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-pertama/auth"
+	"go-pertama/models"
+)
+
+// GetUserHistory returns the user's snapshots, newest first, each with the
+// fields its action changed.
+func (s *userService) GetUserHistory(userID int) ([]models.UserHistory, error) {
+	history, err := s.repo.GetUserHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The newest snapshot is compared with the user as it is now, if it still exists
+	var next *models.UserHistory
+	if user, err := s.repo.GetByID(userID); err == nil {
+		next = snapshotOf(user)
+	} else if user, err := s.repo.GetDeletedByID(userID); err == nil {
+		next = snapshotOf(user)
+	}
+	for i := range history {
+		history[i].Changes = diffSnapshots(&history[i], next)
+		next = &history[i]
+	}
+	return history, nil
+}
+
+// RestoreHistory puts the user back the way it was in a history entry. A user
+// that no longer exists is created again with its old ID and a random
+// password, so it has to use "forgot password" to sign in.
+func (s *userService) RestoreHistory(userID, historyID int, actor *auth.Principal) error {
+	entry, err := s.repo.GetHistoryEntry(historyID)
+	if err != nil || entry.UserID != userID {
+		return errors.New("history entry not found")
+	}
+
+	taken, err := s.repo.EmailTakenByOther(entry.Email, userID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.New("email already exists")
+	}
+
+	exists := true
+	if _, err := s.repo.GetByID(userID); err == sql.ErrNoRows {
+		if _, err := s.repo.GetDeletedByID(userID); err == sql.ErrNoRows {
+			exists = false
+		} else if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if exists {
+		err = s.repo.ApplySnapshot(entry, actor.Name)
+	} else {
+		var hashed string
+		if hashed, err = unusablePassword(s.passwords); err == nil {
+			err = s.repo.Recreate(entry, hashed, actor.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.repo.LogActivity(actor.Email, "RESTORE_USER", fmt.Sprintf("Restored user ID: %d (%s) to history entry %d from %s",
+		userID, entry.Email, entry.ID, entry.ChangedAt.Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+func snapshotOf(user *models.User) *models.UserHistory {
+	return &models.UserHistory{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Name:     user.Name,
+		Role:     user.Role,
+		RoleID:   user.RoleID,
+		IsActive: user.IsActive,
+	}
+}
+
+func diffSnapshots(before, after *models.UserHistory) []models.FieldChange {
+	changes := []models.FieldChange{}
+	if after == nil {
+		return changes
+	}
+	if before.Email != after.Email {
+		changes = append(changes, models.FieldChange{Field: "email", From: before.Email, To: after.Email})
+	}
+	if before.Name != after.Name {
+		changes = append(changes, models.FieldChange{Field: "name", From: before.Name, To: after.Name})
+	}
+	if before.RoleID != after.RoleID || before.Role != after.Role {
+		changes = append(changes, models.FieldChange{Field: "role", From: before.Role, To: after.Role})
+	}
+	if before.IsActive != after.IsActive {
+		changes = append(changes, models.FieldChange{Field: "isActive", From: before.IsActive, To: after.IsActive})
+	}
+	return changes
+}
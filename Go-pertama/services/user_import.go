@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-pertama/auth"
+	"go-pertama/models"
+	"go-pertama/repository"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	ErrInvalidImportFile    = errors.New("invalid import file")
+	ErrImportReportNotFound = errors.New("import error report not found or expired")
+)
+
+var (
+	importRequiredColumns = []string{"email", "name", "role"}
+	importColumnAliases   = map[string]string{"emailaddress": "email", "fullname": "name", "rolename": "role", "isactive": "active", "status": "active"}
+	importActiveValues    = map[string]bool{"": true, "1": true, "true": true, "yes": true, "y": true, "active": true, "0": false, "false": false, "no": false, "n": false, "inactive": false}
+	importHeaderNoise     = strings.NewReplacer(" ", "", "_", "", "-", "")
+	importReportHeader    = []interface{}{"Row", "Email", "Name", "Role", "Active", "Errors"}
+)
+
+const (
+	maxImportRows     = 5000
+	importReportSheet = "Errors"
+	// importReportTTL is how long an error workbook can be downloaded after the import.
+	importReportTTL = time.Hour
+)
+
+// UserImportService creates and updates users in bulk from an XLSX or CSV
+// file with the columns email, name, role, active and, optionally, password.
+type UserImportService interface {
+	Import(file io.Reader, filename string, dryRun bool, actor *auth.Principal) (*models.UserImportResult, error)
+	ErrorReport(id string, actor *auth.Principal) ([]byte, error)
+}
+
+type userImportService struct {
+	userRepo  repository.UserRepository
+	roleRepo  repository.RoleRepository
+	passwords PasswordService
+
+	mu      sync.Mutex
+	reports map[string]importReport
+}
+
+type importReport struct {
+	ownerID   int
+	workbook  []byte
+	expiresAt time.Time
+}
+
+func NewUserImportService(userRepo repository.UserRepository, roleRepo repository.RoleRepository, passwords PasswordService) UserImportService {
+	return &userImportService{userRepo: userRepo, roleRepo: roleRepo, passwords: passwords, reports: make(map[string]importReport)}
+}
+
+// Import validates every row before touching it. Rows with errors are skipped
+// and reported; the others are applied unless dryRun is set, in which case the
+// counts say what would have happened.
+func (s *userImportService) Import(file io.Reader, filename string, dryRun bool, actor *auth.Principal) (*models.UserImportResult, error) {
+	rows, err := readImportFile(file, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.UserImportResult{DryRun: dryRun, Total: len(rows), Errors: []models.UserImportError{}}
+	roles := make(map[string]*models.Role)
+	seen := make(map[string]int)
+	var failed []models.UserImportRow
+
+	for _, row := range rows {
+		rowErrors, err := s.importRow(row, roles, seen, dryRun, actor, result)
+		if err != nil {
+			return nil, err
+		}
+		if len(rowErrors) > 0 {
+			result.Skipped++
+			result.Errors = append(result.Errors, rowErrors...)
+			failed = append(failed, row)
+		}
+	}
+
+	if len(failed) > 0 {
+		id, err := s.storeErrorReport(failed, result.Errors, actor.UserID)
+		if err != nil {
+			return nil, err
+		}
+		result.ErrorReportURL = "/api/users/import/errors/" + id
+	}
+
+	if !dryRun {
+		s.userRepo.LogActivity(actor.Email, "IMPORT_USERS", fmt.Sprintf("Imported %s: %d created, %d updated, %d skipped",
+			filename, result.Created, result.Updated, result.Skipped))
+	}
+	return result, nil
+}
+
+// importRow checks one row and, outside a dry run, saves it. Problems with the
+// row are returned as row errors; the error result is only for failures that
+// stop the whole import.
+func (s *userImportService) importRow(row models.UserImportRow, roles map[string]*models.Role, seen map[string]int, dryRun bool, actor *auth.Principal, result *models.UserImportResult) ([]models.UserImportError, error) {
+	var rowErrors []models.UserImportError
+	fail := func(field, format string, args ...interface{}) {
+		rowErrors = append(rowErrors, models.UserImportError{Row: row.Row, Email: row.Email, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	emailValid := false
+	if row.Email == "" {
+		fail("email", "Email is required")
+	} else if addr, err := mail.ParseAddress(row.Email); err != nil || addr.Address != row.Email {
+		fail("email", "Email is not a valid address")
+	} else if first, ok := seen[strings.ToLower(row.Email)]; ok {
+		fail("email", "Email appears more than once in the file (first on row %d)", first)
+	} else {
+		seen[strings.ToLower(row.Email)] = row.Row
+		emailValid = true
+	}
+
+	if row.Name == "" {
+		fail("name", "Name is required")
+	}
+
+	var role *models.Role
+	if row.Role == "" {
+		fail("role", "Role is required")
+	} else {
+		key := strings.ToLower(row.Role)
+		if _, ok := roles[key]; !ok {
+			found, err := s.roleRepo.FindByName(row.Role)
+			if err != nil {
+				found = nil
+			}
+			roles[key] = found // nil remembers that the role does not exist
+		}
+		if role = roles[key]; role == nil {
+			fail("role", "Role %q does not exist", row.Role)
+		} else if !role.IsActive {
+			fail("role", "Role %q is inactive", role.Name)
+		}
+	}
+
+	active, ok := importActiveValues[strings.ToLower(row.Active)]
+	if !ok {
+		fail("active", "Active must be yes or no, got %q", row.Active)
+	}
+
+	var existing *models.User
+	if emailValid {
+		exists, err := s.userRepo.EmailExists(row.Email)
+		if err != nil {
+			return nil, errors.New("database connection error")
+		}
+		if exists {
+			if existing, err = s.userRepo.GetByEmail(row.Email); err != nil {
+				return nil, errors.New("database connection error")
+			}
+		}
+	}
+
+	switch {
+	case existing != nil && existing.IsServiceAccount && row.Password != "":
+		fail("password", "Service accounts cannot have a password")
+	case row.Password != "":
+		userID := 0
+		if existing != nil {
+			userID = existing.ID
+		}
+		if err := s.passwords.Validate(userID, row.Email, row.Password); err != nil {
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				return nil, err
+			}
+			for _, v := range policyErr.Violations {
+				fail("password", "%s", v.Message)
+			}
+		}
+	}
+
+	if len(rowErrors) > 0 {
+		return rowErrors, nil
+	}
+
+	if existing == nil {
+		if !dryRun {
+			if err := s.createImported(row, role, active, actor); err != nil {
+				fail("", "Could not create user: %v", err)
+				return rowErrors, nil
+			}
+		}
+		result.Created++
+		return nil, nil
+	}
+
+	if existing.Name == row.Name && existing.RoleID == role.ID && existing.IsActive == active && row.Password == "" {
+		// Nothing to change
+		result.Skipped++
+		return nil, nil
+	}
+	if !dryRun {
+		if err := s.updateImported(existing, row, role, active, actor); err != nil {
+			fail("", "Could not update user: %v", err)
+			return rowErrors, nil
+		}
+	}
+	result.Updated++
+	return nil, nil
+}
+
+// createImported saves a new user. The password from the file is only a
+// starting password, so it has to be changed at the first login. Without one
+// the user gets a password nobody knows and sets their own with a password
+// reset.
+func (s *userImportService) createImported(row models.UserImportRow, role *models.Role, active bool, actor *auth.Principal) error {
+	var hashed string
+	var err error
+	if row.Password != "" {
+		hashed, err = s.passwords.Hash(row.Password)
+	} else {
+		hashed, err = unusablePassword(s.passwords)
+	}
+	if err != nil {
+		return err
+	}
+	user := models.User{
+		Email:     row.Email,
+		Password:  hashed,
+		Name:      row.Name,
+		Role:      role.Name,
+		RoleID:    role.ID,
+		IsActive:  active,
+		CreatedBy: actor.Name,
+		UpdatedBy: actor.Name,
+	}
+	if err := s.userRepo.Create(&user); err != nil {
+		return err
+	}
+	if created, err := s.userRepo.GetByEmail(row.Email); err == nil {
+		if row.Password != "" {
+			s.passwords.Remember(created.ID, hashed)
+		}
+		s.userRepo.SetMustChangePassword(created.ID, true)
+	}
+	s.userRepo.LogActivity(actor.Email, "CREATE_USER", fmt.Sprintf("Created user: %s (import, row %d)", row.Email, row.Row))
+	return nil
+}
+
+func (s *userImportService) updateImported(user *models.User, row models.UserImportRow, role *models.Role, active bool, actor *auth.Principal) error {
+	user.Name = row.Name
+	user.Role = role.Name
+	user.RoleID = role.ID
+	user.IsActive = active
+	user.UpdatedBy = actor.Name
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	if row.Password != "" {
+		if err := s.passwords.Save(user.ID, row.Password); err != nil {
+			return err
+		}
+		s.userRepo.SetMustChangePassword(user.ID, true)
+	}
+	s.userRepo.LogActivity(actor.Email, "UPDATE_USER", fmt.Sprintf("Updated user ID: %d (import, row %d)", user.ID, row.Row))
+	return nil
+}
+
+// ErrorReport returns a stored error workbook. Only the user who ran the
+// import can download it.
+func (s *userImportService) ErrorReport(id string, actor *auth.Principal) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, ok := s.reports[id]
+	if !ok || report.ownerID != actor.UserID || time.Now().After(report.expiresAt) {
+		return nil, ErrImportReportNotFound
+	}
+	return report.workbook, nil
+}
+
+// storeErrorReport builds a workbook of the failed rows, without passwords,
+// so they can be fixed and uploaded again.
+func (s *userImportService) storeErrorReport(failed []models.UserImportRow, rowErrors []models.UserImportError, ownerID int) (string, error) {
+	messages := make(map[int][]string)
+	for _, e := range rowErrors {
+		messages[e.Row] = append(messages[e.Row], e.Message)
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	f.SetSheetName("Sheet1", importReportSheet)
+	if err := f.SetSheetRow(importReportSheet, "A1", &importReportHeader); err != nil {
+		return "", err
+	}
+	for i, row := range failed {
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		values := []interface{}{row.Row, row.Email, row.Name, row.Role, row.Active, strings.Join(messages[row.Row], "; ")}
+		if err := f.SetSheetRow(importReportSheet, cell, &values); err != nil {
+			return "", err
+		}
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return "", err
+	}
+
+	id, err := auth.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, report := range s.reports {
+		if now.After(report.expiresAt) {
+			delete(s.reports, key)
+		}
+	}
+	s.reports[id] = importReport{ownerID: ownerID, workbook: buf.Bytes(), expiresAt: now.Add(importReportTTL)}
+	return id, nil
+}
+
+// readImportFile reads the first sheet of an XLSX file or a comma or
+// semicolon separated CSV file. Blank rows are ignored.
+func readImportFile(file io.Reader, filename string) ([]models.UserImportRow, error) {
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx", ".xlsm":
+		f, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		defer f.Close()
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("%w: no sheets found", ErrInvalidImportFile)
+		}
+		if records, err = f.GetRows(sheets[0]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+	case ".csv":
+		var err error
+		if records, err = readCSV(file); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: only .xlsx and .csv files are supported", ErrInvalidImportFile)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImportFile)
+	}
+
+	columns := make(map[string]int)
+	for i, h := range records[0] {
+		key := importHeaderNoise.Replace(strings.ToLower(strings.TrimSpace(h)))
+		if alias, ok := importColumnAliases[key]; ok {
+			key = alias
+		}
+		if _, dup := columns[key]; !dup {
+			columns[key] = i
+		}
+	}
+	for _, col := range importRequiredColumns {
+		if _, ok := columns[col]; !ok {
+			return nil, fmt.Errorf("%w: missing required column: %s", ErrInvalidImportFile, col)
+		}
+	}
+
+	var rows []models.UserImportRow
+	for i, record := range records[1:] {
+		cell := func(col string) string {
+			idx, ok := columns[col]
+			if !ok || idx >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[idx])
+		}
+		row := models.UserImportRow{
+			Row:      i + 2,
+			Email:    cell("email"),
+			Name:     cell("name"),
+			Role:     cell("role"),
+			Active:   cell("active"),
+			Password: cell("password"),
+		}
+		if row.Email == "" && row.Name == "" && row.Role == "" && row.Active == "" && row.Password == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: no data rows", ErrInvalidImportFile)
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("%w: at most %d rows can be imported at once", ErrInvalidImportFile, maxImportRows)
+	}
+	return rows, nil
+}
+
+// readCSV reads a CSV file as saved by Excel: an optional byte order mark and
+// a semicolon separator in locales that use a decimal comma.
+func readCSV(file io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		r.Comma = ';'
+	}
+	return r.ReadAll()
+}
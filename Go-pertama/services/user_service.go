@@ -1,47 +1,47 @@
 package services
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
+	"go-pertama/auth"
 	"go-pertama/models"
 	"go-pertama/repository"
 	"io"
 	"mime/multipart"
 	"net/http"
-
-	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 type UserService interface {
 	GetAll(page, limit int, search string, roleID int) (*models.UsersResponse, error)
-	Create(req models.CreateUserRequest, creatorEmail, creatorName string) error
-	Update(req models.UpdateUserRequest, updaterEmail, updaterName string) error
-	Delete(id int, deleterEmail, deleterName string) error
+	Create(req models.CreateUserRequest, actor *auth.Principal) error
+	Update(req models.UpdateUserRequest, actor *auth.Principal) error
+	Delete(id int, actor *auth.Principal) error
 	UploadProfilePicture(email string, file multipart.File, header *multipart.FileHeader) error
 	GetAvatar(email string) ([]byte, string, error)
 	GetAvatarByID(id int) ([]byte, string, error)
 	RemoveAvatar(email string) error
 	GetProfile(email string) (*models.User, error)
-	ResetFailedAttempts(id int, updatedBy string) error
-	GetActiveUsers() ([]models.User, error)
-	KickUser(email string, kickedBy string) error
+	ResetFailedAttempts(id int, actor *auth.Principal) error
 	GetActivityLogs(email string, limit int, offset int) ([]models.ActivityLog, error)
 	GetAllActivityLogs(page, limit int, search string, userID int, startDate, endDate string) ([]models.ActivityLog, int, error)
 	ExportActivityLogs(search string, userID int, startDate, endDate string) ([]byte, error)
 	LogActivity(email, action, details string) error
 	GetUserHistory(userID int) ([]models.UserHistory, error)
+	RestoreHistory(userID, historyID int, actor *auth.Principal) error
+	GetDeleted(page, limit int, search string) (*models.UsersResponse, error)
+	Restore(id int, actor *auth.Principal) error
+	PurgeDeleted(olderThan time.Duration) (int, error)
 }
 
 type userService struct {
-	repo repository.UserRepository
-}
-
-func NewUserService(repo repository.UserRepository) UserService {
-	return &userService{repo: repo}
+	repo      repository.UserRepository
+	passwords PasswordService
 }
 
-func (s *userService) GetUserHistory(userID int) ([]models.UserHistory, error) {
-	return s.repo.GetUserHistory(userID)
+func NewUserService(repo repository.UserRepository, passwords PasswordService) UserService {
+	return &userService{repo: repo, passwords: passwords}
 }
 
 func (s *userService) LogActivity(email, action, details string) error {
@@ -49,22 +49,10 @@ func (s *userService) LogActivity(email, action, details string) error {
 	return nil
 }
 
-func (s *userService) ResetFailedAttempts(id int, updatedBy string) error {
-	err := s.repo.UpdateFailedAttempts(id, 0)
+func (s *userService) ResetFailedAttempts(id int, actor *auth.Principal) error {
+	err := s.repo.UpdateLockout(id, 0, nil)
 	if err == nil {
-		s.repo.LogActivity(updatedBy, "RESET_FAILED_ATTEMPTS", fmt.Sprintf("Reset failed attempts for user ID %d", id))
-	}
-	return err
-}
-
-func (s *userService) GetActiveUsers() ([]models.User, error) {
-	return s.repo.GetActiveUsers()
-}
-
-func (s *userService) KickUser(email string, kickedBy string) error {
-	err := s.repo.UpdateLoginStatus(email, false)
-	if err == nil {
-		s.repo.LogActivity(kickedBy, "KICK_USER", "Forced logout for "+email)
+		s.repo.LogActivity(actor.Email, "RESET_FAILED_ATTEMPTS", fmt.Sprintf("Reset failed attempts and unlocked user ID %d", id))
 	}
 	return err
 }
@@ -94,36 +82,54 @@ func (s *userService) GetAll(page, limit int, search string, roleID int) (*model
 	}, nil
 }
 
-func (s *userService) Create(req models.CreateUserRequest, creatorEmail, creatorName string) error {
+func (s *userService) Create(req models.CreateUserRequest, actor *auth.Principal) error {
 	exists, _ := s.repo.EmailExists(req.Email)
 	if exists {
 		return errors.New("email already exists")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	var hashedPassword string
+	var err error
+	if req.IsServiceAccount {
+		// Service accounts authenticate with API keys only
+		hashedPassword, err = unusablePassword(s.passwords)
+	} else {
+		if err := s.passwords.Validate(0, req.Email, req.Password); err != nil {
+			return err
+		}
+		hashedPassword, err = s.passwords.Hash(req.Password)
+	}
 	if err != nil {
 		return err
 	}
 
 	user := models.User{
-		Email:     req.Email,
-		Password:  string(hashedPassword),
-		Name:      req.Name,
-		Role:      req.Role, // Kept for backward compatibility
-		RoleID:    req.RoleID,
-		IsActive:  req.IsActive,
-		CreatedBy: creatorName,
-		UpdatedBy: creatorName,
+		Email:            req.Email,
+		Password:         hashedPassword,
+		Name:             req.Name,
+		Role:             req.Role, // Kept for backward compatibility
+		RoleID:           req.RoleID,
+		IsActive:         req.IsActive,
+		CreatedBy:        actor.Name,
+		UpdatedBy:        actor.Name,
+		IsServiceAccount: req.IsServiceAccount,
 	}
 
 	err = s.repo.Create(&user)
 	if err == nil {
-		s.repo.LogActivity(creatorEmail, "CREATE_USER", fmt.Sprintf("Created user: %s", req.Email))
+		if created, err := s.repo.GetByEmail(req.Email); err == nil && !req.IsServiceAccount {
+			s.passwords.Remember(created.ID, user.Password)
+		}
+		kind := "user"
+		if req.IsServiceAccount {
+			kind = "service account"
+		}
+		s.repo.LogActivity(actor.Email, "CREATE_USER", fmt.Sprintf("Created %s: %s", kind, req.Email))
 	}
 	return err
 }
 
-func (s *userService) Update(req models.UpdateUserRequest, updaterEmail, updaterName string) error {
+func (s *userService) Update(req models.UpdateUserRequest, actor *auth.Principal) error {
 	user, err := s.repo.GetByID(req.ID)
 	if err != nil {
 		return err
@@ -133,15 +139,7 @@ func (s *userService) Update(req models.UpdateUserRequest, updaterEmail, updater
 	user.Role = req.Role // Kept for backward compatibility
 	user.RoleID = req.RoleID
 	user.IsActive = req.IsActive
-	user.UpdatedBy = updaterName
-
-	if req.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return err
-		}
-		user.Password = string(hashedPassword)
-	}
+	user.UpdatedBy = actor.Name
 
 	// If email is changed, check uniqueness
 	if req.Email != user.Email {
@@ -152,17 +150,45 @@ func (s *userService) Update(req models.UpdateUserRequest, updaterEmail, updater
 		user.Email = req.Email
 	}
 
+	if req.AllowedNetworks != nil {
+		if err := validateNetworks("allowed networks", *req.AllowedNetworks); err != nil {
+			return err
+		}
+		user.AllowedNetworks = *req.AllowedNetworks
+	}
+	if req.DeniedNetworks != nil {
+		if err := validateNetworks("denied networks", *req.DeniedNetworks); err != nil {
+			return err
+		}
+		user.DeniedNetworks = *req.DeniedNetworks
+	}
+
+	if req.Password != "" {
+		if err := s.passwords.Validate(user.ID, user.Email, req.Password); err != nil {
+			return err
+		}
+	}
+
 	err = s.repo.Update(user)
-	if err == nil {
-		s.repo.LogActivity(updaterEmail, "UPDATE_USER", fmt.Sprintf("Updated user ID: %d", req.ID))
+	if err != nil {
+		return err
 	}
-	return err
+	if req.Password != "" {
+		if err := s.passwords.Save(user.ID, req.Password); err != nil {
+			return err
+		}
+	}
+	s.repo.LogActivity(actor.Email, "UPDATE_USER", fmt.Sprintf("Updated user ID: %d", req.ID))
+	return nil
 }
 
-func (s *userService) Delete(id int, deleterEmail, deleterName string) error {
-	err := s.repo.Delete(id, deleterName)
+func (s *userService) Delete(id int, actor *auth.Principal) error {
+	err := s.repo.Delete(id, actor.Name)
+	if err == sql.ErrNoRows {
+		return errors.New("user not found")
+	}
 	if err == nil {
-		s.repo.LogActivity(deleterEmail, "DELETE_USER", fmt.Sprintf("Deleted user ID: %d", id))
+		s.repo.LogActivity(actor.Email, "DELETE_USER", fmt.Sprintf("Deleted user ID: %d", id))
 	}
 	return err
 }
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"go-pertama/auth"
+	"go-pertama/models"
+	"log"
+	"time"
+)
+
+func (s *userService) GetDeleted(page, limit int, search string) (*models.UsersResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 5
+	}
+
+	users, total, err := s.repo.GetDeleted(page, limit, search)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UsersResponse{
+		Data:  users,
+		Total: total,
+		Page:  page,
+		Limit: limit,
+	}, nil
+}
+
+// Restore brings back a deleted user, unless its email has been given to a
+// new user in the meantime.
+func (s *userService) Restore(id int, actor *auth.Principal) error {
+	user, err := s.repo.GetDeletedByID(id)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if exists, _ := s.repo.EmailExists(user.Email); exists {
+		return errors.New("email already exists")
+	}
+
+	if err := s.repo.Restore(id, actor.Name); err != nil {
+		return err
+	}
+	s.repo.LogActivity(actor.Email, "RESTORE_USER", fmt.Sprintf("Restored user ID: %d (%s)", id, user.Email))
+	return nil
+}
+
+// PurgeDeleted permanently removes users that were deleted longer ago than olderThan.
+func (s *userService) PurgeDeleted(olderThan time.Duration) (int, error) {
+	purged, err := s.repo.PurgeDeleted(time.Now().Add(-olderThan))
+	for _, email := range purged {
+		log.Printf("Purged deleted user %s", email)
+	}
+	return len(purged), err
+}
+
+// RunUserPurge purges deleted users every interval until the process exits.
+// The retention comes from the user_purge_after_days config; 0 keeps deleted
+// users forever. A failing pass is logged and retried at the next interval.
+func RunUserPurge(users UserService, configs ConfigService, interval time.Duration) {
+	for {
+		purgeOnce(users, configs)
+		time.Sleep(interval)
+	}
+}
+
+func purgeOnce(users UserService, configs ConfigService) {
+	// Runs in its own goroutine, where a panic would take the whole server down
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("User purge failed: %v", r)
+		}
+	}()
+
+	if days := configs.GetInt("user_purge_after_days", 30); days > 0 {
+		if n, err := users.PurgeDeleted(time.Duration(days) * 24 * time.Hour); err != nil {
+			log.Printf("User purge failed after %d users: %v", n, err)
+		} else if n > 0 {
+			log.Printf("User purge removed %d users deleted more than %d days ago", n, days)
+		}
+	}
+}
@@ -1,5 +1,11 @@
-$token = "sql-jwt-token-admin@example.com-secret-default"
-$headers = @{ Authorization = "Bearer $token" }
+# Runs as a service account: create one with isServiceAccount=true, then a key with
+# the sessions:read and sessions:kick scopes via POST /api/api-keys.
+$apiKey = $env:GP_API_KEY
+if (-not $apiKey) {
+    Write-Error "Set GP_API_KEY to a service account API key"
+    exit 1
+}
+$headers = @{ Authorization = "ApiKey $apiKey" }
 Write-Host "--- Active Users ---"
 $response = Invoke-RestMethod -Uri "http://localhost:8081/api/users/active" -Method Get -Headers $headers
 $response.data | Format-Table Email, IsLoggedIn, RoleID
@@ -14,10 +20,9 @@ try {
 }
 
 Write-Host "`n--- Verify Session Invalidated ---"
-try {
-    Invoke-RestMethod -Uri "http://localhost:8081/api/users/active" -Method Get -Headers $headers
-    Write-Host "ERROR: Session still valid!"
-} catch {
-    Write-Host "SUCCESS: Session invalidated (Expected 401)"
-    Write-Host $_.Exception.Response.StatusCode
+$response = Invoke-RestMethod -Uri "http://localhost:8081/api/users/active" -Method Get -Headers $headers
+if ($response.data | Where-Object { $_.email -eq "admin@example.com" }) {
+    Write-Host "ERROR: Session still active!"
+} else {
+    Write-Host "SUCCESS: Session invalidated"
 }
@@ -52,7 +52,7 @@ export default function ActiveUsers({ showToast, onLogout }) {
                     'Authorization': 'Bearer ' + (localStorage.getItem('token') || ''),
                     'Content-Type': 'application/json'
                 },
-                body: JSON.stringify({ email: userToKick.email })
+                body: JSON.stringify({ email: userToKick.email, sessionId: userToKick.sessionId })
             });
 
             if (response.ok) {
@@ -117,13 +117,13 @@ export default function ActiveUsers({ showToast, onLogout }) {
                     React.createElement('tr', {}, [
                         React.createElement('th', { className: 'ps-4', key: 'th-user' }, 'User'),
                         React.createElement('th', { key: 'th-role' }, 'Role'),
-                        React.createElement('th', { key: 'th-time' }, 'Login Time'),
+                        React.createElement('th', { key: 'th-time' }, 'Last Seen'),
                         React.createElement('th', { className: 'text-end pe-4', key: 'th-actions' }, 'Actions')
                     ])
                 ),
                 React.createElement('tbody', { key: 'tbody' }, 
                         users.length > 0 ? users.map(user => 
-                            React.createElement('tr', { key: user.email }, [
+                            React.createElement('tr', { key: user.sessionId }, [
                                 React.createElement('td', { className: 'ps-4', key: 'td-user' }, [
                                     React.createElement('div', { className: 'd-flex align-items-center' }, [
                                         React.createElement('div', { 
@@ -132,7 +132,8 @@ export default function ActiveUsers({ showToast, onLogout }) {
                                         }, (user.name || '?').charAt(0).toUpperCase()),
                                         React.createElement('div', {}, [
                                             React.createElement('div', { className: 'fw-bold' }, user.name || 'Unknown'),
-                                            React.createElement('div', { className: 'small text-muted' }, user.email)
+                                            React.createElement('div', { className: 'small text-muted' }, user.email),
+                                            React.createElement('div', { className: 'small text-muted' }, `${user.ipAddress || ''} ${user.userAgent || ''}`)
                                         ])
                                     ])
                                 ]),
@@ -140,7 +141,7 @@ export default function ActiveUsers({ showToast, onLogout }) {
                                     React.createElement('span', { className: 'badge bg-modern-subtle text-primary' }, user.role || 'User')
                                 ),
                                 React.createElement('td', { key: 'td-time' }, 
-                                    user.lastLogin ? new Date(user.lastLogin).toLocaleString() : '-'
+                                    user.lastSeenAt ? new Date(user.lastSeenAt).toLocaleString() : '-'
                                 ),
                                 React.createElement('td', { className: 'text-end pe-4', key: 'td-actions' }, 
                                     React.createElement('button', {
@@ -176,7 +177,7 @@ export default function ActiveUsers({ showToast, onLogout }) {
                                 React.createElement('strong', { className: 'text-body' }, userToKick?.name || userToKick?.email),
                                 '?'
                             ]),
-                            React.createElement('p', { className: 'small text-muted mt-2 mb-0' }, 'This will immediately terminate their active session.')
+                            React.createElement('p', { className: 'small text-muted mt-2 mb-0' }, 'This will immediately terminate this session.')
                         ]),
                         React.createElement('div', { className: 'modal-footer border-0 pt-0' }, [
                             React.createElement('button', { 
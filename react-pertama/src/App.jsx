@@ -2,6 +2,7 @@ const React = window.React;
 const { useState, useEffect } = React;
 const $ = window.jQuery;
 import config from '/src/config.js';
+import { saveSession, hasSession, clearSession, endImpersonation } from '/src/session.js';
 import Users from '/src/Users.jsx';
 import Config from '/src/Config.jsx';
 import ChangePassword from '/src/ChangePassword.jsx';
@@ -610,6 +611,16 @@ function DashboardLayout({ onLogout, isDarkMode, toggleTheme, togglePasswordModa
         togglePasswordModal: togglePasswordModal,
         user: user
       }),
+      user && user.impersonatedBy && React.createElement('div', {
+        key: 'impersonation',
+        className: 'alert alert-warning rounded-0 mb-0 py-2 d-flex align-items-center justify-content-between'
+      }, [
+        React.createElement('span', { key: 'text' }, [
+          React.createElement('i', { key: 'icon', className: 'fa-solid fa-user-secret me-2' }),
+          `Viewing as ${user.name || user.email}, impersonated by ${user.impersonatedBy.email}`
+        ]),
+        React.createElement('button', { key: 'end', className: 'btn btn-sm btn-warning', onClick: () => onLogout() }, 'End impersonation')
+      ]),
       React.createElement('main', { 
         key: 'main', 
         className: 'flex-grow-1 overflow-auto custom-scrollbar', 
@@ -621,19 +632,216 @@ function DashboardLayout({ onLogout, isDarkMode, toggleTheme, togglePasswordModa
   ]);
 }
 
-function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError }) {
+// tooManyAttemptsMessage turns a 429 response into a message with the wait time from Retry-After.
+function tooManyAttemptsMessage(response) {
+  const seconds = parseInt(response.headers.get('Retry-After'), 10);
+  if (!seconds) {
+    return 'Too many attempts. Please try again later.';
+  }
+  return `Too many attempts. Please try again in ${seconds} second${seconds === 1 ? '' : 's'}.`;
+}
+
+function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError, initialMfaChallenge }) {
   const [email, setEmail] = useState('admin@example.com');
-  const [password, setPassword] = useState('password123');
+  const [password, setPassword] = useState('');
   const [error, setError] = useState(initialError || '');
   const [isLoading, setIsLoading] = useState(false);
+  const [mfaChallenge, setMfaChallenge] = useState(initialMfaChallenge || null);
+  const [mfaCode, setMfaCode] = useState('');
+  const [sso, setSso] = useState(null);
+  const [registration, setRegistration] = useState(null);
+  const [isRegistering, setIsRegistering] = useState(false);
+  const [name, setName] = useState('');
+  const [notice, setNotice] = useState('');
+  const [invitation, setInvitation] = useState(null);
+
+  // Offer single sign-on only when the backend has a provider configured
+  useEffect(() => {
+    fetch(`${config.api.baseUrl}/auth/oidc`)
+      .then(res => res.json())
+      .then(data => { if (data.enabled) setSso(data); })
+      .catch(() => {});
+    fetch(`${config.api.baseUrl}/auth/registration`)
+      .then(res => res.json())
+      .then(data => { if (data.enabled) setRegistration(data); })
+      .catch(() => {});
+  }, []);
+
+  // The link in the verification email opens /verify-email?token=...
+  useEffect(() => {
+    const token = new URLSearchParams(window.location.search).get('token');
+    if (!window.location.pathname.endsWith('/verify-email') || !token) return;
+    window.history.replaceState(null, '', '/');
+    fetch(`${config.api.baseUrl}/auth/verify-email`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token }),
+    })
+      .then(async res => {
+        if (!res.ok) throw new Error((await res.text()) || 'Verification failed');
+        return res.json();
+      })
+      .then(data => setNotice(data.message))
+      .catch(err => setError(err.message));
+  }, []);
+
+  // The link in an invitation email opens /accept-invitation?token=...
+  useEffect(() => {
+    const token = new URLSearchParams(window.location.search).get('token');
+    if (!window.location.pathname.endsWith('/accept-invitation') || !token) return;
+    window.history.replaceState(null, '', '/');
+    fetch(`${config.api.baseUrl}/auth/invitation?token=${encodeURIComponent(token)}`)
+      .then(async res => {
+        if (!res.ok) throw new Error((await res.text()) || 'Invalid invitation');
+        return res.json();
+      })
+      .then(data => {
+        setInvitation({ ...data, token });
+        setEmail(data.email);
+        setName(data.name || '');
+        setPassword('');
+      })
+      .catch(err => setError(err.message));
+  }, []);
+
+  const handleAcceptInvitation = async () => {
+    if (!name || !password) {
+      setError('Please fill in all fields');
+      return;
+    }
+
+    setIsLoading(true);
+    setError('');
+
+    try {
+      const response = await fetch(`${config.api.baseUrl}/auth/invitation/accept`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ token: invitation.token, name, password }),
+      });
+      if (response.status === 429) {
+        setError(tooManyAttemptsMessage(response));
+        return;
+      }
+      if (response.status === 422) {
+        const data = await response.json();
+        setError([data.message, ...(data.violations || [])].join(' '));
+        return;
+      }
+      if (!response.ok) {
+        setError((await response.text()) || 'Could not accept the invitation');
+        return;
+      }
+      const data = await response.json();
+      setNotice(data.message);
+      setInvitation(null);
+      setPassword('');
+    } catch (err) {
+      setError('Cannot connect to Backend Server. Is it running?');
+      console.error('Accept invitation error:', err);
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleRegister = async () => {
+    if (!name || !email || !password) {
+      setError('Please fill in all fields');
+      return;
+    }
+
+    setIsLoading(true);
+    setError('');
+
+    try {
+      const response = await fetch(`${config.api.baseUrl}/auth/register`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ name, email, password }),
+      });
+      if (response.status === 429) {
+        setError(tooManyAttemptsMessage(response));
+        return;
+      }
+      if (response.status === 422) {
+        const data = await response.json();
+        setError([data.message, ...(data.violations || [])].join(' '));
+        return;
+      }
+      if (!response.ok) {
+        setError((await response.text()) || 'Registration failed');
+        return;
+      }
+      const data = await response.json();
+      setNotice(data.message);
+      setIsRegistering(false);
+      setPassword('');
+    } catch (err) {
+      setError('Cannot connect to Backend Server. Is it running?');
+      console.error('Register error:', err);
+    } finally {
+      setIsLoading(false);
+    }
+  };
 
   // Update error if initialError changes (optional, but good for sync)
   useEffect(() => {
     if (initialError) setError(initialError);
   }, [initialError]);
 
+  const handleMfaSubmit = async () => {
+    if (!mfaCode) {
+      setError('Please enter the verification code');
+      return;
+    }
+
+    setIsLoading(true);
+    setError('');
+
+    try {
+      const response = await fetch(`${config.api.baseUrl}/auth/mfa/verify`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ challengeToken: mfaChallenge, code: mfaCode }),
+      });
+      if (response.status === 429) {
+        setError(tooManyAttemptsMessage(response));
+        return;
+      }
+      const data = await response.json();
+
+      if (data.success) {
+        saveSession(data);
+        onLogin(data.user);
+      } else {
+        setError(data.message || 'Verification failed');
+        setMfaCode('');
+      }
+    } catch (err) {
+      setError('Cannot connect to Backend Server. Is it running?');
+      console.error('MFA verify error:', err);
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
   const handleSubmit = async (e) => {
     e.preventDefault();
+    if (mfaChallenge) {
+      return handleMfaSubmit();
+    }
+    if (invitation) {
+      return handleAcceptInvitation();
+    }
+    if (isRegistering) {
+      return handleRegister();
+    }
     if (!email || !password) {
       setError('Please fill in all fields');
       return;
@@ -641,6 +849,7 @@ function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError }) {
 
     setIsLoading(true);
     setError('');
+    setNotice('');
 
     try {
       const response = await fetch(`${config.api.baseUrl}/login`, {
@@ -651,6 +860,13 @@ function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError }) {
         body: JSON.stringify({ email, password }),
       });
 
+      // Rate limited: too many attempts from this address or for this account
+      if (response.status === 429) {
+        setError(tooManyAttemptsMessage(response));
+        setIsLoading(false);
+        return;
+      }
+
       // Scenario 2: Database/Server Error
       if (response.status === 500 || response.status === 503) {
         setError('Cannot connect to Database. Please contact administrator.');
@@ -660,9 +876,11 @@ function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError }) {
 
       const data = await response.json();
 
-      if (data.success) {
-        localStorage.setItem('token', data.token);
-        localStorage.setItem('user', JSON.stringify(data.user));
+      if (data.mfaRequired) {
+        // Password accepted, a second factor is needed to finish
+        setMfaChallenge(data.challengeToken);
+      } else if (data.success) {
+        saveSession(data);
         onLogin(data.user);
       } else {
         // Scenario 3: Invalid Credentials (401) or other logic errors
@@ -695,23 +913,69 @@ function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError }) {
               React.createElement('div', { key: 'logo', className: 'd-inline-flex align-items-center justify-content-center bg-modern-subtle rounded-circle shadow-sm mb-3', style: { width: '64px', height: '64px' } },
                  React.createElement('i', { className: 'fa-brands fa-react fa-2x text-primary' })
               ),
-              React.createElement('h3', { key: 'title', className: 'fw-bold mb-1' }, 'Welcome Back'),
-              React.createElement('p', { key: 'subtitle', className: 'text-muted' }, 'Enter your credentials to access the admin.')
+              React.createElement('h3', { key: 'title', className: 'fw-bold mb-1' }, invitation ? 'Accept Invitation' : (isRegistering ? 'Create an Account' : 'Welcome Back')),
+              React.createElement('p', { key: 'subtitle', className: 'text-muted' }, invitation
+                ? `${invitation.invitedBy} invited ${invitation.email} as ${invitation.roleName}. Choose your password to finish.`
+                : isRegistering
+                ? (registration && registration.allowedDomains.length > 0 ? `Use your ${registration.allowedDomains.join(', ')} email address.` : 'We will email you a link to confirm your address.')
+                : 'Enter your credentials to access the admin.')
             ]),
             
             error && React.createElement('div', { key: 'error', className: 'alert alert-danger small py-2 mb-3' }, error),
+            notice && React.createElement('div', { key: 'notice', className: 'alert alert-success small py-2 mb-3' }, notice),
 
-            React.createElement('form', { key: 'form', onSubmit: handleSubmit }, [
+            React.createElement('form', { key: 'form', onSubmit: handleSubmit }, mfaChallenge ? [
+              React.createElement('div', { key: 'mfa', className: 'mb-4' }, [
+                React.createElement('label', { key: 'l', className: 'form-label small fw-bold text-muted ms-1' }, 'VERIFICATION CODE'),
+                React.createElement('input', {
+                  key: 'i',
+                  type: 'text',
+                  inputMode: 'numeric',
+                  autoComplete: 'one-time-code',
+                  className: 'form-control form-control-modern',
+                  placeholder: '6-digit code or recovery code',
+                  value: mfaCode,
+                  onChange: (e) => setMfaCode(e.target.value),
+                  disabled: isLoading,
+                  autoFocus: true
+                })
+              ]),
+              React.createElement('button', {
+                key: 'btn',
+                type: 'submit',
+                className: 'btn btn-primary-modern w-100 py-3 shadow-sm',
+                disabled: isLoading
+              }, isLoading ? 'Verifying...' : 'Verify'),
+              React.createElement('button', {
+                key: 'back',
+                type: 'button',
+                className: 'btn btn-link text-decoration-none btn-sm text-muted w-100 mt-2',
+                onClick: () => { setMfaChallenge(null); setMfaCode(''); setError(''); }
+              }, 'Back to sign in')
+            ] : [
+              (isRegistering || invitation) && React.createElement('div', { key: 'n', className: 'mb-3' }, [
+                React.createElement('label', { key: 'l', className: 'form-label small fw-bold text-muted ms-1' }, 'NAME'),
+                React.createElement('input', {
+                  key: 'i',
+                  type: 'text',
+                  autoComplete: 'name',
+                  className: 'form-control form-control-modern',
+                  value: name,
+                  onChange: (e) => setName(e.target.value),
+                  disabled: isLoading
+                })
+              ]),
               React.createElement('div', { key: 'u', className: 'mb-3' }, [
-                React.createElement('label', { key: 'l', className: 'form-label small fw-bold text-muted ms-1' }, 'EMAIL'),
+                React.createElement('label', { key: 'l', className: 'form-label small fw-bold text-muted ms-1' }, isRegistering ? 'EMAIL' : 'EMAIL OR USERNAME'),
                 React.createElement('input', {
                   key: 'i',
-                  type: 'email', // Changed to email for better validation
+                  type: 'text', // Directory (LDAP) users may sign in with a plain username
+                  autoComplete: 'username',
                   className: 'form-control form-control-modern',
                   placeholder: 'name@example.com',
                   value: email,
                   onChange: (e) => setEmail(e.target.value),
-                  disabled: isLoading
+                  disabled: isLoading || !!invitation
                 })
               ]),
               React.createElement('div', { key: 'p', className: 'mb-4' }, [
@@ -732,10 +996,30 @@ function LoginPage({ onLogin, isDarkMode, toggleTheme, initialError }) {
                 className: 'btn btn-primary-modern w-100 py-3 shadow-sm',
                 disabled: isLoading
               }, [
-                isLoading ? 'Signing In...' : 'Sign In ',
+                isLoading ? 'Please wait...' : (invitation || isRegistering ? 'Create Account ' : 'Sign In '),
                 !isLoading && React.createElement('i', { key: 'icon', className: 'fa-solid fa-arrow-right ms-2' })
               ])
             ]),
+            invitation && React.createElement('button', {
+              key: 'cancel-invitation',
+              type: 'button',
+              className: 'btn btn-link text-decoration-none btn-sm text-muted w-100 mt-2',
+              onClick: () => { setInvitation(null); setError(''); setPassword(''); }
+            }, 'Back to sign in'),
+            registration && !mfaChallenge && !invitation && React.createElement('button', {
+              key: 'register',
+              type: 'button',
+              className: 'btn btn-link text-decoration-none btn-sm w-100 mt-2',
+              onClick: () => { setIsRegistering(!isRegistering); setError(''); setNotice(''); setPassword(''); if (!isRegistering) setEmail(''); }
+            }, isRegistering ? 'Already have an account? Sign in' : 'No account yet? Create one'),
+            sso && !mfaChallenge && !isRegistering && !invitation && React.createElement('a', {
+              key: 'sso',
+              href: `${config.api.baseUrl}/auth/oidc/login`,
+              className: 'btn btn-outline-secondary w-100 py-3 mt-3'
+            }, [
+              React.createElement('i', { key: 'icon', className: 'fa-solid fa-building-shield me-2' }),
+              `Sign in with ${sso.provider}`
+            ]),
             React.createElement('div', { key: 'footer', className: 'text-center mt-4' },
               React.createElement('button', { 
                 className: 'btn btn-link text-decoration-none btn-sm text-muted',
@@ -764,6 +1048,7 @@ function App() {
   const [isPasswordModalOpen, setIsPasswordModalOpen] = useState(false);
   const [toasts, setToasts] = useState([]);
   const [loginError, setLoginError] = useState(null); // Global login error state
+  const [ssoMfaChallenge, setSsoMfaChallenge] = useState(null); // Single sign-on paused for a second factor
 
   const showToast = (message, type = 'success') => {
     const id = Date.now();
@@ -788,11 +1073,36 @@ function App() {
       document.body.classList.add('dark');
     }
 
+    // Single sign-on returns here with the tokens (or an error) in the URL fragment
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    if (params.has('token') || params.has('csrfToken') || params.has('oidcError') || params.has('mfaChallenge')) {
+      window.history.replaceState(null, '', window.location.pathname);
+      if (params.has('oidcError')) {
+        setLoginError(params.get('oidcError'));
+      } else if (params.has('mfaChallenge')) {
+        setSsoMfaChallenge(params.get('mfaChallenge'));
+      } else {
+        // In cookie session mode only the CSRF token comes back; the session is already in a cookie
+        const ssoToken = params.get('token') || '';
+        fetch(`${config.api.baseUrl}/api/profile`, { headers: { 'Authorization': `Bearer ${ssoToken}` } })
+          .then(res => res.ok ? res.json() : Promise.reject(res.status))
+          .then(profile => {
+            saveSession({ token: params.get('token'), csrfToken: params.get('csrfToken'), user: profile });
+            handleLogin(profile);
+          })
+          .catch(() => {
+            clearSession();
+            setLoginError('Single sign-on failed, please try again');
+          })
+          .finally(() => setIsLoading(false));
+        return;
+      }
+    }
+
     // Simulate a brief loading check for better UX
     setTimeout(() => {
-      const token = localStorage.getItem('token');
       const savedUser = localStorage.getItem('user');
-      if (token) {
+      if (hasSession()) {
         setIsLoggedIn(true);
         if (savedUser) setUser(JSON.parse(savedUser));
       }
@@ -819,25 +1129,32 @@ function App() {
     setIsLoggedIn(true);
     setUser(user);
     setLoginError(null);
+    setSsoMfaChallenge(null);
+    // Expired passwords must be changed before anything else works
+    if (user && user.mustChangePassword) setIsPasswordModalOpen(true);
   };
 
   const handleLogout = async (reason = null) => {
     setIsLoading(true);
     try {
-      const token = localStorage.getItem('token');
-      if (token) {
+      if (hasSession()) {
         await fetch(`${config.api.baseUrl}/logout`, {
           method: 'POST',
           headers: {
-            'Authorization': `Bearer ${token}`
+            'Authorization': `Bearer ${localStorage.getItem('token') || ''}`
           }
         });
       }
     } catch (error) {
       console.error('Logout error:', error);
     } finally {
-      localStorage.removeItem('token');
-      localStorage.removeItem('user');
+      // Leaving an impersonation returns to the admin's own session
+      if (endImpersonation()) {
+        localStorage.setItem('activeMenu', 'users');
+        window.location.reload();
+        return;
+      }
+      clearSession();
       setIsLoggedIn(false);
       setUser(null);
       if (reason && typeof reason === 'string') {
@@ -862,7 +1179,8 @@ function App() {
       onLogin: handleLogin,
       isDarkMode: isDarkMode,
       toggleTheme: toggleTheme,
-      initialError: loginError
+      initialError: loginError,
+      initialMfaChallenge: ssoMfaChallenge
     });
   }
 
@@ -38,8 +38,8 @@ export default function ChangePassword({ isOpen, onClose }) {
       return;
     }
 
-    if (formData.newPassword.length < 6) {
-      setMessage({ type: 'error', text: 'Password must be at least 6 characters long' });
+    if (formData.newPassword.length < 8) {
+      setMessage({ type: 'error', text: 'Password must be at least 8 characters long' });
       return;
     }
 
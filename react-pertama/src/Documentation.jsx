@@ -35,7 +35,8 @@ export default function Documentation() {
               token: "eyJhbGciOiJIUzI1NiIsIn...",
               user: { id: 1, name: "Admin", email: "admin@example.com", role: "admin" }
             },
-            401: { success: false, message: "Invalid credentials" }
+            401: { success: false, message: "Invalid credentials" },
+            429: "Too many requests, please try again later"
           }
         },
         {
@@ -22,7 +22,7 @@ export default function Roles({ showToast }) {
   const [showUsersModal, setShowUsersModal] = useState(false);
   
   const [modalMode, setModalMode] = useState('add'); // 'add' or 'edit'
-  const [currentRole, setCurrentRole] = useState({ id: 0, name: '', description: '' });
+  const [currentRole, setCurrentRole] = useState({ id: 0, name: '', description: '', allowedNetworks: '', deniedNetworks: '' });
   const [roleToDelete, setRoleToDelete] = useState(null);
   
   // State for viewing users in a role
@@ -178,7 +178,7 @@ export default function Roles({ showToast }) {
 
   const openAddModal = () => {
     setModalMode('add');
-    setCurrentRole({ id: 0, name: '', description: '' });
+    setCurrentRole({ id: 0, name: '', description: '', allowedNetworks: '', deniedNetworks: '' });
     setShowModal(true);
   };
 
@@ -350,6 +350,27 @@ export default function Roles({ showToast }) {
                   value: currentRole.description,
                   onChange: (e) => setCurrentRole({ ...currentRole, description: e.target.value })
                 })
+              ]),
+              React.createElement('div', { className: 'mb-3' }, [
+                React.createElement('label', { className: 'form-label small fw-bold text-muted' }, 'ALLOWED NETWORKS'),
+                React.createElement('input', {
+                  type: 'text',
+                  className: 'form-control form-control-modern',
+                  placeholder: 'Any network, or e.g. 10.0.0.0/8, 192.168.10.0/24',
+                  value: currentRole.allowedNetworks || '',
+                  onChange: (e) => setCurrentRole({ ...currentRole, allowedNetworks: e.target.value })
+                }),
+                React.createElement('div', { className: 'form-text' }, 'Comma separated CIDR ranges. Users of this role can only sign in from these networks.')
+              ]),
+              React.createElement('div', { className: 'mb-3' }, [
+                React.createElement('label', { className: 'form-label small fw-bold text-muted' }, 'DENIED NETWORKS'),
+                React.createElement('input', {
+                  type: 'text',
+                  className: 'form-control form-control-modern',
+                  placeholder: 'e.g. 203.0.113.0/24',
+                  value: currentRole.deniedNetworks || '',
+                  onChange: (e) => setCurrentRole({ ...currentRole, deniedNetworks: e.target.value })
+                })
               ])
             ]),
             React.createElement('div', { key: 'footer', className: 'modal-footer border-0 pt-0' }, [
@@ -3,6 +3,7 @@ const ReactDOM = window.ReactDOM; // Add ReactDOM
 import Pagination from './Pagination.jsx';
 import SearchInput from './SearchInput.jsx';
 import config from './config.js';
+import { startImpersonation } from './session.js';
 import CustomSelect from './CustomSelect.jsx';
 const { useState, useEffect } = React;
 
@@ -23,6 +24,22 @@ export default function Users({ showToast }) {
   const [modalMode, setModalMode] = useState('add'); // 'add' or 'edit'
   const [currentPage, setCurrentPage] = useState(1);
   const [itemsPerPage, setItemsPerPage] = useState(5);
+  const [showDeletedModal, setShowDeletedModal] = useState(false);
+  const [deletedUsers, setDeletedUsers] = useState([]);
+  const [loadingDeleted, setLoadingDeleted] = useState(false);
+  const [showRegistrationsModal, setShowRegistrationsModal] = useState(false);
+  const [registrations, setRegistrations] = useState([]);
+  const [loadingRegistrations, setLoadingRegistrations] = useState(false);
+  const [showInvitationsModal, setShowInvitationsModal] = useState(false);
+  const [invitations, setInvitations] = useState([]);
+  const [loadingInvitations, setLoadingInvitations] = useState(false);
+  const [newInvitation, setNewInvitation] = useState({ email: '', name: '', roleId: 0 });
+  const [inviting, setInviting] = useState(false);
+  const [showImportModal, setShowImportModal] = useState(false);
+  const [importFile, setImportFile] = useState(null);
+  const [importDryRun, setImportDryRun] = useState(true);
+  const [importResult, setImportResult] = useState(null);
+  const [importing, setImporting] = useState(false);
   const [currentUser, setCurrentUser] = useState({
     id: 0,
     name: '',
@@ -194,6 +211,27 @@ export default function Users({ showToast }) {
     }
   };
 
+  const handleImpersonate = async (user) => {
+    if (!window.confirm(`Sign in as ${user.email}? Password and two-factor changes are blocked while impersonating.`)) return;
+
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/users/${user.id}/impersonate`, {
+        method: 'POST',
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error(await response.text() || 'Failed to impersonate user');
+      const data = await response.json();
+      startImpersonation(data);
+      localStorage.setItem('activeMenu', 'profile');
+      window.location.reload();
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    }
+  };
+
   const fetchHistory = async (userId) => {
     setLoadingHistory(true);
     try {
@@ -216,6 +254,26 @@ export default function Users({ showToast }) {
     }
   };
 
+  const handleRestoreHistory = async (entry) => {
+    if (!window.confirm(`Restore ${entry.email} to how it was before the ${entry.action.toLowerCase()} on ${new Date(entry.changedAt).toLocaleString()}?`)) return;
+
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/users/${entry.userId}/history/${entry.id}/restore`, {
+        method: 'POST',
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error(await response.text() || 'Failed to restore user');
+      if (showToast) showToast('User restored successfully', 'success');
+      fetchHistory(entry.userId);
+      fetchUsers();
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    }
+  };
+
   const openHistoryModal = (user) => {
     setHistoryLogs([]);
     setShowHistoryModal(true);
@@ -258,6 +316,230 @@ export default function Users({ showToast }) {
   const indexOfLastItem = currentPage * itemsPerPage;
   const indexOfFirstItem = indexOfLastItem - itemsPerPage;
 
+  const fetchDeletedUsers = async () => {
+    setLoadingDeleted(true);
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/users/deleted?limit=100`, {
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error('Failed to load deleted users');
+      const data = await response.json();
+      setDeletedUsers(data.data || []);
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    } finally {
+      setLoadingDeleted(false);
+    }
+  };
+
+  const openDeletedModal = () => {
+    setShowDeletedModal(true);
+    fetchDeletedUsers();
+  };
+
+  const handleRestore = async (user) => {
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/users/${user.id}/restore`, {
+        method: 'POST',
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error(await response.text() || 'Failed to restore user');
+      if (showToast) showToast(`${user.email} restored`, 'success');
+      fetchDeletedUsers();
+      fetchUsers();
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    }
+  };
+
+  const fetchRegistrations = async () => {
+    setLoadingRegistrations(true);
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/registrations?limit=100`, {
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error('Failed to load registrations');
+      const data = await response.json();
+      setRegistrations(data.data || []);
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    } finally {
+      setLoadingRegistrations(false);
+    }
+  };
+
+  const openRegistrationsModal = () => {
+    setShowRegistrationsModal(true);
+    fetchRegistrations();
+  };
+
+  const handleRegistrationDecision = async (user, action) => {
+    let reason = '';
+    if (action === 'reject') {
+      reason = window.prompt(`Reject the registration of ${user.email}? Optional reason for the user:`, '');
+      if (reason === null) return;
+    }
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/registrations/${user.id}/${action}`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        },
+        body: JSON.stringify({ reason })
+      });
+      if (!response.ok) throw new Error(await response.text() || `Failed to ${action} registration`);
+      if (showToast) showToast(`${user.email} ${action === 'approve' ? 'approved' : 'rejected'}`, 'success');
+      fetchRegistrations();
+      fetchUsers();
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    }
+  };
+
+  const fetchInvitations = async () => {
+    setLoadingInvitations(true);
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/invitations?limit=100`, {
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error('Failed to load invitations');
+      const data = await response.json();
+      setInvitations(data.data || []);
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    } finally {
+      setLoadingInvitations(false);
+    }
+  };
+
+  const openInvitationsModal = () => {
+    setNewInvitation({ email: '', name: '', roleId: roles.length > 0 ? roles[0].id : 0 });
+    setShowInvitationsModal(true);
+    fetchInvitations();
+  };
+
+  const handleInvite = async (e) => {
+    e.preventDefault();
+    setInviting(true);
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/invitations`, {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        },
+        body: JSON.stringify(newInvitation)
+      });
+      if (!response.ok) throw new Error(await response.text() || 'Failed to send invitation');
+      if (showToast) showToast(`Invitation sent to ${newInvitation.email}`, 'success');
+      setNewInvitation({ ...newInvitation, email: '', name: '' });
+      fetchInvitations();
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    } finally {
+      setInviting(false);
+    }
+  };
+
+  const handleInvitationAction = async (invitation, action) => {
+    if (action === 'revoke' && !window.confirm(`Revoke the invitation to ${invitation.email}?`)) return;
+    try {
+      const response = await fetch(`${config.api.baseUrl}/api/invitations/${invitation.id}/${action}`, {
+        method: 'POST',
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error(await response.text() || `Failed to ${action} invitation`);
+      if (showToast) showToast(`Invitation to ${invitation.email} ${action === 'resend' ? 'resent' : 'revoked'}`, 'success');
+      fetchInvitations();
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    }
+  };
+
+  const invitationBadges = {
+    pending: 'bg-primary',
+    accepted: 'bg-success',
+    revoked: 'bg-secondary',
+    expired: 'bg-warning text-dark'
+  };
+
+  const openImportModal = () => {
+    setImportFile(null);
+    setImportDryRun(true);
+    setImportResult(null);
+    setShowImportModal(true);
+  };
+
+  const handleImport = async () => {
+    if (!importFile) return;
+    setImporting(true);
+    try {
+      const formData = new FormData();
+      formData.append('file', importFile);
+      const response = await fetch(`${config.api.baseUrl}/api/users/import?dryRun=${importDryRun}`, {
+        method: 'POST',
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        },
+        body: formData
+      });
+      if (!response.ok) throw new Error(await response.text() || 'Import failed');
+      const data = await response.json();
+      setImportResult(data);
+      if (!data.dryRun) {
+        if (showToast) showToast(`Imported: ${data.created} created, ${data.updated} updated, ${data.skipped} skipped`, 'success');
+        fetchUsers();
+      }
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    } finally {
+      setImporting(false);
+    }
+  };
+
+  const downloadImportErrors = async () => {
+    try {
+      const response = await fetch(config.api.baseUrl + importResult.errorReportUrl, {
+        headers: {
+          'Authorization': 'Bearer ' + (localStorage.getItem('token') || '')
+        }
+      });
+      if (!response.ok) throw new Error('Error report is no longer available');
+
+      const blob = await response.blob();
+      const url = window.URL.createObjectURL(blob);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = `user_import_errors_${new Date().toISOString().slice(0,10)}.xlsx`;
+      document.body.appendChild(a);
+      a.click();
+      window.URL.revokeObjectURL(url);
+      document.body.removeChild(a);
+    } catch (err) {
+      if (showToast) showToast(err.message, 'error');
+      else alert(err.message);
+    }
+  };
+
   const handlePageChange = (pageNumber) => {
     setCurrentPage(pageNumber);
   };
@@ -275,8 +557,24 @@ export default function Users({ showToast }) {
               placeholder: 'Search users...',
               isLoading: loading && !isFirstLoad
             }),
+            React.createElement('button', { key: 'deleted', className: 'btn btn-outline-secondary rounded-pill px-3', onClick: openDeletedModal }, [
+                React.createElement('i', { key: 'icon', className: 'fa-solid fa-trash-arrow-up me-2' }),
+                React.createElement('span', { key: 'text' }, 'Deleted')
+            ]),
+            React.createElement('button', { key: 'registrations', className: 'btn btn-outline-secondary rounded-pill px-3', onClick: openRegistrationsModal }, [
+                React.createElement('i', { key: 'icon', className: 'fa-solid fa-user-clock me-2' }),
+                React.createElement('span', { key: 'text' }, 'Registrations')
+            ]),
+            React.createElement('button', { key: 'invitations', className: 'btn btn-outline-secondary rounded-pill px-3', onClick: openInvitationsModal }, [
+                React.createElement('i', { key: 'icon', className: 'fa-solid fa-envelope-open-text me-2' }),
+                React.createElement('span', { key: 'text' }, 'Invitations')
+            ]),
+            React.createElement('button', { key: 'import', className: 'btn btn-outline-primary rounded-pill px-3', onClick: openImportModal }, [
+                React.createElement('i', { key: 'icon', className: 'fa-solid fa-file-import me-2' }),
+                React.createElement('span', { key: 'text' }, 'Import')
+            ]),
             // Modern Add Button
-            React.createElement('button', { className: 'btn-add-modern', onClick: openAddModal }, [
+            React.createElement('button', { key: 'add', className: 'btn-add-modern', onClick: openAddModal }, [
                 React.createElement('i', { key: 'icon', className: 'fa-solid fa-plus' }),
                 React.createElement('span', { key: 'text' }, 'Add User')
             ])
@@ -347,6 +645,9 @@ export default function Users({ showToast }) {
                         React.createElement('button', { key: 'history', className: 'btn btn-sm btn-link text-info', onClick: () => openHistoryModal(user), title: 'View History' }, 
                             React.createElement('i', { className: 'fa-solid fa-clock-rotate-left' })
                         ),
+                        !user.isServiceAccount && React.createElement('button', { key: 'impersonate', className: 'btn btn-sm btn-link text-warning', onClick: () => handleImpersonate(user), title: 'Impersonate' }, 
+                            React.createElement('i', { className: 'fa-solid fa-user-secret' })
+                        ),
                         React.createElement('button', { key: 'edit', className: 'btn btn-sm btn-link text-primary', onClick: () => openEditModal(user) }, 
                             React.createElement('i', { className: 'fa-solid fa-pen-to-square' })
                         ),
@@ -448,6 +749,16 @@ export default function Users({ showToast }) {
                                   ])
                               ])
                           ]),
+                  modalMode === 'edit' && React.createElement('div', { key: 'network-row', className: 'row' }, [
+                      React.createElement('div', { key: 'allowed-col', className: 'col-md-6 mb-3' }, [
+                          React.createElement('label', { key: 'label', className: 'form-label small fw-bold text-muted' }, 'Allowed Networks'),
+                          React.createElement('input', { key: 'input', type: 'text', className: 'form-control form-control-modern', placeholder: 'Role default, e.g. 10.0.0.0/8', value: currentUser.allowedNetworks || '', onChange: e => setCurrentUser({...currentUser, allowedNetworks: e.target.value}) })
+                      ]),
+                      React.createElement('div', { key: 'denied-col', className: 'col-md-6 mb-3' }, [
+                          React.createElement('label', { key: 'label', className: 'form-label small fw-bold text-muted' }, 'Denied Networks'),
+                          React.createElement('input', { key: 'input', type: 'text', className: 'form-control form-control-modern', placeholder: 'e.g. 203.0.113.7', value: currentUser.deniedNetworks || '', onChange: e => setCurrentUser({...currentUser, deniedNetworks: e.target.value}) })
+                      ])
+                  ]),
                   React.createElement('div', { key: 'password-field', className: 'mb-3' }, [
                               React.createElement('label', { className: 'form-label small fw-bold text-muted' }, modalMode === 'edit' ? 'New Password (Optional)' : 'Password'),
                               React.createElement('input', { type: 'password', className: 'form-control form-control-modern', placeholder: '••••••••', value: currentUser.password, onChange: e => setCurrentUser({...currentUser, password: e.target.value}) })
@@ -483,7 +794,7 @@ export default function Users({ showToast }) {
                     )
                   ),
                   React.createElement('h5', { key: 'title', className: 'fw-bold mb-2' }, 'Delete User?'),
-                  React.createElement('p', { key: 'text', className: 'text-muted small mb-4' }, `Are you sure you want to delete "${userToDelete?.name}"? This action cannot be undone.`),
+                  React.createElement('p', { key: 'text', className: 'text-muted small mb-4' }, `Are you sure you want to delete "${userToDelete?.name}"? They can be restored from Deleted users until they are purged.`),
                   React.createElement('div', { key: 'buttons', className: 'd-flex gap-2 justify-content-center' }, [
                       React.createElement('button', { key: 'cancel', type: 'button', className: 'btn btn-light rounded-pill px-4 w-50', onClick: () => setShowDeleteModal(false) }, 'Cancel'),
                       React.createElement('button', { key: 'confirm', type: 'button', className: 'btn btn-danger rounded-pill px-4 w-50', onClick: handleDelete }, 'Delete')
@@ -526,7 +837,8 @@ export default function Users({ showToast }) {
                                           React.createElement('th', { key: 'action' }, 'Action'),
                                           React.createElement('th', { key: 'changedBy' }, 'Changed By'),
                                           React.createElement('th', { key: 'date' }, 'Date'),
-                                          React.createElement('th', { key: 'details' }, 'Details')
+                                          React.createElement('th', { key: 'details' }, 'Details'),
+                                          React.createElement('th', { key: 'restore' }, '')
                                       ])
                                   ),
                                   React.createElement('tbody', { key: 'tbody' }, 
@@ -534,15 +846,27 @@ export default function Users({ showToast }) {
                                           React.createElement('tr', { key: log.id }, [
                                               React.createElement('td', { key: 'action' }, 
                                                   React.createElement('span', { 
-                                                      className: `badge ${log.action === 'DELETE' ? 'bg-danger' : 'bg-warning text-dark'} bg-opacity-10` 
+                                                      className: `badge ${log.action === 'DELETE' ? 'bg-danger' : log.action === 'RESTORE' ? 'bg-success' : 'bg-warning text-dark'} bg-opacity-10` 
                                                   }, log.action)
                                               ),
                                               React.createElement('td', { key: 'changedBy' }, log.changedBy),
                                               React.createElement('td', { key: 'date' }, new Date(log.changedAt).toLocaleString()),
-                                              React.createElement('td', { key: 'details' }, 
-                                                  React.createElement('small', { className: 'text-muted' }, 
+                                              React.createElement('td', { key: 'details' }, [
+                                                  React.createElement('small', { key: 'snapshot', className: 'text-muted d-block' }, 
                                                       `${log.name} (${log.email}) - ${log.role}`
+                                                  ),
+                                                  (log.changes || []).map(change =>
+                                                      React.createElement('small', { key: change.field, className: 'd-block' },
+                                                          `${change.field}: ${String(change.from)} \u2192 ${String(change.to)}`
+                                                      )
                                                   )
+                                              ]),
+                                              React.createElement('td', { key: 'restore', className: 'text-end' },
+                                                  React.createElement('button', {
+                                                      className: 'btn btn-sm btn-outline-primary rounded-pill px-3',
+                                                      title: 'Restore this version',
+                                                      onClick: () => handleRestoreHistory(log)
+                                                  }, 'Restore')
                                               )
                                           ])
                                       )
@@ -559,6 +883,303 @@ export default function Users({ showToast }) {
         ),
         document.body,
         'history-modal'
+      ),
+
+      // Import Modal
+      showImportModal && ReactDOM.createPortal(
+        React.createElement('div', {
+            key: 'import-modal',
+            className: 'modal fade show d-block',
+            tabIndex: '-1',
+            style: { zIndex: 1055, display: 'block', overflowX: 'hidden', overflowY: 'auto' },
+            role: 'dialog'
+        },
+          React.createElement('div', { className: 'modal-dialog modal-dialog-centered modal-lg' },
+              React.createElement('div', { className: 'modal-content border-0 shadow-lg animate-fade-in', style: { borderRadius: '20px' } }, [
+                  React.createElement('div', { key: 'header', className: 'modal-header border-bottom-0 bg-modern-subtle' }, [
+                      React.createElement('h5', { key: 'title', className: 'modal-title fw-bold' }, 'Import Users'),
+                      React.createElement('button', { key: 'close', type: 'button', className: 'btn-close', onClick: () => setShowImportModal(false) })
+                  ]),
+                  React.createElement('div', { key: 'body', className: 'modal-body p-4' }, [
+                      React.createElement('p', { key: 'help', className: 'text-muted small' },
+                          'Upload an .xlsx or .csv file with the columns email, name, role and active. An optional password column sets a starting password that must be changed at the first login; new users without one set their own through Forgot password. Existing users are matched by email and updated.'),
+                      React.createElement('input', {
+                          key: 'file',
+                          type: 'file',
+                          className: 'form-control mb-3',
+                          accept: '.xlsx,.csv',
+                          onChange: (e) => { setImportFile(e.target.files[0] || null); setImportResult(null); }
+                      }),
+                      React.createElement('div', { key: 'dry-run', className: 'form-check mb-3' }, [
+                          React.createElement('input', {
+                              key: 'input',
+                              id: 'import-dry-run',
+                              type: 'checkbox',
+                              className: 'form-check-input',
+                              checked: importDryRun,
+                              onChange: (e) => setImportDryRun(e.target.checked)
+                          }),
+                          React.createElement('label', { key: 'label', className: 'form-check-label', htmlFor: 'import-dry-run' }, 'Dry run (check the file without saving)')
+                      ]),
+                      importResult && React.createElement('div', { key: 'result' }, [
+                          React.createElement('div', { key: 'counts', className: 'd-flex flex-wrap gap-2 mb-3' }, [
+                              importResult.dryRun && React.createElement('span', { key: 'dry', className: 'badge bg-secondary' }, 'Dry run'),
+                              React.createElement('span', { key: 'created', className: 'badge bg-success' }, `${importResult.created} created`),
+                              React.createElement('span', { key: 'updated', className: 'badge bg-primary' }, `${importResult.updated} updated`),
+                              React.createElement('span', { key: 'skipped', className: 'badge bg-warning text-dark' }, `${importResult.skipped} skipped`)
+                          ]),
+                          importResult.errors.length > 0 && React.createElement('div', { key: 'errors', className: 'table-responsive', style: { maxHeight: '300px' } },
+                              React.createElement('table', { className: 'table table-sm table-modern mb-0' }, [
+                                  React.createElement('thead', { key: 'thead' },
+                                      React.createElement('tr', null, [
+                                          React.createElement('th', { key: 'row' }, 'Row'),
+                                          React.createElement('th', { key: 'email' }, 'Email'),
+                                          React.createElement('th', { key: 'error' }, 'Error')
+                                      ])
+                                  ),
+                                  React.createElement('tbody', { key: 'tbody' },
+                                      importResult.errors.map((e, i) =>
+                                          React.createElement('tr', { key: i }, [
+                                              React.createElement('td', { key: 'row' }, e.row),
+                                              React.createElement('td', { key: 'email' }, e.email),
+                                              React.createElement('td', { key: 'error' }, React.createElement('small', { className: 'text-danger' }, e.message))
+                                          ])
+                                      )
+                                  )
+                              ])
+                          )
+                      ])
+                  ]),
+                  React.createElement('div', { key: 'footer', className: 'modal-footer border-top-0 bg-modern-subtle' }, [
+                      importResult && importResult.errorReportUrl && React.createElement('button', { key: 'download', type: 'button', className: 'btn btn-outline-danger rounded-pill px-4', onClick: downloadImportErrors }, 'Download errors'),
+                      React.createElement('button', { key: 'close-btn', type: 'button', className: 'btn btn-secondary rounded-pill px-4', onClick: () => setShowImportModal(false) }, 'Close'),
+                      React.createElement('button', { key: 'import-btn', type: 'button', className: 'btn btn-primary rounded-pill px-4', disabled: !importFile || importing, onClick: handleImport },
+                          importing ? 'Importing...' : (importDryRun ? 'Check file' : 'Import'))
+                  ])
+              ])
+          )
+        ),
+        document.body,
+        'import-modal'
+      ),
+
+      // Deleted Users Modal
+      showDeletedModal && ReactDOM.createPortal(
+        React.createElement('div', {
+            key: 'deleted-modal',
+            className: 'modal fade show d-block',
+            tabIndex: '-1',
+            style: { zIndex: 1055, display: 'block', overflowX: 'hidden', overflowY: 'auto' },
+            role: 'dialog'
+        },
+          React.createElement('div', { className: 'modal-dialog modal-dialog-centered modal-lg' },
+              React.createElement('div', { className: 'modal-content border-0 shadow-lg animate-fade-in', style: { borderRadius: '20px' } }, [
+                  React.createElement('div', { key: 'header', className: 'modal-header border-bottom-0 bg-modern-subtle' }, [
+                      React.createElement('h5', { key: 'title', className: 'modal-title fw-bold' }, 'Deleted Users'),
+                      React.createElement('button', { key: 'close', type: 'button', className: 'btn-close', onClick: () => setShowDeletedModal(false) })
+                  ]),
+                  React.createElement('div', { key: 'body', className: 'modal-body p-4' },
+                      loadingDeleted
+                      ? React.createElement('div', { className: 'd-flex justify-content-center py-5' },
+                          React.createElement('div', { className: 'spinner-border text-primary', role: 'status' })
+                        )
+                      : deletedUsers.length === 0
+                          ? React.createElement('div', { className: 'text-center text-muted py-5' }, 'No deleted users.')
+                          : React.createElement('div', { className: 'table-responsive' },
+                              React.createElement('table', { className: 'table table-hover table-modern mb-0' }, [
+                                  React.createElement('thead', { key: 'thead' },
+                                      React.createElement('tr', null, [
+                                          React.createElement('th', { key: 'user' }, 'User'),
+                                          React.createElement('th', { key: 'role' }, 'Role'),
+                                          React.createElement('th', { key: 'deleted' }, 'Deleted'),
+                                          React.createElement('th', { key: 'actions', className: 'text-end' }, '')
+                                      ])
+                                  ),
+                                  React.createElement('tbody', { key: 'tbody' },
+                                      deletedUsers.map(user =>
+                                          React.createElement('tr', { key: user.id }, [
+                                              React.createElement('td', { key: 'user' }, [
+                                                  React.createElement('div', { key: 'name', className: 'small fw-bold' }, user.name),
+                                                  React.createElement('div', { key: 'email', className: 'small text-muted' }, user.email)
+                                              ]),
+                                              React.createElement('td', { key: 'role' }, user.role),
+                                              React.createElement('td', { key: 'deleted' },
+                                                  React.createElement('small', { className: 'text-muted' },
+                                                      `${new Date(user.deletedAt).toLocaleString()}${user.deletedBy ? ' by ' + user.deletedBy : ''}`
+                                                  )
+                                              ),
+                                              React.createElement('td', { key: 'actions', className: 'text-end' },
+                                                  React.createElement('button', { className: 'btn btn-sm btn-outline-primary rounded-pill px-3', onClick: () => handleRestore(user) }, 'Restore')
+                                              )
+                                          ])
+                                      )
+                                  )
+                              ])
+                          )
+                  ),
+                  React.createElement('div', { key: 'footer', className: 'modal-footer border-top-0 bg-modern-subtle' }, [
+                      React.createElement('button', { key: 'close-btn', type: 'button', className: 'btn btn-secondary rounded-pill px-4', onClick: () => setShowDeletedModal(false) }, 'Close')
+                  ])
+              ])
+          )
+        ),
+        document.body,
+        'deleted-modal'
+      ),
+
+      // Registrations Modal
+      showRegistrationsModal && ReactDOM.createPortal(
+        React.createElement('div', {
+            key: 'registrations-modal',
+            className: 'modal fade show d-block',
+            tabIndex: '-1',
+            style: { zIndex: 1055, display: 'block', overflowX: 'hidden', overflowY: 'auto' },
+            role: 'dialog'
+        },
+          React.createElement('div', { className: 'modal-dialog modal-dialog-centered modal-lg' },
+              React.createElement('div', { className: 'modal-content border-0 shadow-lg animate-fade-in', style: { borderRadius: '20px' } }, [
+                  React.createElement('div', { key: 'header', className: 'modal-header border-bottom-0 bg-modern-subtle' }, [
+                      React.createElement('h5', { key: 'title', className: 'modal-title fw-bold' }, 'Registrations'),
+                      React.createElement('button', { key: 'close', type: 'button', className: 'btn-close', onClick: () => setShowRegistrationsModal(false) })
+                  ]),
+                  React.createElement('div', { key: 'body', className: 'modal-body p-4' },
+                      loadingRegistrations
+                      ? React.createElement('div', { className: 'd-flex justify-content-center py-5' },
+                          React.createElement('div', { className: 'spinner-border text-primary', role: 'status' })
+                        )
+                      : registrations.length === 0
+                          ? React.createElement('div', { className: 'text-center text-muted py-5' }, 'No registrations waiting.')
+                          : React.createElement('div', { className: 'table-responsive' },
+                              React.createElement('table', { className: 'table table-hover table-modern mb-0' }, [
+                                  React.createElement('thead', { key: 'thead' },
+                                      React.createElement('tr', null, [
+                                          React.createElement('th', { key: 'user' }, 'User'),
+                                          React.createElement('th', { key: 'role' }, 'Role'),
+                                          React.createElement('th', { key: 'status' }, 'Status'),
+                                          React.createElement('th', { key: 'actions', className: 'text-end' }, '')
+                                      ])
+                                  ),
+                                  React.createElement('tbody', { key: 'tbody' },
+                                      registrations.map(user =>
+                                          React.createElement('tr', { key: user.id }, [
+                                              React.createElement('td', { key: 'user' }, [
+                                                  React.createElement('div', { key: 'name', className: 'small fw-bold' }, user.name),
+                                                  React.createElement('div', { key: 'email', className: 'small text-muted' }, user.email)
+                                              ]),
+                                              React.createElement('td', { key: 'role' }, user.role),
+                                              React.createElement('td', { key: 'status' },
+                                                  user.registrationStatus === 'pending_approval'
+                                                  ? React.createElement('span', { className: 'badge bg-warning text-dark' }, 'Awaiting approval')
+                                                  : React.createElement('span', { className: 'badge bg-secondary' }, 'Email not confirmed')
+                                              ),
+                                              React.createElement('td', { key: 'actions', className: 'text-end text-nowrap' }, [
+                                                  user.registrationStatus === 'pending_approval' && React.createElement('button', { key: 'approve', className: 'btn btn-sm btn-outline-primary rounded-pill px-3 me-2', onClick: () => handleRegistrationDecision(user, 'approve') }, 'Approve'),
+                                                  React.createElement('button', { key: 'reject', className: 'btn btn-sm btn-outline-danger rounded-pill px-3', onClick: () => handleRegistrationDecision(user, 'reject') }, 'Reject')
+                                              ])
+                                          ])
+                                      )
+                                  )
+                              ])
+                          )
+                  ),
+                  React.createElement('div', { key: 'footer', className: 'modal-footer border-top-0 bg-modern-subtle' }, [
+                      React.createElement('button', { key: 'close-btn', type: 'button', className: 'btn btn-secondary rounded-pill px-4', onClick: () => setShowRegistrationsModal(false) }, 'Close')
+                  ])
+              ])
+          )
+        ),
+        document.body,
+        'registrations-modal'
+      ),
+
+      // Invitations Modal
+      showInvitationsModal && ReactDOM.createPortal(
+        React.createElement('div', {
+            key: 'invitations-modal',
+            className: 'modal fade show d-block',
+            tabIndex: '-1',
+            style: { zIndex: 1055, display: 'block', overflowX: 'hidden', overflowY: 'auto' },
+            role: 'dialog'
+        },
+          React.createElement('div', { className: 'modal-dialog modal-dialog-centered modal-lg' },
+              React.createElement('div', { className: 'modal-content border-0 shadow-lg animate-fade-in', style: { borderRadius: '20px' } }, [
+                  React.createElement('div', { key: 'header', className: 'modal-header border-bottom-0 bg-modern-subtle' }, [
+                      React.createElement('h5', { key: 'title', className: 'modal-title fw-bold' }, 'Invitations'),
+                      React.createElement('button', { key: 'close', type: 'button', className: 'btn-close', onClick: () => setShowInvitationsModal(false) })
+                  ]),
+                  React.createElement('div', { key: 'body', className: 'modal-body p-4' }, [
+                      React.createElement('form', { key: 'form', className: 'row g-2 align-items-end mb-4', onSubmit: handleInvite }, [
+                          React.createElement('div', { key: 'email', className: 'col-md-4' }, [
+                              React.createElement('label', { key: 'l', className: 'form-label small text-muted' }, 'Email'),
+                              React.createElement('input', { key: 'i', type: 'email', required: true, className: 'form-control form-control-modern', value: newInvitation.email, onChange: (e) => setNewInvitation({ ...newInvitation, email: e.target.value }) })
+                          ]),
+                          React.createElement('div', { key: 'name', className: 'col-md-3' }, [
+                              React.createElement('label', { key: 'l', className: 'form-label small text-muted' }, 'Name (optional)'),
+                              React.createElement('input', { key: 'i', type: 'text', className: 'form-control form-control-modern', value: newInvitation.name, onChange: (e) => setNewInvitation({ ...newInvitation, name: e.target.value }) })
+                          ]),
+                          React.createElement('div', { key: 'role', className: 'col-md-3' }, [
+                              React.createElement('label', { key: 'l', className: 'form-label small text-muted' }, 'Role'),
+                              React.createElement('select', { key: 'i', className: 'form-select form-control-modern', value: newInvitation.roleId, onChange: (e) => setNewInvitation({ ...newInvitation, roleId: parseInt(e.target.value, 10) }) },
+                                  roles.map(role => React.createElement('option', { key: role.id, value: role.id }, role.name))
+                              )
+                          ]),
+                          React.createElement('div', { key: 'submit', className: 'col-md-2' },
+                              React.createElement('button', { type: 'submit', className: 'btn btn-primary rounded-pill w-100', disabled: inviting || !newInvitation.roleId }, inviting ? 'Sending...' : 'Invite')
+                          )
+                      ]),
+                      loadingInvitations
+                      ? React.createElement('div', { key: 'loading', className: 'd-flex justify-content-center py-5' },
+                          React.createElement('div', { className: 'spinner-border text-primary', role: 'status' })
+                        )
+                      : invitations.length === 0
+                          ? React.createElement('div', { key: 'empty', className: 'text-center text-muted py-5' }, 'No invitations yet.')
+                          : React.createElement('div', { key: 'table', className: 'table-responsive' },
+                              React.createElement('table', { className: 'table table-hover table-modern mb-0' }, [
+                                  React.createElement('thead', { key: 'thead' },
+                                      React.createElement('tr', null, [
+                                          React.createElement('th', { key: 'email' }, 'Invitee'),
+                                          React.createElement('th', { key: 'role' }, 'Role'),
+                                          React.createElement('th', { key: 'status' }, 'Status'),
+                                          React.createElement('th', { key: 'sent' }, 'Sent'),
+                                          React.createElement('th', { key: 'actions', className: 'text-end' }, '')
+                                      ])
+                                  ),
+                                  React.createElement('tbody', { key: 'tbody' },
+                                      invitations.map(invitation =>
+                                          React.createElement('tr', { key: invitation.id }, [
+                                              React.createElement('td', { key: 'email' }, [
+                                                  invitation.name && React.createElement('div', { key: 'name', className: 'small fw-bold' }, invitation.name),
+                                                  React.createElement('div', { key: 'email', className: 'small text-muted' }, invitation.email)
+                                              ]),
+                                              React.createElement('td', { key: 'role' }, invitation.roleName),
+                                              React.createElement('td', { key: 'status' },
+                                                  React.createElement('span', { className: `badge ${invitationBadges[invitation.status] || 'bg-secondary'}` }, invitation.status)
+                                              ),
+                                              React.createElement('td', { key: 'sent' },
+                                                  React.createElement('small', { className: 'text-muted' },
+                                                      `${new Date(invitation.sentAt).toLocaleString()}${invitation.invitedBy ? ' by ' + invitation.invitedBy : ''}`
+                                                  )
+                                              ),
+                                              React.createElement('td', { key: 'actions', className: 'text-end text-nowrap' },
+                                                  (invitation.status === 'pending' || invitation.status === 'expired') && [
+                                                      React.createElement('button', { key: 'resend', className: 'btn btn-sm btn-outline-primary rounded-pill px-3 me-2', onClick: () => handleInvitationAction(invitation, 'resend') }, 'Resend'),
+                                                      React.createElement('button', { key: 'revoke', className: 'btn btn-sm btn-outline-danger rounded-pill px-3', onClick: () => handleInvitationAction(invitation, 'revoke') }, 'Revoke')
+                                                  ]
+                                              )
+                                          ])
+                                      )
+                                  )
+                              ])
+                          )
+                  ]),
+                  React.createElement('div', { key: 'footer', className: 'modal-footer border-top-0 bg-modern-subtle' }, [
+                      React.createElement('button', { key: 'close-btn', type: 'button', className: 'btn btn-secondary rounded-pill px-4', onClick: () => setShowInvitationsModal(false) }, 'Close')
+                  ])
+              ])
+          )
+        ),
+        document.body,
+        'invitations-modal'
       )
   ]);
 }
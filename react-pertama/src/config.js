@@ -1,7 +1,12 @@
 const config = {
     api: {
         baseUrl: "http://localhost:8081", // Point to Go Backend
+    },
+    auth: {
+        // Must match AUTH_SESSION_MODE=cookie on the backend: the session lives in
+        // HttpOnly cookies and requests carry the CSRF token instead of a bearer token
+        cookieSessions: false,
     }
 };
 
-export default config;
\ No newline at end of file
+export default config;
@@ -1,5 +1,8 @@
 import { React, createRoot } from '/src/libs.js';
 import App from '/src/App.jsx';
+import { installCookieSessions } from '/src/session.js';
+
+installCookieSessions();
 
 const container = document.getElementById('root');
 const root = createRoot(container);
@@ -0,0 +1,73 @@
+import config from '/src/config.js';
+
+// In cookie session mode the browser holds the session in HttpOnly cookies.
+// Every call to the backend must then include credentials, and state-changing
+// calls must echo the CSRF token returned at login in the X-CSRF-Token header.
+export function installCookieSessions() {
+  if (!config.auth.cookieSessions) return;
+
+  const nativeFetch = window.fetch.bind(window);
+  window.fetch = (input, init = {}) => {
+    const url = typeof input === 'string' ? input : input.url;
+    if (!url.startsWith(config.api.baseUrl)) {
+      return nativeFetch(input, init);
+    }
+
+    const headers = new Headers(init.headers || {});
+    const method = (init.method || 'GET').toUpperCase();
+    const csrfToken = localStorage.getItem('csrfToken');
+    if (csrfToken && !['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+      headers.set('X-CSRF-Token', csrfToken);
+    }
+    // Components still add "Bearer <token>"; without a stored token that header is empty
+    if (/^Bearer\s*(null|undefined)?$/.test(headers.get('Authorization') || '')) {
+      headers.delete('Authorization');
+    }
+    return nativeFetch(input, { ...init, headers, credentials: 'include' });
+  };
+}
+
+// saveSession stores what the login response leaves for the page: the bearer
+// token in bearer mode, or only the CSRF token in cookie mode.
+export function saveSession(data) {
+  if (data.token) localStorage.setItem('token', data.token);
+  if (data.csrfToken) localStorage.setItem('csrfToken', data.csrfToken);
+  localStorage.setItem('user', JSON.stringify(data.user));
+}
+
+export function hasSession() {
+  return !!(localStorage.getItem('token') || localStorage.getItem('csrfToken'));
+}
+
+export function clearSession() {
+  localStorage.removeItem('token');
+  localStorage.removeItem('csrfToken');
+  localStorage.removeItem('user');
+}
+
+// startImpersonation puts the admin's own session aside and switches the page
+// to the impersonated user. Impersonation always uses a bearer token.
+export function startImpersonation(data) {
+  localStorage.setItem('impersonatorSession', JSON.stringify({
+    token: localStorage.getItem('token'),
+    csrfToken: localStorage.getItem('csrfToken'),
+    user: localStorage.getItem('user'),
+  }));
+  localStorage.removeItem('csrfToken');
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('user', JSON.stringify(data.user));
+}
+
+// endImpersonation restores the admin's session. It returns false when the
+// page was not impersonating anyone.
+export function endImpersonation() {
+  const saved = JSON.parse(localStorage.getItem('impersonatorSession') || 'null');
+  localStorage.removeItem('impersonatorSession');
+  if (!saved) return false;
+
+  clearSession();
+  if (saved.token) localStorage.setItem('token', saved.token);
+  if (saved.csrfToken) localStorage.setItem('csrfToken', saved.csrfToken);
+  if (saved.user) localStorage.setItem('user', saved.user);
+  return true;
+}